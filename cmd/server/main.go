@@ -6,6 +6,7 @@ import (
 	"errors"
 	"fmt"
 	"log"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
@@ -17,12 +18,21 @@ import (
 	"github.com/smartfor/metrics/internal/core"
 	"github.com/smartfor/metrics/internal/logger"
 	"github.com/smartfor/metrics/internal/server/config"
+	"github.com/smartfor/metrics/internal/server/graphite"
+	"github.com/smartfor/metrics/internal/server/grpcserver"
 	"github.com/smartfor/metrics/internal/server/handlers"
+	"github.com/smartfor/metrics/internal/server/statsd"
 	"github.com/smartfor/metrics/internal/server/storage"
 	"go.uber.org/zap"
+	"google.golang.org/grpc"
 )
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		migrateMain()
+		return
+	}
+
 	build.PrintGlobalVars()
 
 	cfg, err := config.GetConfig()
@@ -37,12 +47,17 @@ func main() {
 
 	zlog.Sugar().Infof("Server config: %+v", cfg)
 
-	backupStorage, err := storage.NewFileStorage(cfg.FileStoragePath)
+	backupStorage, err := storage.NewFileStorageWithConfig(storage.FileStorageConfig{
+		Path:        cfg.FileStoragePath,
+		Generations: cfg.SnapshotGenerations,
+		Format:      storage.SnapshotFormat(cfg.SnapshotFormat),
+		Compression: storage.SnapshotCompression(cfg.SnapshotCompression),
+	})
 	if err != nil {
 		zlog.Fatal("Error creating backup storage: ", zap.Error(err))
 	}
 
-	memStorage, err := storage.NewMemStorage(backupStorage, cfg.Restore, cfg.StoreIntervalDuration == 0)
+	memStorage, err := storage.NewMemStorage(backupStorage, cfg.Restore, cfg.StoreIntervalDuration == 0, cfg.HistorySize)
 	if err != nil {
 		zlog.Fatal("Error creating metric storage: ", zap.Error(err))
 	}
@@ -66,13 +81,13 @@ func main() {
 
 	var router chi.Router
 	if postgresStorage != nil {
-		router = handlers.Router(postgresStorage, zlog, cfg.Secret, privateKey)
+		router = handlers.Router(postgresStorage, zlog, cfg.Secret, privateKey, cfg.InfluxGaugeFieldsList)
 	} else {
-		router = handlers.Router(memStorage, zlog, cfg.Secret, privateKey)
+		router = handlers.Router(memStorage, zlog, cfg.Secret, privateKey, cfg.InfluxGaugeFieldsList)
 		if cfg.StoreIntervalDuration > 0 {
 			go func(
 				storage core.Storage,
-				backup core.Storage,
+				backup *storage.FileStorage,
 				interval time.Duration,
 			) {
 				time.Sleep(interval)
@@ -80,14 +95,70 @@ func main() {
 				defer ticker.Stop()
 
 				for range ticker.C {
-					if err := core.Sync(context.Background(), storage, backup); err != nil {
+					if err := saveSnapshot(context.Background(), storage, backup); err != nil {
 						fmt.Println(err)
-						zlog.Error("Error sync metrics: ", zap.Error(err))
+						zlog.Error("Error writing metrics snapshot: ", zap.Error(err))
 					}
 				}
 			}(memStorage, backupStorage, cfg.StoreIntervalDuration)
 		}
 	}
+
+	var metricStorage core.Storage = memStorage
+	if postgresStorage != nil {
+		metricStorage = postgresStorage
+	}
+
+	var grpcServer *grpc.Server
+	if cfg.GRPCAddress != "" {
+		listener, err := net.Listen("tcp", cfg.GRPCAddress)
+		if err != nil {
+			zlog.Fatal("Error listening gRPC address: ", zap.Error(err))
+		}
+
+		grpcServer = grpcserver.NewServer(metricStorage, zlog, cfg.Secret, privateKey)
+		go func() {
+			log.Printf("gRPC server is ready to handle requests at %s", cfg.GRPCAddress)
+			if err := grpcServer.Serve(listener); err != nil {
+				zlog.Error("gRPC server failed: ", zap.Error(err))
+			}
+		}()
+	}
+
+	statsdCtx, stopStatsD := context.WithCancel(context.Background())
+	statsdDone := make(chan struct{})
+	if cfg.StatsDAddress != "" {
+		statsdServer, err := statsd.NewServer(cfg.StatsDAddress, metricStorage, cfg.StatsDFlushIntervalDuration, zlog)
+		if err != nil {
+			zlog.Fatal("Error listening StatsD address: ", zap.Error(err))
+		}
+
+		go func() {
+			defer close(statsdDone)
+			log.Printf("StatsD listener is ready to receive metrics at %s", cfg.StatsDAddress)
+			if err := statsdServer.Run(statsdCtx); err != nil {
+				zlog.Error("StatsD listener failed: ", zap.Error(err))
+			}
+		}()
+	} else {
+		close(statsdDone)
+	}
+
+	var graphiteServer *graphite.Server
+	if cfg.GraphiteAddress != "" {
+		graphiteServer, err = graphite.NewServer(cfg.GraphiteAddress, metricStorage, zlog)
+		if err != nil {
+			zlog.Fatal("Error listening Graphite address: ", zap.Error(err))
+		}
+
+		go func() {
+			log.Printf("Graphite listener is ready to receive metrics at %s", cfg.GraphiteAddress)
+			if err := graphiteServer.Serve(); err != nil {
+				zlog.Error("Graphite listener failed: ", zap.Error(err))
+			}
+		}()
+	}
+
 	server := &http.Server{
 		Addr:              cfg.Addr,
 		ReadHeaderTimeout: 10 * time.Second,
@@ -104,6 +175,32 @@ func main() {
 		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 		defer cancel()
 
+		if grpcServer != nil {
+			stopped := make(chan struct{})
+			go func() {
+				grpcServer.GracefulStop()
+				close(stopped)
+			}()
+
+			select {
+			case <-stopped:
+			case <-ctx.Done():
+				grpcServer.Stop()
+			}
+		}
+
+		stopStatsD()
+		select {
+		case <-statsdDone:
+		case <-ctx.Done():
+		}
+
+		if graphiteServer != nil {
+			if err := graphiteServer.Shutdown(ctx); err != nil {
+				zlog.Error("Graphite listener Shutdown Failed: ", zap.Error(err))
+			}
+		}
+
 		if err := server.Shutdown(ctx); err != nil {
 			zlog.Fatal("Server Shutdown Failed: ", zap.Error(err))
 		}
@@ -113,7 +210,7 @@ func main() {
 
 	log.Printf("Server is ready to handle requests at %s", cfg.Addr)
 	if err := server.ListenAndServe(); err != nil && errors.Is(err, http.ErrServerClosed) {
-		if err := core.Sync(context.Background(), memStorage, backupStorage); err != nil {
+		if err := saveSnapshot(context.Background(), memStorage, backupStorage); err != nil {
 			zlog.Fatal("Memstorage Backup Failed: ", zap.Error(err))
 		}
 		if err := memStorage.Close(); err != nil {
@@ -121,3 +218,13 @@ func main() {
 		}
 	}
 }
+
+// saveSnapshot сохраняет состояние source в новый снимок backup.
+func saveSnapshot(ctx context.Context, source core.Storage, backup *storage.FileStorage) error {
+	values, err := source.GetAll(ctx)
+	if err != nil {
+		return err
+	}
+
+	return backup.SaveSnapshot(ctx, values)
+}
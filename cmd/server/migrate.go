@@ -0,0 +1,118 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/smartfor/metrics/internal/cfgutils"
+	"github.com/smartfor/metrics/internal/server/storage/migrations"
+)
+
+const migrateUsage = `usage: server migrate [-d dsn] up [steps] | down [steps] | status
+
+  up      применить steps миграций, по умолчанию все
+  down    откатить steps последних миграций, по умолчанию одну
+  status  показать состояние миграций
+`
+
+var (
+	errMigrateUsage = errors.New("invalid migrate arguments")
+	errNoDatabase   = errors.New("database DSN is not set")
+)
+
+// runMigrate выполняет подкоманду migrate, args - аргументы после migrate.
+func runMigrate(args []string) error {
+	fs := flag.NewFlagSet("migrate", flag.ContinueOnError)
+	fs.Usage = func() { fmt.Fprint(fs.Output(), migrateUsage) }
+
+	var dsn string
+	fs.StringVar(&dsn, "d", "", "database DSN")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	cfgutils.TryTakeStringFromEnv("DATABASE_DSN", &dsn)
+	if dsn == "" {
+		return errNoDatabase
+	}
+
+	if fs.NArg() == 0 || fs.NArg() > 2 {
+		fs.Usage()
+		return errMigrateUsage
+	}
+	command := fs.Arg(0)
+	if command != "up" && command != "down" && command != "status" {
+		fs.Usage()
+		return errMigrateUsage
+	}
+
+	steps := 0
+	if command == "down" {
+		steps = 1
+	}
+	if fs.NArg() == 2 {
+		n, err := strconv.Atoi(fs.Arg(1))
+		if err != nil || n <= 0 || command == "status" {
+			fs.Usage()
+			return errMigrateUsage
+		}
+		steps = n
+	}
+
+	ctx := context.Background()
+	pool, err := pgxpool.New(ctx, dsn)
+	if err != nil {
+		return err
+	}
+	defer pool.Close()
+
+	migrator, err := migrations.NewMigrator(pool)
+	if err != nil {
+		return err
+	}
+
+	switch command {
+	case "up":
+		done, err := migrator.Up(ctx, steps)
+		for _, m := range done {
+			fmt.Printf("applied %04d %s\n", m.Version, m.Name)
+		}
+		if err == nil && len(done) == 0 {
+			fmt.Println("no migrations to apply")
+		}
+		return err
+	case "down":
+		done, err := migrator.Down(ctx, steps)
+		for _, m := range done {
+			fmt.Printf("reverted %04d %s\n", m.Version, m.Name)
+		}
+		if err == nil && len(done) == 0 {
+			fmt.Println("no migrations to revert")
+		}
+		return err
+	default:
+		statuses, err := migrator.Status(ctx)
+		if err != nil {
+			return err
+		}
+		for _, s := range statuses {
+			state := "pending"
+			if s.Applied {
+				state = "applied " + s.AppliedAt.Format("2006-01-02 15:04:05")
+			}
+			fmt.Printf("%04d %-24s %s\n", s.Version, s.Name, state)
+		}
+		return nil
+	}
+}
+
+func migrateMain() {
+	if err := runMigrate(os.Args[2:]); err != nil {
+		fmt.Fprintln(os.Stderr, "migrate:", err)
+		os.Exit(1)
+	}
+}
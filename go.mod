@@ -8,10 +8,14 @@ require (
 	github.com/go-resty/resty/v2 v2.15.3
 	github.com/gordonklaus/ineffassign v0.1.0
 	github.com/jackc/pgx/v5 v5.7.1
+	github.com/klauspost/compress v1.17.9
 	github.com/shirou/gopsutil/v3 v3.24.5
 	github.com/stretchr/testify v1.9.0
+	go.opentelemetry.io/proto/otlp v1.3.1
 	go.uber.org/zap v1.27.0
 	golang.org/x/tools v0.25.0
+	google.golang.org/grpc v1.67.1
+	google.golang.org/protobuf v1.34.2
 	honnef.co/go/tools v0.5.1
 )
 
@@ -50,5 +54,6 @@ require (
 	golang.org/x/sync v0.8.0 // indirect
 	golang.org/x/sys v0.25.0 // indirect
 	golang.org/x/text v0.18.0 // indirect
+	google.golang.org/genproto/googleapis/rpc v0.0.0-20240814211410-ddb44dafa142 // indirect
 	gopkg.in/yaml.v3 v3.0.1 // indirect
 )
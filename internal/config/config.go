@@ -3,31 +3,64 @@ package config
 
 import (
 	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
+	"net"
 	"os"
+	"path/filepath"
 	"strings"
 	"time"
 
 	"github.com/smartfor/metrics/internal/cfgutils"
+	"github.com/smartfor/metrics/internal/core"
+	"github.com/smartfor/metrics/internal/utils"
 )
 
 const (
 	HTTPProto  = "http://"
 	HTTPSProto = "https://"
+
+	// TransportHTTP - отправка метрик на сервер по HTTP в JSON
+	TransportHTTP = "http"
+	// TransportGRPC - отправка метрик на сервер по gRPC
+	TransportGRPC = "grpc"
 )
 
+// CollectorConfig - настройки коллектора метрик агента
+type CollectorConfig struct {
+	// Enabled - включен ли коллектор
+	Enabled bool `json:"enabled"`
+	// Interval - период опроса, по умолчанию PollInterval
+	Interval string `json:"interval"`
+	// Options - параметры, специфичные для коллектора
+	Options json.RawMessage `json:"options,omitempty"`
+	// IntervalDuration - Interval as time.Duration
+	IntervalDuration time.Duration `json:"-"`
+}
+
 type Config struct {
-	HostEndpoint            string `json:"address"`
-	Secret                  string `json:"secret"`
-	CryptoKey               string `json:"crypto_key"`
-	RateLimit               int    `json:"rate_limit"`
-	PollInterval            string `json:"poll_interval"`
-	ReportInterval          string `json:"report_interval"`
-	ResponseTimeout         string `json:"response_timeout"`
+	HostEndpoint            string                     `json:"address"`
+	Secret                  string                     `json:"secret"`
+	CryptoKey               string                     `json:"crypto_key"`
+	RateLimit               int                        `json:"rate_limit"`
+	PollInterval            string                     `json:"poll_interval"`
+	ReportInterval          string                     `json:"report_interval"`
+	ResponseTimeout         string                     `json:"response_timeout"`
+	Labels                  map[string]string          `json:"labels"`
+	Transport               string                     `json:"transport"`
+	GRPCAddress             string                     `json:"grpc_address"`
+	AgentID                 string                     `json:"agent_id"`
+	SpoolDir                string                     `json:"spool_dir"`
+	SpoolMaxSize            int                        `json:"spool_max_size"`
+	SpoolMaxAge             string                     `json:"spool_max_age"`
+	Collectors              map[string]CollectorConfig `json:"collectors"`
+	PushAddress             string                     `json:"push_address"`
+	PushSocket              string                     `json:"push_socket"`
 	PollIntervalDuration    time.Duration
 	ReportIntervalDuration  time.Duration
 	ResponseTimeoutDuration time.Duration
+	SpoolMaxAgeDuration     time.Duration
 }
 
 func GetConfig() (*Config, error) {
@@ -37,6 +70,14 @@ func GetConfig() (*Config, error) {
 		ReportInterval:  "10s",
 		ResponseTimeout: "3s",
 		RateLimit:       1,
+		Transport:       TransportHTTP,
+		GRPCAddress:     "localhost:3200",
+		SpoolMaxSize:    64 << 20,
+		SpoolMaxAge:     "24h",
+		Collectors: map[string]CollectorConfig{
+			"runtime": {Enabled: true},
+			"system":  {Enabled: true},
+		},
 	}
 
 	// resolve config path
@@ -65,6 +106,13 @@ func GetConfig() (*Config, error) {
 	cfgutils.ParseString("k", "KEY", "secret key", &config.Secret)
 	cfgutils.ParseInt("l", "RATE_LIMIT", "rate limit", &config.RateLimit)
 	cfgutils.ParseString("crypto-key", "CRYPTO_KEY", "crypto key", &config.CryptoKey)
+	cfgutils.ParseString("transport", "TRANSPORT", "transport to send metrics: http or grpc", &config.Transport)
+	cfgutils.ParseString("grpc-address", "GRPC_ADDRESS", "gRPC server address", &config.GRPCAddress)
+	if config.Transport != TransportHTTP && config.Transport != TransportGRPC {
+		return nil, fmt.Errorf("unknown transport: %s", config.Transport)
+	}
+
+	cfgutils.ParseString("agent-id", "AGENT_ID", "agent identifier for batch deduplication on the server", &config.AgentID)
 
 	cfgutils.ParseString("p", "POLL_INTERVAL", "poll interval", &config.PollInterval)
 	val, err := time.ParseDuration(config.PollInterval)
@@ -87,9 +135,150 @@ func GetConfig() (*Config, error) {
 	}
 	config.ResponseTimeoutDuration = val
 
+	cfgutils.ParseString("spool-dir", "SPOOL_DIR", "directory of on-disk spool for unsent batches, empty disables spool", &config.SpoolDir)
+	cfgutils.ParseInt("spool-max-size", "SPOOL_MAX_SIZE", "spool size limit in bytes", &config.SpoolMaxSize)
+	cfgutils.ParseString("spool-max-age", "SPOOL_MAX_AGE", "spooled batches older than this are dropped", &config.SpoolMaxAge)
+	val, err = time.ParseDuration(config.SpoolMaxAge)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing spool max age: %w", err)
+	}
+	config.SpoolMaxAgeDuration = val
+
+	if config.AgentID == "" {
+		config.AgentID, err = loadAgentID(config.SpoolDir)
+		if err != nil {
+			return nil, fmt.Errorf("error loading agent id: %w", err)
+		}
+	}
+
+	var collectors string
+	cfgutils.ParseString("collectors", "COLLECTORS", "comma separated list of enabled collectors", &collectors)
+	if collectors != "" {
+		enabled := make(map[string]bool)
+		for _, name := range strings.Split(collectors, ",") {
+			enabled[strings.TrimSpace(name)] = true
+		}
+
+		for name := range config.Collectors {
+			c := config.Collectors[name]
+			c.Enabled = enabled[name]
+			config.Collectors[name] = c
+		}
+		for name := range enabled {
+			if _, ok := config.Collectors[name]; !ok && name != "" {
+				config.Collectors[name] = CollectorConfig{Enabled: true}
+			}
+		}
+	}
+
+	for name, c := range config.Collectors {
+		c.IntervalDuration = config.PollIntervalDuration
+		if c.Interval != "" {
+			val, err := time.ParseDuration(c.Interval)
+			if err != nil {
+				return nil, fmt.Errorf("error parsing %s collector interval: %w", name, err)
+			}
+			c.IntervalDuration = val
+		}
+		if c.IntervalDuration <= 0 {
+			return nil, fmt.Errorf("%s collector interval must be positive", name)
+		}
+		config.Collectors[name] = c
+	}
+
+	cfgutils.ParseString("push-address", "PUSH_ADDRESS", "localhost address to accept metrics from local applications", &config.PushAddress)
+	cfgutils.ParseString("push-socket", "PUSH_SOCKET", "unix socket to accept metrics from local applications", &config.PushSocket)
+	if config.PushAddress != "" {
+		if err := checkLoopback(config.PushAddress); err != nil {
+			return nil, fmt.Errorf("error parsing push address: %w", err)
+		}
+	}
+
+	var labels string
+	cfgutils.ParseString("labels", "LABELS", "metric labels as comma separated key=value pairs", &labels)
+	if labels != "" {
+		parsed, err := parseLabels(labels)
+		if err != nil {
+			return nil, fmt.Errorf("error parsing labels: %w", err)
+		}
+		config.Labels = parsed
+	}
+	if err := core.Labels(config.Labels).Validate(); err != nil {
+		return nil, fmt.Errorf("error parsing labels: %w", err)
+	}
+
 	if !strings.HasPrefix(config.HostEndpoint, HTTPProto) && !strings.HasPrefix(config.HostEndpoint, HTTPSProto) {
 		config.HostEndpoint = HTTPProto + config.HostEndpoint
 	}
 
 	return config, nil
 }
+
+// checkLoopback проверяет, что address доступен только с локального хоста:
+// приложения отправляют метрики в агент без аутентификации.
+func checkLoopback(address string) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+
+	if host == "localhost" {
+		return nil
+	}
+	if ip := net.ParseIP(host); ip != nil && ip.IsLoopback() {
+		return nil
+	}
+
+	return fmt.Errorf("%s is not a loopback address", address)
+}
+
+// parseLabels разбирает метки из строки вида host=a,region=eu.
+func parseLabels(value string) (map[string]string, error) {
+	labels := make(map[string]string)
+	for _, pair := range strings.Split(value, ",") {
+		name, v, ok := strings.Cut(strings.TrimSpace(pair), "=")
+		if !ok || name == "" {
+			return nil, fmt.Errorf("bad label %q", pair)
+		}
+		labels[name] = v
+	}
+
+	return labels, nil
+}
+
+// agentIDFile - файл в каталоге очереди со сгенерированным идентификатором агента
+const agentIDFile = "agent_id"
+
+// loadAgentID возвращает идентификатор агента, сохраненный в каталоге очереди spoolDir, или создает новый.
+// Пачки из очереди отправляются повторно и после перезапуска агента, поэтому идентификатор должен
+// сохраняться между запусками, иначе сервер не распознает повтор. Без очереди идентификатор случайный.
+func loadAgentID(spoolDir string) (string, error) {
+	if spoolDir == "" {
+		return utils.RandomID(), nil
+	}
+
+	path := filepath.Join(spoolDir, agentIDFile)
+	data, err := os.ReadFile(path)
+	if err == nil {
+		if id := strings.TrimSpace(string(data)); id != "" {
+			return id, nil
+		}
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return "", err
+	}
+
+	if err := os.MkdirAll(spoolDir, 0o700); err != nil {
+		return "", err
+	}
+
+	id := utils.RandomID()
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, []byte(id+"\n"), 0o600); err != nil {
+		return "", err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return "", err
+	}
+
+	return id, nil
+}
@@ -0,0 +1,32 @@
+package config
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoadAgentID(t *testing.T) {
+	t.Run("Generated id survives restart", func(t *testing.T) {
+		dir := filepath.Join(t.TempDir(), "spool")
+
+		first, err := loadAgentID(dir)
+		require.NoError(t, err)
+		require.NotEmpty(t, first)
+
+		second, err := loadAgentID(dir)
+		require.NoError(t, err)
+		assert.Equal(t, first, second)
+	})
+
+	t.Run("Without spool id is random", func(t *testing.T) {
+		first, err := loadAgentID("")
+		require.NoError(t, err)
+
+		second, err := loadAgentID("")
+		require.NoError(t, err)
+		assert.NotEqual(t, first, second)
+	})
+}
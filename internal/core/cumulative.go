@@ -0,0 +1,105 @@
+package core
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+// DefaultCumulativeTTL - время, после которого трекер забывает серию без новых значений
+const DefaultCumulativeTTL = time.Hour
+
+type cumulativeEntry[T any] struct {
+	value T
+	seen  time.Time
+}
+
+// CumulativeTracker хранит последние накопительные (cumulative) значения серий из внешних источников
+// (см. CounterTracker). Серии, не получавшие значений дольше ttl, забываются.
+type CumulativeTracker[T any] struct {
+	mu      *sync.Mutex
+	last    map[string]cumulativeEntry[T]
+	ttl     time.Duration
+	started time.Time
+	swept   time.Time
+	now     func() time.Time
+}
+
+// NewCumulativeTracker - конструктор CumulativeTracker, ttl <= 0 - DefaultCumulativeTTL.
+func NewCumulativeTracker[T any](ttl time.Duration) *CumulativeTracker[T] {
+	if ttl <= 0 {
+		ttl = DefaultCumulativeTTL
+	}
+
+	now := time.Now()
+	return &CumulativeTracker[T]{
+		mu:      &sync.Mutex{},
+		last:    make(map[string]cumulativeEntry[T]),
+		ttl:     ttl,
+		started: now,
+		swept:   now,
+		now:     time.Now,
+	}
+}
+
+// Swap запоминает value последним значением серии key и возвращает предыдущее.
+// Для серии, которую трекер еще не видел, ok=false: ее значение служит точкой отсчета, чтобы после
+// перезапуска не учесть повторно уже сохраненное. Если же серия началась (start) после создания трекера,
+// все ее значение накоплено при нем, поэтому возвращается нулевое предыдущее значение и ok=true.
+// Нулевой start означает, что время начала серии неизвестно.
+func (t *CumulativeTracker[T]) Swap(key string, value T, start time.Time) (prev T, ok bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	now := t.now()
+	if now.Sub(t.swept) >= t.ttl {
+		for k, e := range t.last {
+			if now.Sub(e.seen) > t.ttl {
+				delete(t.last, k)
+			}
+		}
+		t.swept = now
+	}
+
+	entry, ok := t.last[key]
+	t.last[key] = cumulativeEntry[T]{value: value, seen: now}
+
+	if !ok && !start.IsZero() && start.After(t.started) {
+		return prev, true
+	}
+
+	return entry.value, ok
+}
+
+// CounterTracker переводит накопительные значения счетчиков из внешних источников
+// в приращения, которые ожидает Storage: значение Counter в хранилище накапливается при каждой записи.
+// Приращение считается относительно последнего значения серии, поэтому приемник (Receiver) должен
+// держать один трекер на все запросы: трекер на каждый запрос принимал бы любое значение за точку отсчета.
+type CounterTracker struct {
+	values *CumulativeTracker[float64]
+}
+
+func NewCounterTracker() *CounterTracker {
+	return &CounterTracker{values: NewCumulativeTracker[float64](DefaultCumulativeTTL)}
+}
+
+// Delta возвращает приращение накопительного значения value серии key с прошлого вызова.
+// Первое значение серии служит точкой отсчета и дает нулевое приращение (см. CumulativeTracker.Swap).
+// Если значение уменьшилось, считается, что счетчик источника был сброшен, и приращением становится само значение.
+func (t *CounterTracker) Delta(key string, value float64) int64 {
+	return t.DeltaSince(key, value, time.Time{})
+}
+
+// DeltaSince - Delta для источников, сообщающих время начала накопления серии start.
+func (t *CounterTracker) DeltaSince(key string, value float64, start time.Time) int64 {
+	prev, ok := t.values.Swap(key, value, start)
+
+	switch {
+	case !ok:
+		return 0
+	case value < prev:
+		return int64(math.Round(value))
+	default:
+		return int64(math.Round(value) - math.Round(prev))
+	}
+}
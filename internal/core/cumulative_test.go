@@ -0,0 +1,44 @@
+package core
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCounterTracker(t *testing.T) {
+	t.Run("First value is a baseline, reset restarts counting", func(t *testing.T) {
+		tracker := NewCounterTracker()
+
+		assert.Equal(t, int64(0), tracker.Delta("requests", 10))
+		assert.Equal(t, int64(5), tracker.Delta("requests", 15))
+		assert.Equal(t, int64(3), tracker.Delta("requests", 3))
+	})
+
+	t.Run("Series started after tracker counts in full", func(t *testing.T) {
+		tracker := NewCounterTracker()
+		started := tracker.values.started
+
+		assert.Equal(t, int64(0), tracker.DeltaSince("old", 10, started.Add(-time.Minute)))
+		assert.Equal(t, int64(10), tracker.DeltaSince("new", 10, started.Add(time.Second)))
+		assert.Equal(t, int64(2), tracker.DeltaSince("new", 12, started.Add(time.Second)))
+	})
+
+	t.Run("Idle series are evicted", func(t *testing.T) {
+		tracker := NewCounterTracker()
+		now := time.Now()
+		tracker.values.now = func() time.Time { return now }
+
+		tracker.Delta("idle", 10)
+		tracker.Delta("active", 10)
+
+		now = now.Add(DefaultCumulativeTTL / 2)
+		tracker.Delta("active", 11)
+
+		now = now.Add(DefaultCumulativeTTL/2 + time.Second)
+		assert.Equal(t, int64(1), tracker.Delta("active", 12))
+		assert.NotContains(t, tracker.values.last, "idle")
+		assert.Equal(t, int64(0), tracker.Delta("idle", 20))
+	})
+}
@@ -0,0 +1,167 @@
+package core
+
+import (
+	"encoding/json"
+	"errors"
+	"math"
+	"slices"
+)
+
+var (
+	ErrBadHistogramBounds      = errors.New("histogram bounds must be sorted in ascending order")
+	ErrHistogramBoundsMismatch = errors.New("histogram bounds mismatch")
+)
+
+// DefaultHistogramBounds - границы корзин по умолчанию (секунды), подходят для измерения задержек.
+var DefaultHistogramBounds = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// HistogramValue - значение метрики типа histogram.
+// Наблюдения раскладываются по корзинам с верхними границами Bounds,
+// последняя корзина Counts[len(Bounds)] соответствует +Inf.
+type HistogramValue struct {
+	// Bounds - верхние границы корзин (включительно), строго по возрастанию
+	Bounds []float64 `json:"bounds"`
+	// Counts - количество наблюдений в каждой корзине (не накопительное), len(Counts) == len(Bounds)+1
+	Counts []uint64 `json:"counts"`
+	// Sum - сумма всех наблюдений
+	Sum float64 `json:"sum"`
+	// Count - общее количество наблюдений
+	Count uint64 `json:"count"`
+}
+
+// NewHistogramValue создает пустую гистограмму с заданными границами корзин.
+func NewHistogramValue(bounds []float64) (HistogramValue, error) {
+	h := HistogramValue{
+		Bounds: slices.Clone(bounds),
+		Counts: make([]uint64, len(bounds)+1),
+	}
+
+	if err := h.Validate(); err != nil {
+		return HistogramValue{}, err
+	}
+
+	return h, nil
+}
+
+// ParseHistogram разбирает строковое представление гистограммы, полученное через HistogramValue.String.
+func ParseHistogram(value string) (HistogramValue, error) {
+	var h HistogramValue
+	if err := json.Unmarshal([]byte(value), &h); err != nil {
+		return HistogramValue{}, err
+	}
+
+	if err := h.Validate(); err != nil {
+		return HistogramValue{}, err
+	}
+
+	return h, nil
+}
+
+// Validate проверяет согласованность границ и счетчиков корзин.
+func (h *HistogramValue) Validate() error {
+	for i := 1; i < len(h.Bounds); i++ {
+		if !(h.Bounds[i-1] < h.Bounds[i]) {
+			return ErrBadHistogramBounds
+		}
+	}
+
+	if len(h.Counts) != len(h.Bounds)+1 {
+		return ErrBadMetricValue
+	}
+
+	var total uint64
+	for _, c := range h.Counts {
+		total += c
+	}
+	if total != h.Count {
+		return ErrBadMetricValue
+	}
+
+	return nil
+}
+
+// Observe добавляет одно наблюдение в гистограмму.
+func (h *HistogramValue) Observe(v float64) {
+	i, _ := slices.BinarySearch(h.Bounds, v)
+	h.Counts[i]++
+	h.Sum += v
+	h.Count++
+}
+
+// ObserveN добавляет в гистограмму n одинаковых наблюдений v.
+func (h *HistogramValue) ObserveN(v float64, n uint64) {
+	i, _ := slices.BinarySearch(h.Bounds, v)
+	h.Counts[i] += n
+	h.Sum += v * float64(n)
+	h.Count += n
+}
+
+// Add прибавляет к гистограмме наблюдения другой гистограммы с такими же границами корзин.
+func (h *HistogramValue) Add(other HistogramValue) error {
+	if !slices.Equal(h.Bounds, other.Bounds) {
+		return ErrHistogramBoundsMismatch
+	}
+
+	for i, c := range other.Counts {
+		h.Counts[i] += c
+	}
+	h.Sum += other.Sum
+	h.Count += other.Count
+
+	return nil
+}
+
+// Quantile оценивает квантиль q (0 <= q <= 1) линейной интерполяцией внутри корзины,
+// аналогично histogram_quantile в Prometheus. Для пустой гистограммы возвращает NaN.
+func (h *HistogramValue) Quantile(q float64) float64 {
+	if h.Count == 0 || q < 0 || q > 1 {
+		return math.NaN()
+	}
+
+	rank := q * float64(h.Count)
+	var cumulative uint64
+	for i, c := range h.Counts {
+		if float64(cumulative+c) < rank || c == 0 {
+			cumulative += c
+			continue
+		}
+
+		// Наблюдения попали в корзину +Inf - возвращаем наибольшую известную границу
+		if i == len(h.Bounds) {
+			if i == 0 {
+				return math.NaN()
+			}
+			return h.Bounds[i-1]
+		}
+
+		lower := 0.0
+		if i > 0 {
+			lower = h.Bounds[i-1]
+		}
+		upper := h.Bounds[i]
+
+		return lower + (upper-lower)*(rank-float64(cumulative))/float64(c)
+	}
+
+	return h.Bounds[len(h.Bounds)-1]
+}
+
+// Clone возвращает глубокую копию гистограммы.
+func (h *HistogramValue) Clone() HistogramValue {
+	return HistogramValue{
+		Bounds: slices.Clone(h.Bounds),
+		Counts: slices.Clone(h.Counts),
+		Sum:    h.Sum,
+		Count:  h.Count,
+	}
+}
+
+// String возвращает строковое представление гистограммы, пригодное для ParseHistogram.
+func (h HistogramValue) String() string {
+	out, err := json.Marshal(h)
+	if err != nil {
+		return ""
+	}
+
+	return string(out)
+}
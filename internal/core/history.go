@@ -0,0 +1,70 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+var (
+	ErrHistoryNotSupported = errors.New("history is not supported by storage")
+	ErrTooManySamples      = errors.New("too many samples in range")
+)
+
+// Sample - значение метрики, принятое хранилищем в момент Timestamp.
+// Для counter это накопленное значение после применения записи.
+type Sample struct {
+	Timestamp time.Time `json:"timestamp"`
+	Value     float64   `json:"value"`
+}
+
+// HistoryStorage - хранилище, которое помимо последнего значения сохраняет историю записей.
+type HistoryStorage interface {
+	// QueryRange - получение истории значений серии key в интервале [from, to].
+	// При step > 0 на каждый шаг возвращается последнее значение, попавшее в шаг.
+	// При step <= 0 возвращаются все значения; если их больше limit (limit > 0), возвращается ErrTooManySamples.
+	QueryRange(ctx context.Context, key string, metric MetricType, from, to time.Time, step time.Duration, limit int) ([]Sample, error)
+}
+
+// Downsample прореживает отсортированные по времени значения: интервал [from, to] делится на шаги
+// длиной step, и для каждого шага, в который попало хотя бы одно значение, остается последнее из них
+// с временем начала шага. При step <= 0 возвращаются все значения из интервала.
+func Downsample(samples []Sample, from, to time.Time, step time.Duration) []Sample {
+	out := make([]Sample, 0, len(samples))
+
+	inRange := func(s Sample) bool {
+		return !s.Timestamp.Before(from) && !s.Timestamp.After(to)
+	}
+
+	if step <= 0 {
+		for _, s := range samples {
+			if inRange(s) {
+				out = append(out, s)
+			}
+		}
+		return out
+	}
+
+	i := 0
+	for start := from; !start.After(to); start = start.Add(step) {
+		var (
+			end   = start.Add(step)
+			last  Sample
+			found bool
+		)
+
+		for i < len(samples) && samples[i].Timestamp.Before(end) {
+			if inRange(samples[i]) {
+				last = samples[i]
+				found = true
+			}
+			i++
+		}
+
+		if found {
+			out = append(out, Sample{Timestamp: start, Value: last.Value})
+		}
+	}
+
+	return out
+}
@@ -0,0 +1,157 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+var ErrDuplicateBatch = errors.New("batch already applied")
+
+const (
+	// DefaultAppliedBatchesWindow - количество последних пачек каждого агента, которые помнит хранилище
+	DefaultAppliedBatchesWindow = 1024
+	// DefaultAppliedBatchesTTL - время, после которого хранилище забывает агента без новых пачек
+	DefaultAppliedBatchesTTL = 24 * time.Hour
+)
+
+// BatchID - идентификатор пачки метрик, которым агент помечает отправку.
+// Повторная отправка пачки (например, после таймаута) идет с тем же идентификатором,
+// поэтому хранилище может отличить повтор от новых данных и не учесть приращения счетчиков дважды.
+type BatchID struct {
+	// AgentID - идентификатор агента
+	AgentID string
+	// Key - ключ идемпотентности, уникальный в пределах агента
+	Key string
+	// Seq - порядковый номер пачки агента, растет и между перезапусками агента с одним AgentID.
+	// Нулевой номер - пачка без номера.
+	Seq uint64
+}
+
+// IsZero возвращает true, если пачка не помечена идентификатором.
+func (id BatchID) IsZero() bool {
+	return id.AgentID == "" || id.Key == ""
+}
+
+// IdempotentStorage - хранилище, которое применяет пачку с одним BatchID не более одного раза.
+type IdempotentStorage interface {
+	// SetBatchOnce - запись пачки метрик, если пачка id еще не применялась.
+	// Для уже примененной пачки возвращает ErrDuplicateBatch и не изменяет метрики.
+	SetBatchOnce(ctx context.Context, id BatchID, batch BaseMetricStorage) error
+}
+
+// SetBatchOnce записывает пачку через IdempotentStorage, если пачка помечена идентификатором
+// и хранилище поддерживает проверку повторов, иначе - обычным SetBatch.
+func SetBatchOnce(ctx context.Context, s Storage, id BatchID, batch BaseMetricStorage) error {
+	if is, ok := s.(IdempotentStorage); ok && !id.IsZero() {
+		return is.SetBatchOnce(ctx, id, batch)
+	}
+
+	return s.SetBatch(ctx, batch)
+}
+
+// AppliedBatches - окно недавно примененных пачек: для каждого агента хранятся ключи
+// последних size пачек и наибольший примененный порядковый номер. Пачка с номером, отстающим
+// от наибольшего на size и больше, считается устаревшим повтором: ее ключ уже мог быть вытеснен из окна.
+// Агенты без пачек дольше ttl забываются. Используется хранилищами без собственного журнала примененных пачек.
+type AppliedBatches struct {
+	mu     *sync.Mutex
+	size   int
+	ttl    time.Duration
+	agents map[string]*appliedWindow
+	swept  time.Time
+	now    func() time.Time
+}
+
+type appliedWindow struct {
+	keys   map[string]struct{}
+	order  []string
+	next   int
+	maxSeq uint64
+	seen   time.Time
+}
+
+// NewAppliedBatches - конструктор AppliedBatches, size <= 0 - DefaultAppliedBatchesWindow,
+// ttl <= 0 - DefaultAppliedBatchesTTL.
+func NewAppliedBatches(size int, ttl time.Duration) *AppliedBatches {
+	if size <= 0 {
+		size = DefaultAppliedBatchesWindow
+	}
+	if ttl <= 0 {
+		ttl = DefaultAppliedBatchesTTL
+	}
+
+	return &AppliedBatches{
+		mu:     &sync.Mutex{},
+		size:   size,
+		ttl:    ttl,
+		agents: make(map[string]*appliedWindow),
+		swept:  time.Now(),
+		now:    time.Now,
+	}
+}
+
+// Seen возвращает true, если пачка id уже была отмечена через Add или устарела (см. StaleSeq).
+func (a *AppliedBatches) Seen(id BatchID) bool {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	w, ok := a.agents[id.AgentID]
+	if !ok {
+		return false
+	}
+
+	if StaleSeq(id.Seq, w.maxSeq, a.size) {
+		return true
+	}
+
+	_, ok = w.keys[id.Key]
+	return ok
+}
+
+// Add отмечает пачку id как примененную, вытесняя самую старую пачку агента при заполнении окна.
+func (a *AppliedBatches) Add(id BatchID) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	now := a.now()
+	if now.Sub(a.swept) >= a.ttl {
+		for agent, w := range a.agents {
+			if now.Sub(w.seen) > a.ttl {
+				delete(a.agents, agent)
+			}
+		}
+		a.swept = now
+	}
+
+	w, ok := a.agents[id.AgentID]
+	if !ok {
+		w = &appliedWindow{
+			keys:  make(map[string]struct{}, a.size),
+			order: make([]string, 0, a.size),
+		}
+		a.agents[id.AgentID] = w
+	}
+	w.seen = now
+	w.maxSeq = max(w.maxSeq, id.Seq)
+
+	if _, ok := w.keys[id.Key]; ok {
+		return
+	}
+
+	if len(w.order) < a.size {
+		w.order = append(w.order, id.Key)
+	} else {
+		delete(w.keys, w.order[w.next])
+		w.order[w.next] = id.Key
+		w.next = (w.next + 1) % a.size
+	}
+	w.keys[id.Key] = struct{}{}
+}
+
+// StaleSeq сообщает, отстает ли номер пачки seq от наибольшего примененного номера агента maxSeq
+// на window и больше. Нулевой номер означает, что агент не нумерует пачки.
+func StaleSeq(seq, maxSeq uint64, window int) bool {
+	return seq > 0 && maxSeq >= uint64(window) && seq <= maxSeq-uint64(window)
+}
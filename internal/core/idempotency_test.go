@@ -0,0 +1,38 @@
+package core
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAppliedBatches(t *testing.T) {
+	t.Run("Key window and stale seq", func(t *testing.T) {
+		a := NewAppliedBatches(2, time.Hour)
+
+		for seq := uint64(1); seq <= 3; seq++ {
+			a.Add(BatchID{AgentID: "agent", Key: string(rune('a' + seq - 1)), Seq: seq})
+		}
+
+		assert.True(t, a.Seen(BatchID{AgentID: "agent", Key: "c", Seq: 3}))
+		assert.False(t, a.Seen(BatchID{AgentID: "agent", Key: "d", Seq: 2}), "late batch inside window is applied")
+		// Ключ "a" вытеснен из окна, но номер отстает на размер окна
+		assert.True(t, a.Seen(BatchID{AgentID: "agent", Key: "a", Seq: 1}))
+		assert.False(t, a.Seen(BatchID{AgentID: "agent", Key: "a"}), "batch without seq is checked by key only")
+		assert.False(t, a.Seen(BatchID{AgentID: "other", Key: "a", Seq: 1}))
+	})
+
+	t.Run("Idle agents are evicted", func(t *testing.T) {
+		a := NewAppliedBatches(2, time.Hour)
+		now := time.Now()
+		a.now = func() time.Time { return now }
+
+		a.Add(BatchID{AgentID: "idle", Key: "a", Seq: 1})
+		now = now.Add(2 * time.Hour)
+		a.Add(BatchID{AgentID: "active", Key: "a", Seq: 1})
+
+		assert.NotContains(t, a.agents, "idle")
+		assert.True(t, a.Seen(BatchID{AgentID: "active", Key: "a", Seq: 1}))
+	})
+}
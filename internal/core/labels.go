@@ -0,0 +1,160 @@
+package core
+
+import (
+	"errors"
+	"maps"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+var (
+	ErrBadMetricKey = errors.New("bad metric key")
+	ErrBadLabelName = errors.New("bad label name")
+)
+
+// Labels - набор меток (измерений) метрики, например host, service или region.
+// Набор меток входит в идентичность метрики: метрики с одинаковым именем,
+// но разными метками хранятся независимо.
+type Labels map[string]string
+
+// Validate проверяет, что имена меток непустые и состоят из латинских букв, цифр и '_'.
+func (l Labels) Validate() error {
+	for name := range l {
+		if !isLabelName(name) {
+			return ErrBadLabelName
+		}
+	}
+
+	return nil
+}
+
+// Merge возвращает новый набор меток, в котором метки other перекрывают метки l.
+func (l Labels) Merge(other Labels) Labels {
+	if len(l) == 0 && len(other) == 0 {
+		return nil
+	}
+
+	out := make(Labels, len(l)+len(other))
+	maps.Copy(out, l)
+	maps.Copy(out, other)
+
+	return out
+}
+
+// String возвращает каноническое представление меток вида {a="1",b="2"} с сортировкой по имени.
+// Для пустого набора возвращается пустая строка.
+func (l Labels) String() string {
+	if len(l) == 0 {
+		return ""
+	}
+
+	names := make([]string, 0, len(l))
+	for name := range l {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+
+	var b strings.Builder
+	b.WriteByte('{')
+	for i, name := range names {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		b.WriteString(name)
+		b.WriteByte('=')
+		b.WriteString(strconv.Quote(l[name]))
+	}
+	b.WriteByte('}')
+
+	return b.String()
+}
+
+// MetricKey возвращает идентификатор серии метрики: имя и канонический набор меток,
+// например Alloc{host="a",region="eu"}. Без меток идентификатор совпадает с именем.
+// Именно этот идентификатор используется как ключ во всех хранилищах.
+func MetricKey(name string, labels Labels) string {
+	return name + labels.String()
+}
+
+// ParseMetricKey разбирает идентификатор серии, построенный MetricKey, на имя и метки.
+func ParseMetricKey(key string) (string, Labels, error) {
+	start := strings.IndexByte(key, '{')
+	if start < 0 {
+		return key, nil, nil
+	}
+
+	if !strings.HasSuffix(key, "}") {
+		return "", nil, ErrBadMetricKey
+	}
+
+	name := key[:start]
+	rest := key[start+1 : len(key)-1]
+	labels := make(Labels)
+
+	for rest != "" {
+		eq := strings.IndexByte(rest, '=')
+		if eq <= 0 {
+			return "", nil, ErrBadMetricKey
+		}
+
+		label := rest[:eq]
+		if !isLabelName(label) {
+			return "", nil, ErrBadLabelName
+		}
+
+		quoted, err := strconv.QuotedPrefix(rest[eq+1:])
+		if err != nil {
+			return "", nil, ErrBadMetricKey
+		}
+
+		value, err := strconv.Unquote(quoted)
+		if err != nil {
+			return "", nil, ErrBadMetricKey
+		}
+		labels[label] = value
+
+		rest = rest[eq+1+len(quoted):]
+		if rest == "" {
+			break
+		}
+		if rest[0] != ',' {
+			return "", nil, ErrBadMetricKey
+		}
+		rest = rest[1:]
+	}
+
+	return name, labels, nil
+}
+
+// SanitizeLabelName заменяет недопустимые в имени метки символы на '_', например service.name -> service_name.
+func SanitizeLabelName(name string) string {
+	b := []byte(name)
+	for i, c := range b {
+		switch {
+		case c == '_', c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z':
+		case c >= '0' && c <= '9' && i > 0:
+		default:
+			b[i] = '_'
+		}
+	}
+
+	return string(b)
+}
+
+func isLabelName(name string) bool {
+	if name == "" {
+		return false
+	}
+
+	for i, r := range name {
+		switch {
+		case r == '_', r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z':
+		case r >= '0' && r <= '9' && i > 0:
+		default:
+			return false
+		}
+	}
+
+	return true
+}
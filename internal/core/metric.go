@@ -8,6 +8,8 @@ const (
 	Gauge MetricType = "gauge"
 	// Counter - значение, которое при установке накапливает свое значение
 	Counter MetricType = "counter"
+	// Histogram - распределение наблюдений по корзинам, при установке наблюдения накапливаются
+	Histogram MetricType = "histogram"
 	// Unknown - Неизвестный тип метрики.
 	Unknown MetricType = "unknown"
 )
@@ -18,6 +20,8 @@ func NewMetricType(str string) MetricType {
 		return Gauge
 	case "counter":
 		return Counter
+	case "histogram":
+		return Histogram
 	default:
 		return Unknown
 	}
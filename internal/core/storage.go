@@ -15,6 +15,8 @@ var (
 )
 
 // Storage - интерфейс хранилища метрик.
+// Параметр key во всех методах - идентификатор серии, построенный MetricKey из имени и меток метрики,
+// поэтому метрики с одинаковым именем и разными метками хранятся независимо.
 type Storage interface {
 	io.Closer
 	// Set - запись метрики в хранилище.
@@ -30,21 +32,28 @@ type Storage interface {
 }
 
 type BaseMetricStorage struct {
-	gauges   map[string]float64
-	counters map[string]int64
+	gauges     map[string]float64
+	counters   map[string]int64
+	histograms map[string]HistogramValue
 }
 
 func NewBaseMetricStorage() BaseMetricStorage {
 	return BaseMetricStorage{
-		gauges:   make(map[string]float64),
-		counters: make(map[string]int64),
+		gauges:     make(map[string]float64),
+		counters:   make(map[string]int64),
+		histograms: make(map[string]HistogramValue),
 	}
 }
 
-func NewBaseMetricStorageWithValues(gauges map[string]float64, counters map[string]int64) BaseMetricStorage {
+func NewBaseMetricStorageWithValues(
+	gauges map[string]float64,
+	counters map[string]int64,
+	histograms map[string]HistogramValue,
+) BaseMetricStorage {
 	return BaseMetricStorage{
-		gauges:   gauges,
-		counters: counters,
+		gauges:     gauges,
+		counters:   counters,
+		histograms: histograms,
 	}
 }
 
@@ -59,9 +68,15 @@ func CloneBaseMetricStorage(storage *BaseMetricStorage) BaseMetricStorage {
 		countersCopy[k] = v
 	}
 
+	histogramsCopy := make(map[string]HistogramValue)
+	for k, v := range storage.Histograms() {
+		histogramsCopy[k] = v.Clone()
+	}
+
 	return BaseMetricStorage{
-		gauges:   gaugesCopy,
-		counters: countersCopy,
+		gauges:     gaugesCopy,
+		counters:   countersCopy,
+		histograms: histogramsCopy,
 	}
 }
 
@@ -73,6 +88,10 @@ func (bs *BaseMetricStorage) Counters() map[string]int64 {
 	return bs.counters
 }
 
+func (bs *BaseMetricStorage) Histograms() map[string]HistogramValue {
+	return bs.histograms
+}
+
 func (bs *BaseMetricStorage) GetCounter(key string) (int64, bool) {
 	c, ok := bs.Counters()[key]
 	return c, ok
@@ -95,24 +114,63 @@ func (bs *BaseMetricStorage) SetCounter(key string, delta int64) {
 	bs.counters[key] += delta
 }
 
-// Sync синхронизирует данные двух хранилищ.
-func Sync(ctx context.Context, source Storage, target Storage) error {
-	main, err := source.GetAll(ctx)
-	if err != nil {
-		return err
+func (bs *BaseMetricStorage) GetHistogram(key string) (HistogramValue, bool) {
+	h, ok := bs.Histograms()[key]
+	return h, ok
+}
+
+// SetHistogram добавляет наблюдения value к гистограмме key.
+// Если границы корзин изменились, гистограмма начинается заново с value.
+func (bs *BaseMetricStorage) SetHistogram(key string, value HistogramValue) {
+	current, ok := bs.histograms[key]
+	if ok && current.Add(value) == nil {
+		bs.histograms[key] = current
+		return
+	}
+
+	bs.histograms[key] = value.Clone()
+}
+
+// ValuesSetter - хранилище, которое записывает значения нескольких метрик одной операцией.
+// В отличие от SetBatch, значения counter и histogram заменяют текущие, а не добавляются к ним.
+type ValuesSetter interface {
+	SetValues(ctx context.Context, values BaseMetricStorage) error
+}
+
+// SetValues записывает значения метрик в target как есть, аналогично Set для каждой метрики.
+// Если target реализует ValuesSetter, запись выполняется одной операцией.
+func SetValues(ctx context.Context, target Storage, values BaseMetricStorage) error {
+	if s, ok := target.(ValuesSetter); ok {
+		return s.SetValues(ctx, values)
 	}
 
-	for k, v := range main.Gauges() {
+	for k, v := range values.Gauges() {
 		if err := target.Set(ctx, k, utils.GaugeAsString(v), Gauge); err != nil {
 			return err
 		}
 	}
 
-	for k, v := range main.Counters() {
+	for k, v := range values.Counters() {
 		if err := target.Set(ctx, k, utils.CounterAsString(v), Counter); err != nil {
 			return err
 		}
 	}
 
+	for k, v := range values.Histograms() {
+		if err := target.Set(ctx, k, v.String(), Histogram); err != nil {
+			return err
+		}
+	}
+
 	return nil
 }
+
+// Sync синхронизирует данные двух хранилищ.
+func Sync(ctx context.Context, source Storage, target Storage) error {
+	main, err := source.GetAll(ctx)
+	if err != nil {
+		return err
+	}
+
+	return SetValues(ctx, target, main)
+}
@@ -8,10 +8,17 @@ import (
 )
 
 type Metrics struct {
-	Value *float64 `json:"value,omitempty"` // значение метрики в случае передачи gauge
-	Delta *int64   `json:"delta,omitempty"` // значение метрики в случае передачи counter
-	ID    string   `json:"id"`              // имя метрики
-	MType string   `json:"type"`            // параметр, принимающий значение gauge или counter
+	Value     *float64             `json:"value,omitempty"`     // значение метрики в случае передачи gauge
+	Delta     *int64               `json:"delta,omitempty"`     // значение метрики в случае передачи counter
+	Histogram *core.HistogramValue `json:"histogram,omitempty"` // значение метрики в случае передачи histogram
+	Labels    core.Labels          `json:"labels,omitempty"`    // метки метрики, входят в ее идентичность
+	ID        string               `json:"id"`                  // имя метрики
+	MType     string               `json:"type"`                // параметр, принимающий значение gauge, counter или histogram
+}
+
+// Key возвращает идентификатор серии метрики с учетом меток, под которым она хранится в core.Storage.
+func (m *Metrics) Key() string {
+	return core.MetricKey(m.ID, m.Labels)
 }
 
 func FromMetricModel(m polling.MetricsModel) (*Metrics, error) {
@@ -21,6 +28,7 @@ func FromMetricModel(m polling.MetricsModel) (*Metrics, error) {
 	)
 
 	metric.ID = m.Key
+	metric.Labels = m.Labels
 	metric.MType = string(m.Type)
 
 	switch m.Type {
@@ -36,9 +44,143 @@ func FromMetricModel(m polling.MetricsModel) (*Metrics, error) {
 			return nil, core.ErrBadMetricValue
 		}
 		metric.Value = &value
+	case core.Histogram:
+		var histogram core.HistogramValue
+		if histogram, err = core.ParseHistogram(m.Value); err != nil {
+			return nil, core.ErrBadMetricValue
+		}
+		metric.Histogram = &histogram
 	default:
 		return nil, core.ErrUnknownMetricType
 	}
 
 	return &metric, nil
 }
+
+// ToMetricModel преобразует метрику формата JSON API в модель агента, обратно FromMetricModel.
+func ToMetricModel(m Metrics) (polling.MetricsModel, error) {
+	model := polling.MetricsModel{
+		Key:    m.ID,
+		Labels: m.Labels,
+		Type:   core.NewMetricType(m.MType),
+	}
+
+	switch model.Type {
+	case core.Counter:
+		if m.Delta == nil {
+			return model, core.ErrBadMetricValue
+		}
+		model.Value = utils.CounterAsString(*m.Delta)
+	case core.Gauge:
+		if m.Value == nil {
+			return model, core.ErrBadMetricValue
+		}
+		model.Value = utils.GaugeAsString(*m.Value)
+	case core.Histogram:
+		if m.Histogram == nil || m.Histogram.Validate() != nil {
+			return model, core.ErrBadMetricValue
+		}
+		model.Value = m.Histogram.String()
+	default:
+		return model, core.ErrUnknownMetricType
+	}
+
+	return model, nil
+}
+
+// ToBatch собирает пачку метрик для core.Storage.SetBatch.
+// Значения counter и histogram с одинаковым идентификатором серии суммируются, для gauge остается последнее.
+func ToBatch(ms []Metrics) (core.BaseMetricStorage, error) {
+	batch := core.NewBaseMetricStorage()
+
+	for _, m := range ms {
+		if err := m.Labels.Validate(); err != nil {
+			return batch, err
+		}
+
+		switch core.NewMetricType(m.MType) {
+		case core.Gauge:
+			if m.Value == nil {
+				return batch, core.ErrBadMetricValue
+			}
+			batch.SetGauge(m.Key(), *m.Value)
+		case core.Counter:
+			if m.Delta == nil {
+				return batch, core.ErrBadMetricValue
+			}
+			batch.SetCounter(m.Key(), *m.Delta)
+		case core.Histogram:
+			if m.Histogram == nil || m.Histogram.Validate() != nil {
+				return batch, core.ErrBadMetricValue
+			}
+			batch.SetHistogram(m.Key(), *m.Histogram)
+		default:
+			return batch, core.ErrUnknownMetricType
+		}
+	}
+
+	return batch, nil
+}
+
+// SetValueFromString заполняет значение метрики из строкового представления, которое возвращает core.Storage.Get.
+func SetValueFromString(m *Metrics, value string) error {
+	switch core.NewMetricType(m.MType) {
+	case core.Gauge:
+		v, err := utils.GaugeFromString(value)
+		if err != nil {
+			return core.ErrBadMetricValue
+		}
+		m.Value = &v
+	case core.Counter:
+		v, err := utils.CounterFromString(value)
+		if err != nil {
+			return core.ErrBadMetricValue
+		}
+		m.Delta = &v
+	case core.Histogram:
+		v, err := core.ParseHistogram(value)
+		if err != nil {
+			return core.ErrBadMetricValue
+		}
+		m.Histogram = &v
+	default:
+		return core.ErrUnknownMetricType
+	}
+
+	return nil
+}
+
+// FromBaseStorage преобразует все метрики хранилища в список метрик формата JSON API.
+// Идентификаторы серий разбираются обратно на имя и метки.
+func FromBaseStorage(s *core.BaseMetricStorage) []Metrics {
+	out := make([]Metrics, 0, len(s.Gauges())+len(s.Counters())+len(s.Histograms()))
+
+	metric := func(key string, mType core.MetricType) Metrics {
+		name, labels, err := core.ParseMetricKey(key)
+		if err != nil {
+			name, labels = key, nil
+		}
+
+		return Metrics{ID: name, Labels: labels, MType: string(mType)}
+	}
+
+	for k, v := range s.Gauges() {
+		m := metric(k, core.Gauge)
+		m.Value = &v
+		out = append(out, m)
+	}
+
+	for k, v := range s.Counters() {
+		m := metric(k, core.Counter)
+		m.Delta = &v
+		out = append(out, m)
+	}
+
+	for k, v := range s.Histograms() {
+		m := metric(k, core.Histogram)
+		m.Histogram = &v
+		out = append(out, m)
+	}
+
+	return out
+}
@@ -0,0 +1,247 @@
+package polling
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"maps"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/smartfor/metrics/internal/core"
+)
+
+// Коллектор cgroup читает ресурсы контейнера из cgroup v2. Без параметров опрашивается
+// собственная cgroup агента, метрики отмечаются меткой cgroup с путем относительно корня:
+//
+//	CgroupMemoryCurrent, CgroupMemoryMax            - memory.current, memory.max (без лимита не отправляется)
+//	CgroupCPUUsageUsec, CgroupCPUUserUsec,
+//	CgroupCPUSystemUsec                             - counter из cpu.stat
+//	CgroupCPUPeriods, CgroupCPUThrottledPeriods,
+//	CgroupCPUThrottledUsec                          - counter троттлинга из cpu.stat
+//	CgroupIOReadBytes, CgroupIOWriteBytes,
+//	CgroupIOReadOps, CgroupIOWriteOps               - counter из io.stat с меткой device (major:minor)
+//	CgroupPidsCurrent, CgroupPidsMax                - pids.current, pids.max (без лимита не отправляется)
+//
+// Файлы выключенных контроллеров пропускаются. Недоступная cgroup (например, остановленный сервис)
+// пропускается с записью в лог, метрики остальных cgroup отправляются.
+//
+// Пример параметров:
+//
+//	{"root": "/sys/fs/cgroup", "paths": ["/system.slice/nginx.service"]}
+
+// procSelfCgroup - файл с cgroup текущего процесса
+var procSelfCgroup = "/proc/self/cgroup"
+
+var ErrNoCgroupV2 = errors.New("cgroup v2 entry not found")
+
+const defaultCgroupRoot = "/sys/fs/cgroup"
+
+type cgroupOptions struct {
+	// Root - точка монтирования cgroup2
+	Root string `json:"root"`
+	// Paths - cgroup относительно Root. Пустой список - cgroup агента.
+	Paths []string `json:"paths"`
+}
+
+// cpu.stat: ключ файла -> имя метрики
+var cgroupCPUStat = map[string]string{
+	"usage_usec":     "CgroupCPUUsageUsec",
+	"user_usec":      "CgroupCPUUserUsec",
+	"system_usec":    "CgroupCPUSystemUsec",
+	"nr_periods":     "CgroupCPUPeriods",
+	"nr_throttled":   "CgroupCPUThrottledPeriods",
+	"throttled_usec": "CgroupCPUThrottledUsec",
+}
+
+// io.stat: ключ файла -> имя метрики
+var cgroupIOStat = map[string]string{
+	"rbytes": "CgroupIOReadBytes",
+	"wbytes": "CgroupIOWriteBytes",
+	"rios":   "CgroupIOReadOps",
+	"wios":   "CgroupIOWriteOps",
+}
+
+type cgroupCollector struct {
+	options cgroupOptions
+	tracker *core.CounterTracker
+}
+
+func newCgroupCollector(s Settings) (Collector, error) {
+	c := &cgroupCollector{
+		options: cgroupOptions{Root: defaultCgroupRoot},
+		tracker: core.NewCounterTracker(),
+	}
+	if err := s.DecodeOptions(&c.options); err != nil {
+		return nil, err
+	}
+
+	return NewFuncCollector("cgroup", s.Interval, c.collect), nil
+}
+
+func (c *cgroupCollector) collect(context.Context) (MetricStore, error) {
+	paths := c.options.Paths
+	if len(paths) == 0 {
+		self, err := selfCgroup(procSelfCgroup)
+		if err != nil {
+			return nil, err
+		}
+		paths = []string{self}
+	}
+
+	var (
+		store  = make(MetricStore)
+		failed []error
+	)
+	for _, p := range paths {
+		cgroup := path.Clean("/" + p)
+		cgroupStore := make(MetricStore)
+		if err := c.collectCgroup(cgroupStore, cgroup); err != nil {
+			err = fmt.Errorf("cgroup %s: %w", cgroup, err)
+			log.Printf("Cgroup collector: %v", err)
+			failed = append(failed, err)
+			continue
+		}
+		maps.Copy(store, cgroupStore)
+	}
+
+	if len(failed) == len(paths) {
+		return nil, errors.Join(failed...)
+	}
+
+	return store, nil
+}
+
+func (c *cgroupCollector) collectCgroup(store MetricStore, cgroup string) error {
+	dir := filepath.Join(c.options.Root, filepath.FromSlash(cgroup))
+	if _, err := os.Stat(dir); err != nil {
+		return err
+	}
+
+	labels := core.Labels{"cgroup": cgroup}
+
+	if v, ok, err := readCgroupValue(filepath.Join(dir, "memory.current")); err != nil {
+		return err
+	} else if ok {
+		store.Add(gauge("CgroupMemoryCurrent", labels, float64(v)))
+	}
+	if v, ok, err := readCgroupValue(filepath.Join(dir, "memory.max")); err != nil {
+		return err
+	} else if ok {
+		store.Add(gauge("CgroupMemoryMax", labels, float64(v)))
+	}
+
+	if v, ok, err := readCgroupValue(filepath.Join(dir, "pids.current")); err != nil {
+		return err
+	} else if ok {
+		store.Add(gauge("CgroupPidsCurrent", labels, float64(v)))
+	}
+	if v, ok, err := readCgroupValue(filepath.Join(dir, "pids.max")); err != nil {
+		return err
+	} else if ok {
+		store.Add(gauge("CgroupPidsMax", labels, float64(v)))
+	}
+
+	if err := readCgroupLines(filepath.Join(dir, "cpu.stat"), func(fields []string) {
+		if len(fields) != 2 {
+			return
+		}
+		name, ok := cgroupCPUStat[fields[0]]
+		if !ok {
+			return
+		}
+		if v, err := strconv.ParseUint(fields[1], 10, 64); err == nil {
+			store.addCounter(c.tracker, name, labels, v)
+		}
+	}); err != nil {
+		return err
+	}
+
+	return readCgroupLines(filepath.Join(dir, "io.stat"), func(fields []string) {
+		if len(fields) < 2 {
+			return
+		}
+
+		deviceLabels := labels.Merge(core.Labels{"device": fields[0]})
+		for _, field := range fields[1:] {
+			key, value, ok := strings.Cut(field, "=")
+			if !ok {
+				continue
+			}
+			name, ok := cgroupIOStat[key]
+			if !ok {
+				continue
+			}
+			if v, err := strconv.ParseUint(value, 10, 64); err == nil {
+				store.addCounter(c.tracker, name, deviceLabels, v)
+			}
+		}
+	})
+}
+
+// selfCgroup возвращает cgroup v2 процесса из строки "0::<путь>" файла /proc/<pid>/cgroup.
+func selfCgroup(file string) (string, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return "", err
+	}
+
+	for _, line := range strings.Split(string(data), "\n") {
+		if p, ok := strings.CutPrefix(line, "0::"); ok {
+			return p, nil
+		}
+	}
+
+	return "", ErrNoCgroupV2
+}
+
+// readCgroupValue читает файл с одним числом. ok=false, если файла нет или лимит не задан ("max").
+func readCgroupValue(file string) (value uint64, ok bool, err error) {
+	data, err := os.ReadFile(file)
+	if errors.Is(err, os.ErrNotExist) {
+		return 0, false, nil
+	}
+	if err != nil {
+		return 0, false, err
+	}
+
+	s := strings.TrimSpace(string(data))
+	if s == "max" {
+		return 0, false, nil
+	}
+
+	value, err = strconv.ParseUint(s, 10, 64)
+	if err != nil {
+		return 0, false, fmt.Errorf("%s: %w", file, err)
+	}
+
+	return value, true, nil
+}
+
+// readCgroupLines вызывает fn для полей каждой строки файла. Отсутствующий файл пропускается.
+func readCgroupLines(file string, fn func(fields []string)) error {
+	f, err := os.Open(file)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fn(strings.Fields(scanner.Text()))
+	}
+
+	return scanner.Err()
+}
+
+func init() {
+	MustRegister("cgroup", newCgroupCollector)
+}
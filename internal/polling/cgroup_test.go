@@ -0,0 +1,109 @@
+package polling
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func writeCgroupFiles(t *testing.T, dir string, files map[string]string) {
+	require.NoError(t, os.MkdirAll(dir, 0o755))
+	for name, content := range files {
+		require.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte(content), 0o600))
+	}
+}
+
+func TestCgroupCollector(t *testing.T) {
+	root := t.TempDir()
+	dir := filepath.Join(root, "system.slice", "app.service")
+
+	writeCgroupFiles(t, dir, map[string]string{
+		"memory.current": "1048576\n",
+		"memory.max":     "max\n",
+		"pids.current":   "7\n",
+		"pids.max":       "100\n",
+		"cpu.stat":       "usage_usec 1000\nuser_usec 600\nsystem_usec 400\nnr_periods 10\nnr_throttled 2\nthrottled_usec 50\n",
+		"io.stat":        "8:0 rbytes=4096 wbytes=8192 rios=1 wios=2 dbytes=0 dios=0\n",
+	})
+
+	selfFile := filepath.Join(root, "self-cgroup")
+	require.NoError(t, os.WriteFile(selfFile, []byte("0::/system.slice/app.service\n"), 0o600))
+	prev := procSelfCgroup
+	procSelfCgroup = selfFile
+	t.Cleanup(func() { procSelfCgroup = prev })
+
+	options, err := json.Marshal(cgroupOptions{Root: root})
+	require.NoError(t, err)
+
+	c, err := NewCollector("cgroup", Settings{Interval: time.Second, Options: options})
+	require.NoError(t, err)
+
+	store, err := c.Collect(context.Background())
+	require.NoError(t, err)
+
+	const labels = `{cgroup="/system.slice/app.service"}`
+	assert.Equal(t, "1048576", store["CgroupMemoryCurrent"+labels].Value)
+	assert.NotContains(t, store, "CgroupMemoryMax"+labels, "unlimited memory.max is skipped")
+	assert.Equal(t, "7", store["CgroupPidsCurrent"+labels].Value)
+	assert.Equal(t, "100", store["CgroupPidsMax"+labels].Value)
+	// Первый опрос задает базу накопительных счетчиков
+	assert.Equal(t, "0", store["CgroupCPUUsageUsec"+labels].Value)
+
+	writeCgroupFiles(t, dir, map[string]string{
+		"memory.max": "2097152\n",
+		"cpu.stat":   "usage_usec 1500\nuser_usec 900\nsystem_usec 600\nnr_periods 12\nnr_throttled 3\nthrottled_usec 80\n",
+		"io.stat":    "8:0 rbytes=5096 wbytes=8192 rios=3 wios=2 dbytes=0 dios=0\n",
+	})
+
+	store, err = c.Collect(context.Background())
+	require.NoError(t, err)
+
+	assert.Equal(t, "2097152", store["CgroupMemoryMax"+labels].Value)
+	assert.Equal(t, "500", store["CgroupCPUUsageUsec"+labels].Value)
+	assert.Equal(t, "1", store["CgroupCPUThrottledPeriods"+labels].Value)
+	assert.Equal(t, "30", store["CgroupCPUThrottledUsec"+labels].Value)
+
+	const ioLabels = `{cgroup="/system.slice/app.service",device="8:0"}`
+	assert.Equal(t, "1000", store["CgroupIOReadBytes"+ioLabels].Value)
+	assert.Equal(t, "0", store["CgroupIOWriteBytes"+ioLabels].Value)
+	assert.Equal(t, "2", store["CgroupIOReadOps"+ioLabels].Value)
+}
+
+func TestCgroupCollector_MissingCgroup(t *testing.T) {
+	options, err := json.Marshal(cgroupOptions{Root: t.TempDir(), Paths: []string{"/missing"}})
+	require.NoError(t, err)
+
+	c, err := NewCollector("cgroup", Settings{Interval: time.Second, Options: options})
+	require.NoError(t, err)
+
+	_, err = c.Collect(context.Background())
+	assert.ErrorIs(t, err, os.ErrNotExist)
+}
+
+func TestCgroupCollector_SkipsFailedCgroup(t *testing.T) {
+	root := t.TempDir()
+	writeCgroupFiles(t, filepath.Join(root, "app.service"), map[string]string{"pids.current": "3\n"})
+	// Нечисловое значение - ошибка чтения только этой cgroup
+	writeCgroupFiles(t, filepath.Join(root, "broken.service"), map[string]string{"pids.current": "bad\n"})
+
+	options, err := json.Marshal(cgroupOptions{
+		Root:  root,
+		Paths: []string{"/app.service", "/missing.service", "/broken.service"},
+	})
+	require.NoError(t, err)
+
+	c, err := NewCollector("cgroup", Settings{Interval: time.Second, Options: options})
+	require.NoError(t, err)
+
+	store, err := c.Collect(context.Background())
+	require.NoError(t, err)
+
+	assert.Equal(t, "3", store[`CgroupPidsCurrent{cgroup="/app.service"}`].Value)
+	assert.Len(t, store, 1)
+}
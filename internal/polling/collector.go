@@ -0,0 +1,220 @@
+package polling
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/smartfor/metrics/internal/core"
+)
+
+var (
+	ErrUnknownCollector    = errors.New("unknown collector")
+	ErrCollectorRegistered = errors.New("collector already registered")
+)
+
+// Collector - источник метрик агента. Каждый коллектор опрашивается по своему расписанию,
+// ошибка одного коллектора не мешает отправке метрик остальных.
+type Collector interface {
+	// Name - имя коллектора, под которым он включается в конфигурации агента
+	Name() string
+	// Interval - период опроса коллектора
+	Interval() time.Duration
+	// Collect - сбор метрик. Значения counter - приращения с прошлого вызова Collect.
+	Collect(ctx context.Context) (MetricStore, error)
+}
+
+// Settings - настройки коллектора из конфигурации агента
+type Settings struct {
+	// Interval - период опроса
+	Interval time.Duration
+	// Options - специфичные для коллектора параметры (JSON), разбираются фабрикой коллектора
+	Options json.RawMessage
+}
+
+// DecodeOptions разбирает Options в target. Пустые Options оставляют target без изменений.
+func (s Settings) DecodeOptions(target any) error {
+	if len(s.Options) == 0 {
+		return nil
+	}
+
+	return json.Unmarshal(s.Options, target)
+}
+
+// Factory - конструктор коллектора по его настройкам
+type Factory func(settings Settings) (Collector, error)
+
+var (
+	registryMu = &sync.Mutex{}
+	registry   = make(map[string]Factory)
+)
+
+// Register добавляет фабрику коллектора в реестр. Коллекторы вне этого пакета
+// регистрируются так же, обычно в init() своего пакета.
+func Register(name string, factory Factory) error {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+
+	if _, ok := registry[name]; ok {
+		return fmt.Errorf("%w: %s", ErrCollectorRegistered, name)
+	}
+	registry[name] = factory
+
+	return nil
+}
+
+// MustRegister - Register, паникующий при повторной регистрации имени.
+func MustRegister(name string, factory Factory) {
+	if err := Register(name, factory); err != nil {
+		panic(err)
+	}
+}
+
+// Registered возвращает отсортированные имена зарегистрированных коллекторов.
+func Registered() []string {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+
+	names := make([]string, 0, len(registry))
+	for name := range registry {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+
+	return names
+}
+
+// NewCollector создает зарегистрированный коллектор name.
+func NewCollector(name string, settings Settings) (Collector, error) {
+	registryMu.Lock()
+	factory, ok := registry[name]
+	registryMu.Unlock()
+
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownCollector, name)
+	}
+
+	c, err := factory(settings)
+	if err != nil {
+		return nil, fmt.Errorf("collector %s: %w", name, err)
+	}
+
+	return c, nil
+}
+
+// CreateCollectorChannel опрашивает коллектор c каждые c.Interval() и отправляет результаты в канал.
+// Канал закрывается при отмене ctx.
+func CreateCollectorChannel(ctx context.Context, c Collector) <-chan PollMessage {
+	ch := make(chan PollMessage)
+
+	go func() {
+		defer close(ch)
+
+		ticker := time.NewTicker(c.Interval())
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+
+			case <-ticker.C:
+				m, err := c.Collect(ctx)
+
+				select {
+				case ch <- PollMessage{Msg: m, Err: err, Collector: c.Name()}:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+	}()
+
+	return ch
+}
+
+// Merge добавляет метрики other в хранилище: приращения counter и histogram суммируются,
+// gauge заменяются значениями other. Гистограмма с другими границами заменяет прежнюю.
+func (store MetricStore) Merge(other MetricStore) {
+	for k, v := range other {
+		current, ok := store[k]
+		if !ok || v.Type != current.Type {
+			store[k] = v
+			continue
+		}
+
+		switch v.Type {
+		case core.Counter:
+			store[k] = mergeCounter(current, v)
+		case core.Histogram:
+			store[k] = mergeHistogram(current, v)
+		default:
+			store[k] = v
+		}
+	}
+}
+
+func mergeCounter(current, other MetricsModel) MetricsModel {
+	a, errA := strconv.ParseInt(current.Value, 10, 64)
+	b, errB := strconv.ParseInt(other.Value, 10, 64)
+	if errA != nil || errB != nil {
+		return other
+	}
+
+	current.Value = strconv.FormatInt(a+b, 10)
+	return current
+}
+
+func mergeHistogram(current, other MetricsModel) MetricsModel {
+	a, errA := core.ParseHistogram(current.Value)
+	b, errB := core.ParseHistogram(other.Value)
+	if errA != nil || errB != nil || a.Add(b) != nil {
+		return other
+	}
+
+	current.Value = a.String()
+	return current
+}
+
+// funcCollector - коллектор на основе функции сбора
+type funcCollector struct {
+	name     string
+	interval time.Duration
+	collect  func(ctx context.Context) (MetricStore, error)
+}
+
+func (f *funcCollector) Name() string {
+	return f.name
+}
+
+func (f *funcCollector) Interval() time.Duration {
+	return f.interval
+}
+
+func (f *funcCollector) Collect(ctx context.Context) (MetricStore, error) {
+	return f.collect(ctx)
+}
+
+// NewFuncCollector создает коллектор name, который вызывает collect каждые interval.
+func NewFuncCollector(name string, interval time.Duration, collect func(ctx context.Context) (MetricStore, error)) Collector {
+	return &funcCollector{name: name, interval: interval, collect: collect}
+}
+
+func init() {
+	MustRegister("runtime", func(s Settings) (Collector, error) {
+		return NewFuncCollector("runtime", s.Interval, func(context.Context) (MetricStore, error) {
+			return PollMainMetrics(), nil
+		}), nil
+	})
+
+	MustRegister("system", func(s Settings) (Collector, error) {
+		return NewFuncCollector("system", s.Interval, func(context.Context) (MetricStore, error) {
+			return PollAdvancedMetrics()
+		}), nil
+	})
+}
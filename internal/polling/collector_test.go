@@ -0,0 +1,103 @@
+package polling
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/smartfor/metrics/internal/core"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRegistry(t *testing.T) {
+	assert.Contains(t, Registered(), "runtime")
+	assert.Contains(t, Registered(), "system")
+
+	err := Register("runtime", func(Settings) (Collector, error) { return nil, nil })
+	assert.ErrorIs(t, err, ErrCollectorRegistered)
+
+	_, err = NewCollector("unknown", Settings{Interval: time.Second})
+	assert.ErrorIs(t, err, ErrUnknownCollector)
+
+	c, err := NewCollector("runtime", Settings{Interval: time.Second})
+	require.NoError(t, err)
+	assert.Equal(t, "runtime", c.Name())
+	assert.Equal(t, time.Second, c.Interval())
+}
+
+func TestMetricStore_Merge(t *testing.T) {
+	store := MetricStore{
+		"Requests": {Type: core.Counter, Key: "Requests", Value: "2"},
+		"Load":     {Type: core.Gauge, Key: "Load", Value: "0.5"},
+	}
+
+	store.Merge(MetricStore{
+		"Requests": {Type: core.Counter, Key: "Requests", Value: "3"},
+		"Load":     {Type: core.Gauge, Key: "Load", Value: "0.7"},
+		"Free":     {Type: core.Gauge, Key: "Free", Value: "10"},
+	})
+
+	assert.Equal(t, "5", store["Requests"].Value)
+	assert.Equal(t, "0.7", store["Load"].Value)
+	assert.Equal(t, "10", store["Free"].Value)
+}
+
+func TestMetricStore_MergeHistograms(t *testing.T) {
+	histogram := func(bounds []float64, counts []uint64, sum float64) MetricsModel {
+		var count uint64
+		for _, c := range counts {
+			count += c
+		}
+		h := core.HistogramValue{Bounds: bounds, Counts: counts, Sum: sum, Count: count}
+		return MetricsModel{Type: core.Histogram, Key: "Latency", Value: h.String()}
+	}
+
+	store := MetricStore{"Latency": histogram([]float64{1, 5}, []uint64{1, 0, 0}, 0.5)}
+	store.Merge(MetricStore{"Latency": histogram([]float64{1, 5}, []uint64{0, 2, 1}, 12)})
+
+	merged, err := core.ParseHistogram(store["Latency"].Value)
+	require.NoError(t, err)
+	assert.Equal(t, []uint64{1, 2, 1}, merged.Counts)
+	assert.Equal(t, uint64(4), merged.Count)
+	assert.Equal(t, 12.5, merged.Sum)
+
+	// Гистограмма с другими границами заменяет прежнюю
+	store.Merge(MetricStore{"Latency": histogram([]float64{10}, []uint64{3, 0}, 6)})
+
+	replaced, err := core.ParseHistogram(store["Latency"].Value)
+	require.NoError(t, err)
+	assert.Equal(t, []float64{10}, replaced.Bounds)
+	assert.Equal(t, uint64(3), replaced.Count)
+}
+
+func TestCreateCollectorChannel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	ok := NewFuncCollector("ok", 10*time.Millisecond, func(context.Context) (MetricStore, error) {
+		return MetricStore{"Value": {Type: core.Gauge, Key: "Value", Value: "1"}}, nil
+	})
+	failing := NewFuncCollector("failing", 10*time.Millisecond, func(context.Context) (MetricStore, error) {
+		return nil, errors.New("boom")
+	})
+
+	fanIn := FanInPolling(ctx, CreateCollectorChannel(ctx, failing), CreateCollectorChannel(ctx, ok))
+
+	seen := make(map[string]bool)
+	for len(seen) < 2 {
+		select {
+		case msg := <-fanIn:
+			if msg.Collector == "failing" {
+				assert.Error(t, msg.Err)
+			} else {
+				require.NoError(t, msg.Err)
+				assert.Equal(t, "1", msg.Msg["Value"].Value)
+			}
+			seen[msg.Collector] = true
+		case <-time.After(time.Second):
+			t.Fatal("no messages from collectors")
+		}
+	}
+}
@@ -0,0 +1,250 @@
+package polling
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/smartfor/metrics/internal/core"
+)
+
+// Коллектор exec периодически запускает команды и собирает метрики из их stdout.
+// Вывод - либо строки вида "name type value" (пустые строки и строки с # пропускаются,
+// имя может содержать метки: requests{route="/api"} counter 5), либо JSON-массив метрик
+// формата JSON API (поля id, type, value, delta, histogram, labels). Формат определяется по первому символу вывода.
+// Значения counter - приращения с прошлого запуска команды.
+//
+// Пример параметров:
+//
+//	{"commands": [
+//	  {"command": ["/usr/local/bin/orders.sh"], "timeout": "5s"},
+//	  {"command": ["sh", "-c", "echo queue_size gauge $(wc -l < /var/spool/queue)"]}
+//	]}
+
+var (
+	ErrEmptyCommand   = errors.New("empty command")
+	ErrBadScriptLine  = errors.New("bad script output line")
+	ErrCommandTimeout = errors.New("command timed out")
+)
+
+// defaultExecTimeout - таймаут команды, если он не задан и период опроса больше
+const defaultExecTimeout = 10 * time.Second
+
+// ExecCommand - команда коллектора exec
+type ExecCommand struct {
+	// Command - исполняемый файл и аргументы, запускается без оболочки
+	Command []string `json:"command"`
+	// Timeout - время на выполнение команды, по умолчанию меньшее из 10s и периода опроса
+	Timeout string `json:"timeout,omitempty"`
+
+	timeout time.Duration
+}
+
+type execOptions struct {
+	Commands []ExecCommand `json:"commands"`
+}
+
+// scriptMetric - метрика JSON-вывода команды, поля совпадают с форматом JSON API сервера
+type scriptMetric struct {
+	Value     *float64             `json:"value,omitempty"`
+	Delta     *int64               `json:"delta,omitempty"`
+	Histogram *core.HistogramValue `json:"histogram,omitempty"`
+	Labels    core.Labels          `json:"labels,omitempty"`
+	ID        string               `json:"id"`
+	MType     string               `json:"type"`
+}
+
+// model преобразует метрику в модель агента.
+func (m scriptMetric) model() (MetricsModel, error) {
+	model := MetricsModel{Key: m.ID, Labels: m.Labels, Type: core.NewMetricType(m.MType)}
+
+	switch model.Type {
+	case core.Counter:
+		if m.Delta == nil {
+			return model, core.ErrBadMetricValue
+		}
+		model.Value = strconv.FormatInt(*m.Delta, 10)
+	case core.Gauge:
+		if m.Value == nil {
+			return model, core.ErrBadMetricValue
+		}
+		model.Value = strconv.FormatFloat(*m.Value, 'f', -1, 64)
+	case core.Histogram:
+		if m.Histogram == nil || m.Histogram.Validate() != nil {
+			return model, core.ErrBadMetricValue
+		}
+		model.Value = m.Histogram.String()
+	default:
+		return model, core.ErrUnknownMetricType
+	}
+
+	return model, nil
+}
+
+type execCollector struct {
+	commands []ExecCommand
+}
+
+func newExecCollector(s Settings) (Collector, error) {
+	var opts execOptions
+	if err := s.DecodeOptions(&opts); err != nil {
+		return nil, err
+	}
+
+	for i := range opts.Commands {
+		c := &opts.Commands[i]
+		if len(c.Command) == 0 || c.Command[0] == "" {
+			return nil, ErrEmptyCommand
+		}
+
+		c.timeout = min(defaultExecTimeout, s.Interval)
+		if c.Timeout != "" {
+			timeout, err := time.ParseDuration(c.Timeout)
+			if err != nil {
+				return nil, fmt.Errorf("command %s: error parsing timeout: %w", c.Command[0], err)
+			}
+			c.timeout = timeout
+		}
+	}
+
+	collector := &execCollector{commands: opts.Commands}
+	return NewFuncCollector("exec", s.Interval, collector.collect), nil
+}
+
+// collect запускает команды по очереди. Ошибка одной команды записывается в лог
+// и не мешает отправке метрик остальных.
+func (e *execCollector) collect(ctx context.Context) (MetricStore, error) {
+	store := make(MetricStore)
+
+	for _, c := range e.commands {
+		out, err := runCommand(ctx, c)
+		if err == nil {
+			err = ParseScriptOutput(out, store)
+		}
+		if err != nil {
+			log.Printf("Exec collector: %s: %v", c.Command[0], err)
+		}
+	}
+
+	return store, nil
+}
+
+func runCommand(ctx context.Context, c ExecCommand) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+
+	var stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, c.Command[0], c.Command[1:]...)
+	cmd.Stderr = &stderr
+	// Не ждать дочерние процессы, унаследовавшие stdout, дольше таймаута
+	cmd.WaitDelay = time.Second
+
+	out, err := cmd.Output()
+	if ctx.Err() == context.DeadlineExceeded {
+		return nil, ErrCommandTimeout
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", err, strings.TrimSpace(stderr.String()))
+	}
+
+	return out, nil
+}
+
+// ParseScriptOutput разбирает вывод команды коллектора exec и добавляет метрики в store.
+// При ошибке разбора store не изменяется.
+func ParseScriptOutput(out []byte, store MetricStore) error {
+	var parsed []MetricsModel
+
+	trimmed := bytes.TrimSpace(out)
+	if bytes.HasPrefix(trimmed, []byte("[")) {
+		var ms []scriptMetric
+		if err := json.Unmarshal(trimmed, &ms); err != nil {
+			return err
+		}
+
+		for _, m := range ms {
+			model, err := m.model()
+			if err != nil {
+				return fmt.Errorf("%s: %w", m.ID, err)
+			}
+			parsed = append(parsed, model)
+		}
+	} else {
+		scanner := bufio.NewScanner(bytes.NewReader(trimmed))
+		for scanner.Scan() {
+			line := strings.TrimSpace(scanner.Text())
+			if line == "" || strings.HasPrefix(line, "#") {
+				continue
+			}
+
+			model, err := parseScriptLine(line)
+			if err != nil {
+				return err
+			}
+			parsed = append(parsed, model)
+		}
+		if err := scanner.Err(); err != nil {
+			return err
+		}
+	}
+
+	for _, m := range parsed {
+		if err := m.Labels.Validate(); err != nil {
+			return fmt.Errorf("%s: %w", m.Key, err)
+		}
+	}
+
+	for _, m := range parsed {
+		store.Merge(MetricStore{m.SeriesKey(): m})
+	}
+
+	return nil
+}
+
+// parseScriptLine разбирает строку "name type value".
+func parseScriptLine(line string) (MetricsModel, error) {
+	fields := strings.Fields(line)
+	if len(fields) < 3 {
+		return MetricsModel{}, fmt.Errorf("%w: %q", ErrBadScriptLine, line)
+	}
+
+	name, labels, err := core.ParseMetricKey(fields[0])
+	if err != nil {
+		return MetricsModel{}, fmt.Errorf("%w: %q: %w", ErrBadScriptLine, line, err)
+	}
+
+	m := MetricsModel{
+		Key:    name,
+		Labels: labels,
+		Type:   core.NewMetricType(fields[1]),
+		Value:  strings.Join(fields[2:], " "),
+	}
+
+	switch m.Type {
+	case core.Gauge:
+		_, err = strconv.ParseFloat(m.Value, 64)
+	case core.Counter:
+		_, err = strconv.ParseInt(m.Value, 10, 64)
+	case core.Histogram:
+		_, err = core.ParseHistogram(m.Value)
+	default:
+		err = core.ErrUnknownMetricType
+	}
+	if err != nil {
+		return MetricsModel{}, fmt.Errorf("%w: %q: %w", ErrBadScriptLine, line, err)
+	}
+
+	return m, nil
+}
+
+func init() {
+	MustRegister("exec", newExecCollector)
+}
@@ -0,0 +1,79 @@
+package polling
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/smartfor/metrics/internal/core"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseScriptOutput(t *testing.T) {
+	tests := []struct {
+		name    string
+		out     string
+		want    map[string]string
+		wantErr bool
+	}{
+		{
+			name: "Text lines",
+			out:  "# orders\norders_total counter 3\norders_total counter 2\n\nqueue{name=\"mail\"} gauge 1.5\n",
+			want: map[string]string{"orders_total": "5", `queue{name="mail"}`: "1.5"},
+		},
+		{
+			name: "JSON metrics",
+			out:  `[{"id": "orders_total", "type": "counter", "delta": 3}, {"id": "queue", "type": "gauge", "value": 2, "labels": {"name": "mail"}}]`,
+			want: map[string]string{"orders_total": "3", `queue{name="mail"}`: "2"},
+		},
+		{name: "Unknown type", out: "orders_total summary 3\n", wantErr: true},
+		{name: "Bad counter", out: "orders_total counter 1.5\n", wantErr: true},
+		{name: "Missing value", out: "orders_total counter\n", wantErr: true},
+		{name: "JSON without value", out: `[{"id": "queue", "type": "gauge"}]`, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := make(MetricStore)
+			err := ParseScriptOutput([]byte(tt.out), store)
+			if tt.wantErr {
+				assert.Error(t, err)
+				assert.Empty(t, store)
+				return
+			}
+			require.NoError(t, err)
+
+			got := make(map[string]string, len(store))
+			for k, v := range store {
+				got[k] = v.Value
+			}
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestExecCollector(t *testing.T) {
+	options, err := json.Marshal(execOptions{Commands: []ExecCommand{
+		{Command: []string{"sh", "-c", "echo jobs gauge 4"}},
+		{Command: []string{"sh", "-c", "exit 1"}},
+		{Command: []string{"sleep", "5"}, Timeout: "50ms"},
+	}})
+	require.NoError(t, err)
+
+	c, err := NewCollector("exec", Settings{Interval: time.Second, Options: options})
+	require.NoError(t, err)
+
+	start := time.Now()
+	store, err := c.Collect(context.Background())
+	require.NoError(t, err)
+	assert.Less(t, time.Since(start), 3*time.Second, "command timeout is applied")
+
+	assert.Equal(t, MetricStore{
+		"jobs": {Key: "jobs", Type: core.Gauge, Value: "4"},
+	}, store)
+
+	_, err = NewCollector("exec", Settings{Interval: time.Second, Options: []byte(`{"commands": [{"command": []}]}`)})
+	assert.ErrorIs(t, err, ErrEmptyCommand)
+}
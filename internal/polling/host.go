@@ -0,0 +1,242 @@
+package polling
+
+import (
+	"context"
+	"errors"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/shirou/gopsutil/v3/disk"
+	"github.com/shirou/gopsutil/v3/host"
+	"github.com/shirou/gopsutil/v3/load"
+	"github.com/shirou/gopsutil/v3/net"
+	"github.com/smartfor/metrics/internal/core"
+)
+
+// Коллекторы метрик хоста. Все они выключены по умолчанию и включаются по имени в конфигурации агента:
+//
+//	disk   - DiskTotal, DiskUsed, DiskFree, DiskUsedPercent с меткой mountpoint
+//	diskio - DiskReadBytes, DiskWriteBytes, DiskReadCount, DiskWriteCount (counter) с меткой device
+//	net    - NetBytesSent, NetBytesRecv, NetPacketsSent, NetPacketsRecv (counter) с меткой interface
+//	load   - Load1, Load5, Load15
+//	fd     - OpenFileDescriptors, MaxFileDescriptors
+//	uptime - Uptime (секунды)
+
+// fileNrPath - файл ядра Linux с количеством открытых и максимальным числом файловых дескрипторов
+var fileNrPath = "/proc/sys/fs/file-nr"
+
+// Источники метрик хоста, подменяются в тестах
+var (
+	diskPartitions = disk.PartitionsWithContext
+	diskUsage      = disk.UsageWithContext
+	diskIOCounters = disk.IOCountersWithContext
+	netIOCounters  = net.IOCountersWithContext
+	loadAvg        = load.AvgWithContext
+	hostUptime     = host.UptimeWithContext
+)
+
+var ErrBadFileNr = errors.New("unexpected file-nr format")
+
+// filterOptions - параметры коллекторов, позволяющие ограничить набор устройств.
+// Пустой список означает все устройства.
+type filterOptions struct {
+	Include []string `json:"include"`
+}
+
+func (f filterOptions) match(name string) bool {
+	return len(f.Include) == 0 || slices.Contains(f.Include, name)
+}
+
+func gauge(key string, labels core.Labels, value float64) MetricsModel {
+	return MetricsModel{Type: core.Gauge, Key: key, Labels: labels, Value: strconv.FormatFloat(value, 'f', -1, 64)}
+}
+
+func counter(key string, labels core.Labels, delta int64) MetricsModel {
+	return MetricsModel{Type: core.Counter, Key: key, Labels: labels, Value: strconv.FormatInt(delta, 10)}
+}
+
+// Add добавляет метрику в хранилище под идентификатором ее серии.
+func (store MetricStore) Add(m MetricsModel) {
+	store[m.SeriesKey()] = m
+}
+
+// addCounter добавляет приращение накопительного счетчика ОС с прошлого опроса.
+func (store MetricStore) addCounter(tracker *core.CounterTracker, key string, labels core.Labels, total uint64) {
+	m := counter(key, labels, 0)
+	m.Value = strconv.FormatInt(tracker.Delta(m.SeriesKey(), float64(total)), 10)
+	store.Add(m)
+}
+
+func newDiskCollector(s Settings) (Collector, error) {
+	var opts filterOptions
+	if err := s.DecodeOptions(&opts); err != nil {
+		return nil, err
+	}
+
+	return NewFuncCollector("disk", s.Interval, func(ctx context.Context) (MetricStore, error) {
+		partitions, err := diskPartitions(ctx, false)
+		if err != nil {
+			return nil, err
+		}
+
+		store := make(MetricStore)
+		for _, p := range partitions {
+			if !opts.match(p.Mountpoint) {
+				continue
+			}
+
+			usage, err := diskUsage(ctx, p.Mountpoint)
+			if err != nil {
+				continue
+			}
+
+			labels := core.Labels{"mountpoint": p.Mountpoint}
+			store.Add(gauge("DiskTotal", labels, float64(usage.Total)))
+			store.Add(gauge("DiskUsed", labels, float64(usage.Used)))
+			store.Add(gauge("DiskFree", labels, float64(usage.Free)))
+			store.Add(gauge("DiskUsedPercent", labels, usage.UsedPercent))
+		}
+
+		return store, nil
+	}), nil
+}
+
+func newDiskIOCollector(s Settings) (Collector, error) {
+	var opts filterOptions
+	if err := s.DecodeOptions(&opts); err != nil {
+		return nil, err
+	}
+	tracker := core.NewCounterTracker()
+
+	return NewFuncCollector("diskio", s.Interval, func(ctx context.Context) (MetricStore, error) {
+		counters, err := diskIOCounters(ctx, opts.Include...)
+		if err != nil {
+			return nil, err
+		}
+
+		store := make(MetricStore)
+		for name, c := range counters {
+			labels := core.Labels{"device": name}
+			store.addCounter(tracker, "DiskReadBytes", labels, c.ReadBytes)
+			store.addCounter(tracker, "DiskWriteBytes", labels, c.WriteBytes)
+			store.addCounter(tracker, "DiskReadCount", labels, c.ReadCount)
+			store.addCounter(tracker, "DiskWriteCount", labels, c.WriteCount)
+		}
+
+		return store, nil
+	}), nil
+}
+
+func newNetCollector(s Settings) (Collector, error) {
+	var opts filterOptions
+	if err := s.DecodeOptions(&opts); err != nil {
+		return nil, err
+	}
+	tracker := core.NewCounterTracker()
+
+	return NewFuncCollector("net", s.Interval, func(ctx context.Context) (MetricStore, error) {
+		counters, err := netIOCounters(ctx, true)
+		if err != nil {
+			return nil, err
+		}
+
+		store := make(MetricStore)
+		for _, c := range counters {
+			if !opts.match(c.Name) {
+				continue
+			}
+
+			labels := core.Labels{"interface": c.Name}
+			store.addCounter(tracker, "NetBytesSent", labels, c.BytesSent)
+			store.addCounter(tracker, "NetBytesRecv", labels, c.BytesRecv)
+			store.addCounter(tracker, "NetPacketsSent", labels, c.PacketsSent)
+			store.addCounter(tracker, "NetPacketsRecv", labels, c.PacketsRecv)
+		}
+
+		return store, nil
+	}), nil
+}
+
+func newLoadCollector(s Settings) (Collector, error) {
+	return NewFuncCollector("load", s.Interval, func(ctx context.Context) (MetricStore, error) {
+		avg, err := loadAvg(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		store := make(MetricStore)
+		store.Add(gauge("Load1", nil, avg.Load1))
+		store.Add(gauge("Load5", nil, avg.Load5))
+		store.Add(gauge("Load15", nil, avg.Load15))
+
+		return store, nil
+	}), nil
+}
+
+func newFDCollector(s Settings) (Collector, error) {
+	return NewFuncCollector("fd", s.Interval, func(context.Context) (MetricStore, error) {
+		open, max, err := readFileNr(fileNrPath)
+		if err != nil {
+			return nil, err
+		}
+
+		store := make(MetricStore)
+		store.Add(gauge("OpenFileDescriptors", nil, float64(open)))
+		store.Add(gauge("MaxFileDescriptors", nil, float64(max)))
+
+		return store, nil
+	}), nil
+}
+
+// readFileNr разбирает file-nr: "<открытые> <свободные выделенные> <максимум>".
+func readFileNr(path string) (open uint64, max uint64, err error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	fields := strings.Fields(string(data))
+	if len(fields) != 3 {
+		return 0, 0, ErrBadFileNr
+	}
+
+	allocated, err := strconv.ParseUint(fields[0], 10, 64)
+	if err != nil {
+		return 0, 0, ErrBadFileNr
+	}
+	free, err := strconv.ParseUint(fields[1], 10, 64)
+	if err != nil || free > allocated {
+		return 0, 0, ErrBadFileNr
+	}
+	max, err = strconv.ParseUint(fields[2], 10, 64)
+	if err != nil {
+		return 0, 0, ErrBadFileNr
+	}
+
+	return allocated - free, max, nil
+}
+
+func newUptimeCollector(s Settings) (Collector, error) {
+	return NewFuncCollector("uptime", s.Interval, func(ctx context.Context) (MetricStore, error) {
+		uptime, err := hostUptime(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		store := make(MetricStore)
+		store.Add(gauge("Uptime", nil, float64(uptime)))
+
+		return store, nil
+	}), nil
+}
+
+func init() {
+	MustRegister("disk", newDiskCollector)
+	MustRegister("diskio", newDiskIOCollector)
+	MustRegister("net", newNetCollector)
+	MustRegister("load", newLoadCollector)
+	MustRegister("fd", newFDCollector)
+	MustRegister("uptime", newUptimeCollector)
+}
@@ -0,0 +1,185 @@
+package polling
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/shirou/gopsutil/v3/disk"
+	"github.com/shirou/gopsutil/v3/load"
+	"github.com/shirou/gopsutil/v3/net"
+	"github.com/smartfor/metrics/internal/core"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReadFileNr(t *testing.T) {
+	dir := t.TempDir()
+
+	tests := []struct {
+		name    string
+		content string
+		open    uint64
+		max     uint64
+		wantErr bool
+	}{
+		{name: "Valid", content: "1536\t36\t9223372036854775807\n", open: 1500, max: 9223372036854775807},
+		{name: "Missing fields", content: "1536 0\n", wantErr: true},
+		{name: "Not a number", content: "a 0 10\n", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(dir, "file-nr")
+			require.NoError(t, os.WriteFile(path, []byte(tt.content), 0o600))
+
+			open, max, err := readFileNr(path)
+			if tt.wantErr {
+				assert.ErrorIs(t, err, ErrBadFileNr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.open, open)
+			assert.Equal(t, tt.max, max)
+		})
+	}
+}
+
+// stub подменяет значение переменной на время теста
+func stub[T any](t *testing.T, target *T, value T) {
+	prev := *target
+	*target = value
+	t.Cleanup(func() { *target = prev })
+}
+
+func collectHost(t *testing.T, name string, options string) (Collector, MetricStore) {
+	settings := Settings{Interval: time.Second}
+	if options != "" {
+		settings.Options = []byte(options)
+	}
+
+	c, err := NewCollector(name, settings)
+	require.NoError(t, err)
+	assert.Equal(t, name, c.Name())
+
+	store, err := c.Collect(context.Background())
+	require.NoError(t, err)
+
+	return c, store
+}
+
+func TestHostCollectors(t *testing.T) {
+	t.Run("disk", func(t *testing.T) {
+		stub(t, &diskPartitions, func(context.Context, bool) ([]disk.PartitionStat, error) {
+			return []disk.PartitionStat{{Mountpoint: "/"}, {Mountpoint: "/data"}, {Mountpoint: "/broken"}}, nil
+		})
+		stub(t, &diskUsage, func(_ context.Context, path string) (*disk.UsageStat, error) {
+			if path == "/broken" {
+				return nil, errors.New("permission denied")
+			}
+			return &disk.UsageStat{Total: 100, Used: 25, Free: 75, UsedPercent: 25}, nil
+		})
+
+		_, store := collectHost(t, "disk", "")
+		assert.Len(t, store, 8, "unreadable mountpoint is skipped")
+		assert.Equal(t, "100", store[`DiskTotal{mountpoint="/"}`].Value)
+		assert.Equal(t, "25", store[`DiskUsed{mountpoint="/data"}`].Value)
+		assert.Equal(t, "75", store[`DiskFree{mountpoint="/data"}`].Value)
+		assert.Equal(t, core.Gauge, store[`DiskUsedPercent{mountpoint="/"}`].Type)
+
+		_, store = collectHost(t, "disk", `{"include": ["/data"]}`)
+		assert.Len(t, store, 4)
+		assert.NotContains(t, store, `DiskTotal{mountpoint="/"}`)
+	})
+
+	t.Run("diskio", func(t *testing.T) {
+		var include []string
+		reads := uint64(1000)
+		stub(t, &diskIOCounters, func(_ context.Context, names ...string) (map[string]disk.IOCountersStat, error) {
+			include = names
+			return map[string]disk.IOCountersStat{"sda": {ReadBytes: reads, WriteBytes: 10, ReadCount: 5, WriteCount: 1}}, nil
+		})
+
+		c, store := collectHost(t, "diskio", `{"include": ["sda"]}`)
+		assert.Equal(t, []string{"sda"}, include)
+		// Первый опрос задает базу накопительных счетчиков
+		assert.Equal(t, "0", store[`DiskReadBytes{device="sda"}`].Value)
+		assert.Equal(t, core.Counter, store[`DiskReadBytes{device="sda"}`].Type)
+
+		reads = 1500
+		store, err := c.Collect(context.Background())
+		require.NoError(t, err)
+		assert.Equal(t, "500", store[`DiskReadBytes{device="sda"}`].Value)
+		assert.Equal(t, "0", store[`DiskWriteCount{device="sda"}`].Value)
+	})
+
+	t.Run("net", func(t *testing.T) {
+		sent := uint64(100)
+		stub(t, &netIOCounters, func(_ context.Context, pernic bool) ([]net.IOCountersStat, error) {
+			require.True(t, pernic)
+			return []net.IOCountersStat{
+				{Name: "eth0", BytesSent: sent, BytesRecv: 50, PacketsSent: 2, PacketsRecv: 1},
+				{Name: "lo", BytesSent: sent},
+			}, nil
+		})
+
+		c, store := collectHost(t, "net", `{"include": ["eth0"]}`)
+		assert.Len(t, store, 4)
+		assert.NotContains(t, store, `NetBytesSent{interface="lo"}`)
+
+		sent = 350
+		store, err := c.Collect(context.Background())
+		require.NoError(t, err)
+		assert.Equal(t, "250", store[`NetBytesSent{interface="eth0"}`].Value)
+		assert.Equal(t, "0", store[`NetBytesRecv{interface="eth0"}`].Value)
+
+		// Сброс счетчика интерфейса
+		sent = 20
+		store, err = c.Collect(context.Background())
+		require.NoError(t, err)
+		assert.Equal(t, "20", store[`NetBytesSent{interface="eth0"}`].Value)
+	})
+
+	t.Run("load", func(t *testing.T) {
+		stub(t, &loadAvg, func(context.Context) (*load.AvgStat, error) {
+			return &load.AvgStat{Load1: 0.5, Load5: 1.25, Load15: 2}, nil
+		})
+
+		_, store := collectHost(t, "load", "")
+		assert.Equal(t, "0.5", store["Load1"].Value)
+		assert.Equal(t, "1.25", store["Load5"].Value)
+		assert.Equal(t, "2", store["Load15"].Value)
+	})
+
+	t.Run("fd", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "file-nr")
+		require.NoError(t, os.WriteFile(path, []byte("1536\t36\t4096\n"), 0o600))
+		stub(t, &fileNrPath, path)
+
+		_, store := collectHost(t, "fd", "")
+		assert.Equal(t, "1500", store["OpenFileDescriptors"].Value)
+		assert.Equal(t, "4096", store["MaxFileDescriptors"].Value)
+	})
+
+	t.Run("uptime", func(t *testing.T) {
+		stub(t, &hostUptime, func(context.Context) (uint64, error) { return 3600, nil })
+
+		_, store := collectHost(t, "uptime", "")
+		assert.Equal(t, "3600", store["Uptime"].Value)
+	})
+
+	t.Run("Source error fails collect", func(t *testing.T) {
+		stub(t, &loadAvg, func(context.Context) (*load.AvgStat, error) { return nil, errors.New("not supported") })
+
+		c, err := NewCollector("load", Settings{Interval: time.Second})
+		require.NoError(t, err)
+		_, err = c.Collect(context.Background())
+		assert.Error(t, err)
+	})
+
+	_, err := NewCollector("net", Settings{Interval: time.Second, Options: []byte(`{"include": 1}`)})
+	assert.Error(t, err)
+}
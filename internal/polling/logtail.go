@@ -0,0 +1,323 @@
+package polling
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strconv"
+
+	"github.com/smartfor/metrics/internal/core"
+)
+
+// Коллектор logtail дочитывает лог-файлы с прошлого опроса и применяет к новым строкам правила.
+// Правило counter увеличивает счетчик на 1 на каждую подходящую строку, а если в выражении есть
+// группа - на число из первой группы. Правило gauge запоминает число из первой группы последней
+// подходящей строки и отправляет его в каждом отчете. Метрики отмечаются меткой file и метками правила.
+//
+// Файлы читаются с конца, как tail -F. После ротации (на месте файла появился другой файл)
+// старый файл дочитывается до конца, а новый читается с начала; после усечения файл читается с начала.
+// Усечение распознается по уменьшению размера или по изменившемуся началу файла, если после усечения
+// (например, copytruncate) файл успел вырасти больше прочитанного.
+//
+// Пример параметров:
+//
+//	{"files": [{
+//	  "path": "/var/log/app.log",
+//	  "rules": [
+//	    {"metric": "AppErrors", "type": "counter", "regex": "ERROR"},
+//	    {"metric": "QueueDepth", "type": "gauge", "regex": "queue_depth=(\\d+)"}
+//	  ]
+//	}]}
+
+var ErrInvalidLogRule = errors.New("invalid log rule")
+
+const (
+	// maxLogLine - максимальная длина строки лога, более длинные строки обрезаются
+	maxLogLine = 64 * 1024
+	// logHeadSize - размер начала файла, по которому распознается его перезапись на месте
+	logHeadSize = 256
+)
+
+// LogRule - правило извлечения метрики из строк лога
+type LogRule struct {
+	Metric string            `json:"metric"`
+	Type   core.MetricType   `json:"type"`
+	Regex  string            `json:"regex"`
+	Labels map[string]string `json:"labels,omitempty"`
+}
+
+// LogFile - отслеживаемый лог-файл и правила для его строк
+type LogFile struct {
+	Path  string    `json:"path"`
+	Rules []LogRule `json:"rules"`
+	// FromBeginning - читать файл, существующий при запуске агента, с начала
+	FromBeginning bool `json:"from_beginning,omitempty"`
+}
+
+type logtailOptions struct {
+	Files []LogFile `json:"files"`
+}
+
+type logRule struct {
+	LogRule
+	re     *regexp.Regexp
+	labels core.Labels
+	// gauge - последнее значение правила gauge, nil пока не было совпадений
+	gauge *float64
+}
+
+// logTail - состояние чтения одного файла
+type logTail struct {
+	path  string
+	rules []*logRule
+	file  *os.File
+	info  os.FileInfo
+	// offset - позиция в file, до которой строки уже обработаны
+	offset int64
+	// partial - недописанная последняя строка
+	partial []byte
+	// head - начало файла (до logHeadSize байт) в момент чтения
+	head []byte
+	// fromBeginning - читать следующий открытый файл с начала
+	fromBeginning bool
+}
+
+func newLogtailCollector(s Settings) (Collector, error) {
+	var opts logtailOptions
+	if err := s.DecodeOptions(&opts); err != nil {
+		return nil, err
+	}
+
+	tails := make([]*logTail, 0, len(opts.Files))
+	for _, f := range opts.Files {
+		t := &logTail{path: f.Path, fromBeginning: f.FromBeginning}
+		for _, r := range f.Rules {
+			rule, err := newLogRule(f.Path, r)
+			if err != nil {
+				return nil, err
+			}
+			t.rules = append(t.rules, rule)
+		}
+		tails = append(tails, t)
+	}
+
+	return NewFuncCollector("logtail", s.Interval, func(context.Context) (MetricStore, error) {
+		store := make(MetricStore)
+		for _, t := range tails {
+			if err := t.collect(store); err != nil {
+				return nil, fmt.Errorf("%s: %w", t.path, err)
+			}
+		}
+
+		return store, nil
+	}), nil
+}
+
+func newLogRule(path string, r LogRule) (*logRule, error) {
+	if r.Metric == "" {
+		return nil, fmt.Errorf("%w: metric is required", ErrInvalidLogRule)
+	}
+
+	re, err := regexp.Compile(r.Regex)
+	if err != nil {
+		return nil, fmt.Errorf("%w %s: %w", ErrInvalidLogRule, r.Metric, err)
+	}
+
+	switch r.Type {
+	case core.Counter:
+	case core.Gauge:
+		if re.NumSubexp() == 0 {
+			return nil, fmt.Errorf("%w %s: gauge rule needs a capture group", ErrInvalidLogRule, r.Metric)
+		}
+	default:
+		return nil, fmt.Errorf("%w %s: %w", ErrInvalidLogRule, r.Metric, core.ErrUnknownMetricType)
+	}
+
+	labels := core.Labels(r.Labels).Merge(core.Labels{"file": path})
+	if err := labels.Validate(); err != nil {
+		return nil, fmt.Errorf("%w %s: %w", ErrInvalidLogRule, r.Metric, err)
+	}
+
+	return &logRule{LogRule: r, re: re, labels: labels}, nil
+}
+
+// collect обрабатывает новые строки файла и добавляет метрики правил в store.
+// Отсутствие файла не ошибка: он может появиться позже.
+func (t *logTail) collect(store MetricStore) error {
+	counts := make([]int64, len(t.rules))
+
+	info, err := os.Stat(t.path)
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+		// Файл удален при ротации, новый еще не создан, или еще не появился после запуска.
+		// Старый файл дочитывается при появлении нового, а новый читается с начала.
+		t.fromBeginning = true
+	case err != nil:
+		return err
+	case t.file == nil:
+		if err := t.open(info); err != nil {
+			return err
+		}
+	case !os.SameFile(info, t.info):
+		// Ротация: дочитываем старый файл и переходим на новый
+		if err := t.read(counts); err != nil {
+			return err
+		}
+		t.file.Close()
+		t.file, t.partial, t.fromBeginning = nil, nil, true
+		if err := t.open(info); err != nil {
+			return err
+		}
+	default:
+		truncated, err := t.truncated(info)
+		if err != nil {
+			return err
+		}
+		if truncated {
+			t.offset, t.partial, t.head = 0, nil, nil
+		}
+	}
+
+	if t.file != nil {
+		if err := t.read(counts); err != nil {
+			return err
+		}
+		if err := t.readHead(); err != nil {
+			return err
+		}
+	}
+
+	for i, r := range t.rules {
+		switch r.Type {
+		case core.Counter:
+			store.Add(counter(r.Metric, r.labels, counts[i]))
+		case core.Gauge:
+			if r.gauge != nil {
+				store.Add(gauge(r.Metric, r.labels, *r.gauge))
+			}
+		}
+	}
+
+	return nil
+}
+
+func (t *logTail) open(info os.FileInfo) error {
+	f, err := os.Open(t.path)
+	if err != nil {
+		return err
+	}
+
+	t.file, t.info, t.offset, t.head = f, info, 0, nil
+	if !t.fromBeginning {
+		t.offset = info.Size()
+	}
+	// Файлы, появившиеся после запуска, читаются с начала
+	t.fromBeginning = true
+
+	return nil
+}
+
+// truncated сообщает, был ли файл усечен после прошлого чтения: он стал короче прочитанного
+// или его начало не совпадает с запомненным.
+func (t *logTail) truncated(info os.FileInfo) (bool, error) {
+	if info.Size() < t.offset {
+		return true, nil
+	}
+	if len(t.head) == 0 {
+		return false, nil
+	}
+
+	head := make([]byte, len(t.head))
+	if _, err := t.file.ReadAt(head, 0); err != nil {
+		if errors.Is(err, io.EOF) {
+			return true, nil
+		}
+		return false, err
+	}
+
+	return !bytes.Equal(head, t.head), nil
+}
+
+// readHead запоминает начало файла в пределах прочитанного, пока оно не достигло logHeadSize.
+func (t *logTail) readHead() error {
+	size := min(t.offset, logHeadSize)
+	if int64(len(t.head)) >= size {
+		return nil
+	}
+
+	head := make([]byte, size)
+	if _, err := t.file.ReadAt(head, 0); err != nil {
+		return err
+	}
+	t.head = head
+
+	return nil
+}
+
+// read обрабатывает строки файла от offset до конца. Файл читается построчно через буфер
+// размера maxLogLine, offset сдвигается после каждой строки.
+func (t *logTail) read(counts []int64) error {
+	r := bufio.NewReaderSize(io.NewSectionReader(t.file, t.offset, 1<<62), maxLogLine)
+
+	for {
+		chunk, err := r.ReadSlice('\n')
+		t.offset += int64(len(chunk))
+
+		switch {
+		case err == nil:
+			line := chunk[:len(chunk)-1]
+			if len(t.partial) > 0 {
+				line = t.appendPartial(line)
+				t.partial = nil
+			}
+			t.apply(bytes.TrimSuffix(line, []byte("\r")), counts)
+		case errors.Is(err, bufio.ErrBufferFull), errors.Is(err, io.EOF):
+			// Начало длинной строки или недописанная строка: сохраняем до maxLogLine байт
+			t.partial = t.appendPartial(chunk)
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+		default:
+			return err
+		}
+	}
+}
+
+// appendPartial возвращает partial, дополненную chunk, не длиннее maxLogLine.
+func (t *logTail) appendPartial(chunk []byte) []byte {
+	n := min(len(chunk), max(maxLogLine-len(t.partial), 0))
+	return append(t.partial, chunk[:n]...)
+}
+
+func (t *logTail) apply(line []byte, counts []int64) {
+	for i, r := range t.rules {
+		match := r.re.FindSubmatch(line)
+		if match == nil {
+			continue
+		}
+
+		switch r.Type {
+		case core.Counter:
+			if len(match) < 2 {
+				counts[i]++
+				continue
+			}
+			if v, err := strconv.ParseInt(string(match[1]), 10, 64); err == nil {
+				counts[i] += v
+			}
+		case core.Gauge:
+			if v, err := strconv.ParseFloat(string(match[1]), 64); err == nil {
+				r.gauge = &v
+			}
+		}
+	}
+}
+
+func init() {
+	MustRegister("logtail", newLogtailCollector)
+}
@@ -0,0 +1,132 @@
+package polling
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/smartfor/metrics/internal/core"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func appendLog(t *testing.T, path string, lines string) {
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+	require.NoError(t, err)
+	_, err = f.WriteString(lines)
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+}
+
+func TestLogtailCollector(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "app.log")
+	appendLog(t, path, "ERROR before start\n")
+
+	options, err := json.Marshal(logtailOptions{Files: []LogFile{{
+		Path: path,
+		Rules: []LogRule{
+			{Metric: "AppErrors", Type: core.Counter, Regex: "ERROR"},
+			{Metric: "QueueDepth", Type: core.Gauge, Regex: `queue_depth=(\d+)`, Labels: map[string]string{"queue": "mail"}},
+		},
+	}}})
+	require.NoError(t, err)
+
+	c, err := NewCollector("logtail", Settings{Interval: time.Second, Options: options})
+	require.NoError(t, err)
+
+	errorsKey := core.MetricKey("AppErrors", core.Labels{"file": path})
+	depthKey := core.MetricKey("QueueDepth", core.Labels{"file": path, "queue": "mail"})
+
+	collect := func() MetricStore {
+		store, err := c.Collect(context.Background())
+		require.NoError(t, err)
+		return store
+	}
+
+	// Строки, записанные до запуска, пропускаются
+	store := collect()
+	assert.Equal(t, "0", store[errorsKey].Value)
+	assert.NotContains(t, store, depthKey)
+
+	appendLog(t, path, "ERROR one\nINFO queue_depth=5\nERROR two\nINFO queue_depth=7\nERROR par")
+	store = collect()
+	assert.Equal(t, "2", store[errorsKey].Value)
+	assert.Equal(t, "7", store[depthKey].Value)
+
+	// Окончание строки дописано позже, gauge сохраняет последнее значение
+	appendLog(t, path, "tial\n")
+	store = collect()
+	assert.Equal(t, "1", store[errorsKey].Value)
+	assert.Equal(t, "7", store[depthKey].Value)
+
+	// Ротация: старый файл дочитывается, новый читается с начала
+	rotated := path + ".1"
+	require.NoError(t, os.Rename(path, rotated))
+	appendLog(t, rotated, "ERROR late write to old file\n")
+	appendLog(t, path, "ERROR in new file\nINFO queue_depth=3\n")
+	store = collect()
+	assert.Equal(t, "2", store[errorsKey].Value)
+	assert.Equal(t, "3", store[depthKey].Value)
+
+	// Усечение
+	require.NoError(t, os.Truncate(path, 0))
+	appendLog(t, path, "ERROR after truncate\n")
+	store = collect()
+	assert.Equal(t, "1", store[errorsKey].Value)
+
+	// Усечение, после которого файл вырос больше прочитанного (copytruncate)
+	require.NoError(t, os.Truncate(path, 0))
+	appendLog(t, path, "ERROR restarted, this line is longer\nERROR one\nERROR two\n")
+	store = collect()
+	assert.Equal(t, "3", store[errorsKey].Value)
+
+	// Строка длиннее maxLogLine обрезается и учитывается один раз
+	appendLog(t, path, "ERROR "+strings.Repeat("x", 3*maxLogLine)+"\nERROR short\n")
+	store = collect()
+	assert.Equal(t, "2", store[errorsKey].Value)
+
+	// Файл удален и еще не создан заново
+	require.NoError(t, os.Remove(path))
+	store = collect()
+	assert.Equal(t, "0", store[errorsKey].Value)
+}
+
+func TestLogtailCollector_FileCreatedLater(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "app.log")
+
+	options, err := json.Marshal(logtailOptions{Files: []LogFile{{
+		Path:  path,
+		Rules: []LogRule{{Metric: "AppErrors", Type: core.Counter, Regex: "ERROR"}},
+	}}})
+	require.NoError(t, err)
+
+	c, err := NewCollector("logtail", Settings{Interval: time.Second, Options: options})
+	require.NoError(t, err)
+	errorsKey := core.MetricKey("AppErrors", core.Labels{"file": path})
+
+	store, err := c.Collect(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, "0", store[errorsKey].Value)
+
+	// Файл появился после запуска: строки до следующего опроса не пропускаются
+	appendLog(t, path, "ERROR one\nERROR two\n")
+	store, err = c.Collect(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, "2", store[errorsKey].Value)
+}
+
+func TestLogRule_Validation(t *testing.T) {
+	for _, rule := range []LogRule{
+		{Type: core.Counter, Regex: "ERROR"},
+		{Metric: "Depth", Type: core.Gauge, Regex: "queue_depth"},
+		{Metric: "Errors", Type: core.Counter, Regex: "("},
+		{Metric: "Errors", Type: core.Histogram, Regex: "ERROR"},
+	} {
+		_, err := newLogRule("app.log", rule)
+		assert.ErrorIs(t, err, ErrInvalidLogRule, rule.Metric)
+	}
+}
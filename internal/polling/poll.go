@@ -15,15 +15,9 @@ import (
 	"github.com/smartfor/metrics/internal/core"
 )
 
-type PollMessageType int
-
-const (
-	PollMainMetricsType     PollMessageType = 0
-	PollAdvancedMetricsType PollMessageType = 1
-)
-
 type MetricStore map[string]MetricsModel
 
+// PollMainMetrics собирает метрики рантайма Go (коллектор runtime).
 func PollMainMetrics() MetricStore {
 	store := make(MetricStore)
 
@@ -70,6 +64,7 @@ func PollMainMetrics() MetricStore {
 	return store
 }
 
+// PollAdvancedMetrics собирает метрики памяти и загрузки CPU системы (коллектор system).
 func PollAdvancedMetrics() (MetricStore, error) {
 	v, err := mem.VirtualMemory()
 	if err != nil {
@@ -130,49 +125,3 @@ func FanInPolling(ctx context.Context, chs ...<-chan PollMessage) <-chan PollMes
 
 	return outCh
 }
-
-func CreateMainPollChannel(ctx context.Context, interval time.Duration) <-chan PollMessage {
-	ch := make(chan PollMessage)
-
-	go func() {
-		for {
-			select {
-			case <-ctx.Done():
-				close(ch)
-				return
-
-			case <-time.After(interval):
-				ch <- PollMessage{
-					Msg:  PollMainMetrics(),
-					Type: PollMainMetricsType,
-				}
-			}
-		}
-	}()
-
-	return ch
-}
-
-func CreateAdvancedPollChannel(ctx context.Context, interval time.Duration) <-chan PollMessage {
-	ch := make(chan PollMessage)
-
-	go func() {
-		for {
-			select {
-			case <-ctx.Done():
-				close(ch)
-				return
-
-			case <-time.After(interval):
-				m, err := PollAdvancedMetrics()
-				ch <- PollMessage{
-					Msg:  m,
-					Type: PollAdvancedMetricsType,
-					Err:  err,
-				}
-			}
-		}
-	}()
-
-	return ch
-}
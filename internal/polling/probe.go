@@ -0,0 +1,226 @@
+package polling
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/smartfor/metrics/internal/core"
+)
+
+// Коллектор probe проверяет доступность HTTP- и TCP-адресов. Метрики отмечаются меткой target:
+//
+//	ProbeUp                 - 1, если проверка успешна, иначе 0
+//	ProbeDurationSeconds    - время проверки
+//	ProbeFailures           - counter неуспешных проверок
+//	ProbeStatusCode         - HTTP-статус ответа (только HTTP)
+//	ProbeResponseBytes      - прочитано байт тела ответа, не больше max_body_bytes (только HTTP)
+//	ProbeTLSCertExpiryDays  - дней до истечения сертификата сервера (только HTTPS)
+//
+// HTTP-проверка успешна, если статус ответа входит в expect_status, а по умолчанию - 2xx или 3xx.
+// Редиректы выполняются. Тело ответа читается не больше max_body_bytes (по умолчанию 1 MiB), остаток
+// отбрасывается без чтения. TCP-проверка успешна, если соединение установлено.
+//
+// Пример параметров:
+//
+//	{"targets": [
+//	  {"name": "api", "http": "https://api.example.com/health", "timeout": "5s"},
+//	  {"name": "db", "tcp": "db.example.com:5432"}
+//	]}
+
+var ErrInvalidProbeTarget = errors.New("invalid probe target")
+
+const (
+	// defaultProbeTimeout - таймаут проверки, если он не задан и период опроса больше
+	defaultProbeTimeout = 10 * time.Second
+	// defaultProbeMaxBodyBytes - ограничение читаемого тела HTTP-ответа, если оно не задано
+	defaultProbeMaxBodyBytes = 1 << 20
+)
+
+// ProbeTarget - проверяемый адрес. Должен быть задан ровно один из HTTP или TCP.
+type ProbeTarget struct {
+	// Name - значение метки target
+	Name string `json:"name"`
+	// HTTP - URL для HTTP-проверки
+	HTTP string `json:"http,omitempty"`
+	// Method - HTTP-метод, по умолчанию GET
+	Method string `json:"method,omitempty"`
+	// ExpectStatus - допустимые HTTP-статусы
+	ExpectStatus []int `json:"expect_status,omitempty"`
+	// InsecureSkipVerify - не проверять сертификат сервера
+	InsecureSkipVerify bool `json:"insecure_skip_verify,omitempty"`
+	// MaxBodyBytes - сколько байт тела HTTP-ответа читать, по умолчанию 1 MiB
+	MaxBodyBytes int64 `json:"max_body_bytes,omitempty"`
+	// TCP - адрес host:port для TCP-проверки
+	TCP string `json:"tcp,omitempty"`
+	// Timeout - время на проверку, по умолчанию меньшее из 10s и периода опроса
+	Timeout string `json:"timeout,omitempty"`
+
+	timeout time.Duration
+	client  *http.Client
+}
+
+type probeOptions struct {
+	Targets []ProbeTarget `json:"targets"`
+}
+
+func newProbeCollector(s Settings) (Collector, error) {
+	var opts probeOptions
+	if err := s.DecodeOptions(&opts); err != nil {
+		return nil, err
+	}
+
+	for i := range opts.Targets {
+		if err := opts.Targets[i].init(s.Interval); err != nil {
+			return nil, err
+		}
+	}
+
+	return NewFuncCollector("probe", s.Interval, func(ctx context.Context) (MetricStore, error) {
+		var (
+			mu    sync.Mutex
+			wg    sync.WaitGroup
+			store = make(MetricStore)
+		)
+
+		for i := range opts.Targets {
+			wg.Add(1)
+			go func(t *ProbeTarget) {
+				defer wg.Done()
+
+				result := t.probe(ctx)
+
+				mu.Lock()
+				store.Merge(result)
+				mu.Unlock()
+			}(&opts.Targets[i])
+		}
+		wg.Wait()
+
+		return store, nil
+	}), nil
+}
+
+func (t *ProbeTarget) init(interval time.Duration) error {
+	if t.Name == "" {
+		return fmt.Errorf("%w: name is required", ErrInvalidProbeTarget)
+	}
+	if (t.HTTP == "") == (t.TCP == "") {
+		return fmt.Errorf("%w %s: exactly one of http or tcp must be set", ErrInvalidProbeTarget, t.Name)
+	}
+
+	t.timeout = min(defaultProbeTimeout, interval)
+	if t.Timeout != "" {
+		timeout, err := time.ParseDuration(t.Timeout)
+		if err != nil {
+			return fmt.Errorf("%w %s: error parsing timeout: %w", ErrInvalidProbeTarget, t.Name, err)
+		}
+		t.timeout = timeout
+	}
+
+	if t.HTTP != "" {
+		if t.Method == "" {
+			t.Method = http.MethodGet
+		}
+		if _, err := http.NewRequest(t.Method, t.HTTP, nil); err != nil {
+			return fmt.Errorf("%w %s: %w", ErrInvalidProbeTarget, t.Name, err)
+		}
+
+		switch {
+		case t.MaxBodyBytes < 0:
+			return fmt.Errorf("%w %s: max_body_bytes must not be negative", ErrInvalidProbeTarget, t.Name)
+		case t.MaxBodyBytes == 0:
+			t.MaxBodyBytes = defaultProbeMaxBodyBytes
+		}
+
+		transport := http.DefaultTransport.(*http.Transport).Clone()
+		transport.TLSClientConfig = &tls.Config{InsecureSkipVerify: t.InsecureSkipVerify}
+		// Каждая проверка открывает новое соединение, чтобы измерять полное время ответа
+		transport.DisableKeepAlives = true
+		t.client = &http.Client{Transport: transport}
+	}
+
+	return nil
+}
+
+func (t *ProbeTarget) probe(ctx context.Context) MetricStore {
+	ctx, cancel := context.WithTimeout(ctx, t.timeout)
+	defer cancel()
+
+	store := make(MetricStore)
+	labels := core.Labels{"target": t.Name}
+
+	start := time.Now()
+	var up bool
+	if t.HTTP != "" {
+		up = t.probeHTTP(ctx, store, labels)
+	} else {
+		up = t.probeTCP(ctx)
+	}
+
+	var upValue float64
+	var failures int64 = 1
+	if up {
+		upValue, failures = 1, 0
+	}
+
+	store.Add(gauge("ProbeUp", labels, upValue))
+	store.Add(gauge("ProbeDurationSeconds", labels, time.Since(start).Seconds()))
+	store.Add(counter("ProbeFailures", labels, failures))
+
+	return store
+}
+
+func (t *ProbeTarget) probeHTTP(ctx context.Context, store MetricStore, labels core.Labels) bool {
+	req, err := http.NewRequestWithContext(ctx, t.Method, t.HTTP, nil)
+	if err != nil {
+		return false
+	}
+
+	resp, err := t.client.Do(req)
+	if err != nil {
+		return false
+	}
+	defer resp.Body.Close()
+
+	size, err := io.Copy(io.Discard, io.LimitReader(resp.Body, t.MaxBodyBytes))
+	if err != nil {
+		return false
+	}
+
+	store.Add(gauge("ProbeStatusCode", labels, float64(resp.StatusCode)))
+	store.Add(gauge("ProbeResponseBytes", labels, float64(size)))
+
+	if resp.TLS != nil && len(resp.TLS.PeerCertificates) > 0 {
+		expiry := time.Until(resp.TLS.PeerCertificates[0].NotAfter).Hours() / 24
+		store.Add(gauge("ProbeTLSCertExpiryDays", labels, expiry))
+	}
+
+	if len(t.ExpectStatus) > 0 {
+		return slices.Contains(t.ExpectStatus, resp.StatusCode)
+	}
+
+	return resp.StatusCode >= 200 && resp.StatusCode < 400
+}
+
+func (t *ProbeTarget) probeTCP(ctx context.Context) bool {
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "tcp", t.TCP)
+	if err != nil {
+		return false
+	}
+	conn.Close()
+
+	return true
+}
+
+func init() {
+	MustRegister("probe", newProbeCollector)
+}
@@ -0,0 +1,95 @@
+package polling
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestProbeCollector(t *testing.T) {
+	ok := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Write([]byte("hello"))
+	}))
+	defer ok.Close()
+
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer failing.Close()
+
+	secure := httptest.NewTLSServer(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}))
+	defer secure.Close()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer listener.Close()
+
+	closed, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	closedAddr := closed.Addr().String()
+	closed.Close()
+
+	options, err := json.Marshal(probeOptions{Targets: []ProbeTarget{
+		{Name: "ok", HTTP: ok.URL},
+		{Name: "limited", HTTP: ok.URL, MaxBodyBytes: 3},
+		{Name: "failing", HTTP: failing.URL},
+		{Name: "expected", HTTP: failing.URL, ExpectStatus: []int{http.StatusServiceUnavailable}},
+		{Name: "secure", HTTP: secure.URL, InsecureSkipVerify: true},
+		{Name: "untrusted", HTTP: secure.URL},
+		{Name: "tcp", TCP: listener.Addr().String()},
+		{Name: "tcp-closed", TCP: closedAddr, Timeout: "1s"},
+	}})
+	require.NoError(t, err)
+
+	c, err := NewCollector("probe", Settings{Interval: 5 * time.Second, Options: options})
+	require.NoError(t, err)
+
+	store, err := c.Collect(context.Background())
+	require.NoError(t, err)
+
+	value := func(metric, target string) string {
+		m, ok := store[metric+`{target="`+target+`"}`]
+		require.True(t, ok, "%s for %s", metric, target)
+		return m.Value
+	}
+
+	for target, up := range map[string]string{
+		"ok": "1", "limited": "1", "failing": "0", "expected": "1", "secure": "1", "untrusted": "0", "tcp": "1", "tcp-closed": "0",
+	} {
+		assert.Equal(t, up, value("ProbeUp", target), target)
+		failures := "0"
+		if up == "0" {
+			failures = "1"
+		}
+		assert.Equal(t, failures, value("ProbeFailures", target), target)
+		assert.Contains(t, store, `ProbeDurationSeconds{target="`+target+`"}`)
+	}
+
+	assert.Equal(t, "200", value("ProbeStatusCode", "ok"))
+	assert.Equal(t, "5", value("ProbeResponseBytes", "ok"))
+	assert.Equal(t, "3", value("ProbeResponseBytes", "limited"))
+	assert.Equal(t, "503", value("ProbeStatusCode", "failing"))
+	assert.NotContains(t, store, `ProbeTLSCertExpiryDays{target="ok"}`)
+	assert.NotEmpty(t, value("ProbeTLSCertExpiryDays", "secure"))
+	assert.NotContains(t, store, `ProbeStatusCode{target="tcp"}`)
+}
+
+func TestProbeTarget_Validation(t *testing.T) {
+	for _, target := range []ProbeTarget{
+		{HTTP: "http://localhost"},
+		{Name: "none"},
+		{Name: "both", HTTP: "http://localhost", TCP: "localhost:80"},
+		{Name: "timeout", TCP: "localhost:80", Timeout: "soon"},
+		{Name: "method", HTTP: "http://localhost", Method: "BAD METHOD"},
+		{Name: "body", HTTP: "http://localhost", MaxBodyBytes: -1},
+	} {
+		assert.ErrorIs(t, target.init(time.Second), ErrInvalidProbeTarget, target.Name)
+	}
+}
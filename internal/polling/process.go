@@ -0,0 +1,271 @@
+package polling
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/shirou/gopsutil/v3/process"
+	"github.com/smartfor/metrics/internal/core"
+)
+
+// Коллектор process следит за процессами из списка targets. Метрики каждого процесса
+// отмечаются меткой process с именем цели:
+//
+//	ProcessUp          - 1, если найден хотя бы один подходящий процесс, иначе 0
+//	ProcessCount       - число подходящих процессов
+//	ProcessCPUPercent  - загрузка CPU с прошлого опроса, сумма по процессам
+//	ProcessRSS         - resident set size в байтах, сумма по процессам
+//	ProcessThreads     - число потоков, сумма по процессам
+//	ProcessOpenFDs     - открытые файловые дескрипторы, сумма по процессам
+//	ProcessRestarts    - counter перезапусков старейшего из подходящих процессов
+//
+// Пример параметров:
+//
+//	{"targets": [
+//	  {"name": "nginx", "process_name": "nginx"},
+//	  {"name": "api", "pidfile": "/run/api.pid"},
+//	  {"name": "worker", "cmdline": "worker .*--queue=mail"}
+//	]}
+
+var ErrInvalidProcessTarget = errors.New("invalid process target")
+
+// ProcessTarget - описание отслеживаемого процесса. Должен быть задан ровно один способ поиска.
+type ProcessTarget struct {
+	// Name - значение метки process
+	Name string `json:"name"`
+	// ProcessName - точное имя исполняемого файла процесса
+	ProcessName string `json:"process_name,omitempty"`
+	// Pidfile - файл с PID процесса
+	Pidfile string `json:"pidfile,omitempty"`
+	// Cmdline - регулярное выражение для командной строки процесса
+	Cmdline string `json:"cmdline,omitempty"`
+}
+
+type processOptions struct {
+	Targets []ProcessTarget `json:"targets"`
+}
+
+// processIdentity отличает перезапущенный процесс от прежнего, даже если ОС выдала ему тот же PID.
+type processIdentity struct {
+	pid       int32
+	createdAt int64
+}
+
+type processTarget struct {
+	ProcessTarget
+	cmdline *regexp.Regexp
+	// main - старейший из найденных при прошлом опросе процессов
+	main *processIdentity
+}
+
+type processCollector struct {
+	targets []*processTarget
+	// cache хранит процессы между опросами, чтобы считать загрузку CPU за интервал опроса
+	cache map[processIdentity]*process.Process
+}
+
+func newProcessCollector(s Settings) (Collector, error) {
+	var opts processOptions
+	if err := s.DecodeOptions(&opts); err != nil {
+		return nil, err
+	}
+
+	c := &processCollector{cache: make(map[processIdentity]*process.Process)}
+	for _, t := range opts.Targets {
+		target, err := newProcessTarget(t)
+		if err != nil {
+			return nil, err
+		}
+		c.targets = append(c.targets, target)
+	}
+
+	return NewFuncCollector("process", s.Interval, c.collect), nil
+}
+
+func newProcessTarget(t ProcessTarget) (*processTarget, error) {
+	if t.Name == "" {
+		return nil, fmt.Errorf("%w: name is required", ErrInvalidProcessTarget)
+	}
+
+	matchers := 0
+	for _, v := range []string{t.ProcessName, t.Pidfile, t.Cmdline} {
+		if v != "" {
+			matchers++
+		}
+	}
+	if matchers != 1 {
+		return nil, fmt.Errorf("%w %s: exactly one of process_name, pidfile or cmdline must be set", ErrInvalidProcessTarget, t.Name)
+	}
+
+	target := &processTarget{ProcessTarget: t}
+	if t.Cmdline != "" {
+		re, err := regexp.Compile(t.Cmdline)
+		if err != nil {
+			return nil, fmt.Errorf("%w %s: %w", ErrInvalidProcessTarget, t.Name, err)
+		}
+		target.cmdline = re
+	}
+
+	return target, nil
+}
+
+func (c *processCollector) collect(ctx context.Context) (MetricStore, error) {
+	var all []*process.Process
+	for _, t := range c.targets {
+		if t.Pidfile == "" {
+			var err error
+			if all, err = process.ProcessesWithContext(ctx); err != nil {
+				return nil, err
+			}
+			break
+		}
+	}
+
+	seen := make(map[processIdentity]bool)
+	store := make(MetricStore)
+	for _, t := range c.targets {
+		var matched []*process.Process
+		if t.Pidfile != "" {
+			matched = c.byPidfile(ctx, t.Pidfile)
+		} else {
+			matched = c.byMatch(ctx, t, all)
+		}
+
+		c.report(ctx, store, t, matched, seen)
+	}
+
+	// Процессы, которые больше не подходят ни под одну цель, не нужно хранить
+	for id := range c.cache {
+		if !seen[id] {
+			delete(c.cache, id)
+		}
+	}
+
+	return store, nil
+}
+
+func (c *processCollector) byPidfile(ctx context.Context, path string) []*process.Process {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil
+	}
+
+	pid, err := strconv.ParseInt(strings.TrimSpace(string(data)), 10, 32)
+	if err != nil {
+		return nil
+	}
+
+	p, err := process.NewProcessWithContext(ctx, int32(pid))
+	if err != nil {
+		return nil
+	}
+
+	return []*process.Process{p}
+}
+
+func (c *processCollector) byMatch(ctx context.Context, t *processTarget, all []*process.Process) []*process.Process {
+	var matched []*process.Process
+	for _, p := range all {
+		if t.ProcessName != "" {
+			name, err := p.NameWithContext(ctx)
+			if err == nil && name == t.ProcessName {
+				matched = append(matched, p)
+			}
+			continue
+		}
+
+		cmdline, err := p.CmdlineWithContext(ctx)
+		if err == nil && t.cmdline.MatchString(cmdline) {
+			matched = append(matched, p)
+		}
+	}
+
+	return matched
+}
+
+func (c *processCollector) report(ctx context.Context, store MetricStore, t *processTarget, matched []*process.Process, seen map[processIdentity]bool) {
+	var (
+		main                  *processIdentity
+		count                 int
+		cpu                   float64
+		rss, threads, openFDs int64
+	)
+
+	for _, p := range matched {
+		createdAt, err := p.CreateTimeWithContext(ctx)
+		if err != nil {
+			// Процесс завершился между поиском и опросом
+			continue
+		}
+
+		id := processIdentity{pid: p.Pid, createdAt: createdAt}
+		if cached, ok := c.cache[id]; ok {
+			p = cached
+		} else {
+			c.cache[id] = p
+		}
+		seen[id] = true
+		count++
+
+		if main == nil || id.createdAt < main.createdAt {
+			main = &id
+		}
+
+		if v, err := p.PercentWithContext(ctx, 0); err == nil {
+			cpu += v
+		}
+		if v, err := p.MemoryInfoWithContext(ctx); err == nil {
+			rss += int64(v.RSS)
+		}
+		if v, err := p.NumThreadsWithContext(ctx); err == nil {
+			threads += int64(v)
+		}
+		if v, err := p.NumFDsWithContext(ctx); err == nil {
+			openFDs += int64(v)
+		}
+	}
+
+	labels := core.Labels{"process": t.Name}
+
+	up := 0.0
+	if count > 0 {
+		up = 1
+	}
+	store.Add(gauge("ProcessUp", labels, up))
+	store.Add(gauge("ProcessCount", labels, float64(count)))
+	store.Add(counter("ProcessRestarts", labels, t.observe(main)))
+
+	if count == 0 {
+		return
+	}
+
+	store.Add(gauge("ProcessCPUPercent", labels, cpu))
+	store.Add(gauge("ProcessRSS", labels, float64(rss)))
+	store.Add(gauge("ProcessThreads", labels, float64(threads)))
+	store.Add(gauge("ProcessOpenFDs", labels, float64(openFDs)))
+}
+
+// observe запоминает текущий основной процесс цели и возвращает 1, если он сменился
+// с прошлого опроса, на котором процесс был найден.
+func (t *processTarget) observe(main *processIdentity) int64 {
+	if main == nil {
+		return 0
+	}
+
+	restarted := t.main != nil && *t.main != *main
+	t.main = main
+	if restarted {
+		return 1
+	}
+
+	return 0
+}
+
+func init() {
+	MustRegister("process", newProcessCollector)
+}
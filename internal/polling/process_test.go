@@ -0,0 +1,73 @@
+package polling
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestProcessCollector(t *testing.T) {
+	pidfile := filepath.Join(t.TempDir(), "test.pid")
+	require.NoError(t, os.WriteFile(pidfile, []byte(strconv.Itoa(os.Getpid())+"\n"), 0o600))
+
+	options, err := json.Marshal(processOptions{Targets: []ProcessTarget{
+		{Name: "self", Pidfile: pidfile},
+		{Name: "self-cmdline", Cmdline: regexp.QuoteMeta(filepath.Base(os.Args[0]))},
+		{Name: "missing", Pidfile: filepath.Join(t.TempDir(), "missing.pid")},
+	}})
+	require.NoError(t, err)
+
+	c, err := NewCollector("process", Settings{Interval: time.Second, Options: options})
+	require.NoError(t, err)
+
+	for i := 0; i < 2; i++ {
+		store, err := c.Collect(context.Background())
+		require.NoError(t, err)
+
+		for _, name := range []string{"self", "self-cmdline"} {
+			assert.Equal(t, "1", store[`ProcessUp{process="`+name+`"}`].Value, name)
+			assert.Equal(t, "0", store[`ProcessRestarts{process="`+name+`"}`].Value, name)
+			assert.NotEqual(t, "0", store[`ProcessRSS{process="`+name+`"}`].Value, name)
+			assert.NotEqual(t, "0", store[`ProcessThreads{process="`+name+`"}`].Value, name)
+		}
+
+		assert.Equal(t, "0", store[`ProcessUp{process="missing"}`].Value)
+		assert.NotContains(t, store, `ProcessRSS{process="missing"}`)
+	}
+}
+
+func TestProcessTarget(t *testing.T) {
+	t.Run("Validation", func(t *testing.T) {
+		for _, target := range []ProcessTarget{
+			{ProcessName: "nginx"},
+			{Name: "none"},
+			{Name: "both", ProcessName: "nginx", Pidfile: "/run/nginx.pid"},
+			{Name: "regexp", Cmdline: "("},
+		} {
+			_, err := newProcessTarget(target)
+			assert.ErrorIs(t, err, ErrInvalidProcessTarget, target.Name)
+		}
+	})
+
+	t.Run("Restarts", func(t *testing.T) {
+		target, err := newProcessTarget(ProcessTarget{Name: "api", ProcessName: "api"})
+		require.NoError(t, err)
+
+		first := &processIdentity{pid: 10, createdAt: 1}
+		restarted := &processIdentity{pid: 10, createdAt: 2}
+
+		assert.Equal(t, int64(0), target.observe(first))
+		assert.Equal(t, int64(0), target.observe(first))
+		assert.Equal(t, int64(0), target.observe(nil), "stopped process is not a restart yet")
+		assert.Equal(t, int64(1), target.observe(restarted))
+		assert.Equal(t, int64(0), target.observe(restarted))
+	})
+}
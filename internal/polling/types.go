@@ -6,13 +6,21 @@ import (
 )
 
 type MetricsModel struct {
-	Type  core.MetricType
-	Key   string
-	Value string
+	Labels core.Labels
+	Type   core.MetricType
+	Key    string
+	Value  string
 }
 
+// SeriesKey возвращает идентификатор серии метрики с учетом меток.
+// Под этим ключом метрика хранится в MetricStore.
+func (m MetricsModel) SeriesKey() string {
+	return core.MetricKey(m.Key, m.Labels)
+}
+
+// PollMessage - результат одного опроса коллектора
 type PollMessage struct {
-	Msg  MetricStore
-	Err  error
-	Type PollMessageType
+	Msg       MetricStore
+	Err       error
+	Collector string
 }
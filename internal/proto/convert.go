@@ -0,0 +1,74 @@
+package proto
+
+import (
+	"github.com/smartfor/metrics/internal/core"
+	"github.com/smartfor/metrics/internal/metrics"
+)
+
+// FromMetrics преобразует метрику формата JSON API в protobuf-сообщение.
+func FromMetrics(m metrics.Metrics) *Metric {
+	out := &Metric{
+		Id:     m.ID,
+		Type:   m.MType,
+		Labels: m.Labels,
+	}
+
+	if m.Value != nil {
+		out.Value = *m.Value
+	}
+
+	if m.Delta != nil {
+		out.Delta = *m.Delta
+	}
+
+	if m.Histogram != nil {
+		out.Histogram = &Histogram{
+			Bounds: m.Histogram.Bounds,
+			Counts: m.Histogram.Counts,
+			Sum:    m.Histogram.Sum,
+			Count:  m.Histogram.Count,
+		}
+	}
+
+	return out
+}
+
+// ToMetrics преобразует protobuf-сообщение в метрику формата JSON API.
+// Заполняется только значение, соответствующее типу метрики.
+func (x *Metric) ToMetrics() metrics.Metrics {
+	out := metrics.Metrics{
+		ID:     x.GetId(),
+		MType:  x.GetType(),
+		Labels: x.GetLabels(),
+	}
+
+	switch core.NewMetricType(x.GetType()) {
+	case core.Gauge:
+		value := x.GetValue()
+		out.Value = &value
+	case core.Counter:
+		delta := x.GetDelta()
+		out.Delta = &delta
+	case core.Histogram:
+		if h := x.GetHistogram(); h != nil {
+			out.Histogram = &core.HistogramValue{
+				Bounds: h.GetBounds(),
+				Counts: h.GetCounts(),
+				Sum:    h.GetSum(),
+				Count:  h.GetCount(),
+			}
+		}
+	}
+
+	return out
+}
+
+// MetricsFromProto преобразует список protobuf-сообщений в метрики формата JSON API.
+func MetricsFromProto(ms []*Metric) []metrics.Metrics {
+	out := make([]metrics.Metrics, 0, len(ms))
+	for _, m := range ms {
+		out = append(out, m.ToMetrics())
+	}
+
+	return out
+}
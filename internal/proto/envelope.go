@@ -0,0 +1,97 @@
+package proto
+
+import (
+	"encoding/hex"
+	"errors"
+
+	"github.com/smartfor/metrics/internal/crypto"
+	"github.com/smartfor/metrics/internal/utils"
+	gproto "google.golang.org/protobuf/proto"
+)
+
+var (
+	ErrNotEncrypted = errors.New("request is not encrypted")
+	ErrInvalidHash  = errors.New("invalid hash")
+)
+
+// payload сериализует metrics запроса - именно эти байты подписываются и шифруются.
+// Используется детерминированная сериализация, чтобы подпись совпадала на агенте и сервере.
+func payload(req *UpdateBatchRequest) ([]byte, error) {
+	return gproto.MarshalOptions{Deterministic: true}.Marshal(&UpdateBatchRequest{Metrics: req.GetMetrics()})
+}
+
+// Seal подписывает и шифрует пачку метрик перед отправкой.
+// Если задан secret, в hash записывается HMAC-SHA256 сериализованных метрик,
+// если задан publicKey, метрики переносятся в encrypted по гибридной схеме из пакета crypto.
+func Seal(req *UpdateBatchRequest, secret string, publicKey []byte) error {
+	if secret == "" && publicKey == nil {
+		return nil
+	}
+
+	body, err := payload(req)
+	if err != nil {
+		return err
+	}
+
+	if secret != "" {
+		req.Hash = hex.EncodeToString(utils.Sign(body, secret).Sum(nil))
+	}
+
+	if publicKey != nil {
+		encrypted, key, err := crypto.EncryptWithPublicKey(body, publicKey)
+		if err != nil {
+			return err
+		}
+
+		req.Metrics = nil
+		req.Encrypted = encrypted
+		req.Key = key
+	}
+
+	return nil
+}
+
+// Open расшифровывает и проверяет подпись пачки метрик, полученной сервером.
+// Если у сервера задан privateKey, незашифрованные запросы отклоняются.
+// Запросы без подписи пропускаются так же, как в HTTP middleware проверки подписи.
+func Open(req *UpdateBatchRequest, secret string, privateKey []byte) error {
+	if privateKey != nil {
+		if req.GetEncrypted() == nil {
+			return ErrNotEncrypted
+		}
+
+		body, err := crypto.DecryptWithPrivateKey(req.GetEncrypted(), req.GetKey(), privateKey)
+		if err != nil {
+			return err
+		}
+
+		var decrypted UpdateBatchRequest
+		if err := gproto.Unmarshal(body, &decrypted); err != nil {
+			return err
+		}
+
+		req.Metrics = decrypted.GetMetrics()
+		req.Encrypted = nil
+		req.Key = nil
+	}
+
+	if secret == "" || req.GetHash() == "" {
+		return nil
+	}
+
+	hash, err := hex.DecodeString(req.GetHash())
+	if err != nil {
+		return err
+	}
+
+	body, err := payload(req)
+	if err != nil {
+		return err
+	}
+
+	if !utils.Verify(secret, string(hash), body) {
+		return ErrInvalidHash
+	}
+
+	return nil
+}
@@ -0,0 +1,204 @@
+// Package push содержит локальный сервер агента, в который приложения хоста отправляют свои метрики.
+// Агент пересылает их на сервер вместе с собственными метриками, поэтому приложениям не нужны
+// ни ключ подписи, ни публичный ключ сервера.
+package push
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/smartfor/metrics/internal/core"
+	"github.com/smartfor/metrics/internal/metrics"
+	"github.com/smartfor/metrics/internal/polling"
+	"github.com/smartfor/metrics/internal/server/utils"
+)
+
+// CollectorName - имя, под которым сервер работает как коллектор агента
+const CollectorName = "push"
+
+var ErrNoListeners = errors.New("neither push address nor push socket is set")
+
+// Server принимает метрики в формате JSON API по HTTP на localhost и/или Unix-сокете
+// и копит их до следующего опроса через Collect: приращения counter и наблюдения histogram
+// суммируются, для gauge сохраняется последнее значение, которое отправляется в каждом отчете.
+type Server struct {
+	address  string
+	socket   string
+	interval time.Duration
+
+	server    *http.Server
+	listeners []net.Listener
+	wg        sync.WaitGroup
+
+	mu      sync.Mutex
+	pending core.BaseMetricStorage
+}
+
+// NewServer создает сервер на TCP-адресе address и/или Unix-сокете socket.
+// Пустое значение отключает соответствующий способ подключения.
+// Накопленные метрики забираются агентом каждые interval.
+func NewServer(address string, socket string, interval time.Duration) *Server {
+	s := &Server{
+		address:  address,
+		socket:   socket,
+		interval: interval,
+		pending:  core.NewBaseMetricStorage(),
+	}
+
+	r := chi.NewRouter()
+	r.Post("/update/", s.handleUpdate)
+	r.Post("/updates/", s.handleUpdates)
+	s.server = &http.Server{Handler: r, ReadHeaderTimeout: 5 * time.Second}
+
+	return s
+}
+
+// Start открывает сокеты и начинает принимать метрики в фоне.
+// Оставшийся от прошлого запуска файл Unix-сокета удаляется.
+func (s *Server) Start() error {
+	if s.address == "" && s.socket == "" {
+		return ErrNoListeners
+	}
+
+	if s.address != "" {
+		l, err := net.Listen("tcp", s.address)
+		if err != nil {
+			return err
+		}
+		s.listeners = append(s.listeners, l)
+	}
+
+	if s.socket != "" {
+		if err := os.Remove(s.socket); err != nil && !errors.Is(err, os.ErrNotExist) {
+			s.closeListeners()
+			return err
+		}
+
+		l, err := net.Listen("unix", s.socket)
+		if err != nil {
+			s.closeListeners()
+			return err
+		}
+		s.listeners = append(s.listeners, l)
+	}
+
+	for _, l := range s.listeners {
+		s.wg.Add(1)
+		go func(l net.Listener) {
+			defer s.wg.Done()
+			_ = s.server.Serve(l)
+		}(l)
+	}
+
+	return nil
+}
+
+// Addr возвращает TCP-адрес сервера после Start, nil если он не слушает TCP.
+func (s *Server) Addr() net.Addr {
+	for _, l := range s.listeners {
+		if l.Addr().Network() == "tcp" {
+			return l.Addr()
+		}
+	}
+
+	return nil
+}
+
+// Shutdown дожидается обработки текущих запросов и закрывает сокеты.
+func (s *Server) Shutdown(ctx context.Context) error {
+	err := s.server.Shutdown(ctx)
+	s.wg.Wait()
+
+	return err
+}
+
+func (s *Server) closeListeners() {
+	for _, l := range s.listeners {
+		l.Close()
+	}
+	s.listeners = nil
+}
+
+// Name реализует polling.Collector.
+func (s *Server) Name() string {
+	return CollectorName
+}
+
+// Interval реализует polling.Collector.
+func (s *Server) Interval() time.Duration {
+	return s.interval
+}
+
+// Collect реализует polling.Collector: возвращает накопленные метрики и сбрасывает
+// counter и histogram. Значения gauge остаются до следующего обновления.
+func (s *Server) Collect(context.Context) (polling.MetricStore, error) {
+	s.mu.Lock()
+	batch := s.pending
+	gauges := make(map[string]float64, len(batch.Gauges()))
+	for k, v := range batch.Gauges() {
+		gauges[k] = v
+	}
+	s.pending = core.NewBaseMetricStorageWithValues(gauges, make(map[string]int64), make(map[string]core.HistogramValue))
+	s.mu.Unlock()
+
+	store := make(polling.MetricStore)
+	for _, m := range metrics.FromBaseStorage(&batch) {
+		model, err := metrics.ToMetricModel(m)
+		if err != nil {
+			return nil, err
+		}
+		store[model.SeriesKey()] = model
+	}
+
+	return store, nil
+}
+
+func (s *Server) handleUpdate(w http.ResponseWriter, r *http.Request) {
+	var m metrics.Metrics
+	if err := json.NewDecoder(r.Body).Decode(&m); err != nil {
+		utils.WriteError(w, err, http.StatusBadRequest)
+		return
+	}
+
+	s.add(w, []metrics.Metrics{m})
+}
+
+func (s *Server) handleUpdates(w http.ResponseWriter, r *http.Request) {
+	var ms []metrics.Metrics
+	if err := json.NewDecoder(r.Body).Decode(&ms); err != nil {
+		utils.WriteError(w, err, http.StatusBadRequest)
+		return
+	}
+
+	s.add(w, ms)
+}
+
+// add проверяет пачку целиком и только потом добавляет ее к накопленным метрикам.
+func (s *Server) add(w http.ResponseWriter, ms []metrics.Metrics) {
+	batch, err := metrics.ToBatch(ms)
+	if err != nil {
+		utils.WriteError(w, err, http.StatusBadRequest)
+		return
+	}
+
+	s.mu.Lock()
+	for k, v := range batch.Gauges() {
+		s.pending.SetGauge(k, v)
+	}
+	for k, v := range batch.Counters() {
+		s.pending.SetCounter(k, v)
+	}
+	for k, v := range batch.Histograms() {
+		s.pending.SetHistogram(k, v)
+	}
+	s.mu.Unlock()
+
+	w.WriteHeader(http.StatusOK)
+}
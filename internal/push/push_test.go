@@ -0,0 +1,60 @@
+package push
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func post(t *testing.T, client *http.Client, url string, body string) int {
+	resp, err := client.Post(url, "application/json", strings.NewReader(body))
+	require.NoError(t, err)
+	resp.Body.Close()
+
+	return resp.StatusCode
+}
+
+func TestServer(t *testing.T) {
+	socket := filepath.Join(t.TempDir(), "push.sock")
+	s := NewServer("127.0.0.1:0", socket, time.Second)
+	require.NoError(t, s.Start())
+	defer s.Shutdown(context.Background())
+
+	base := "http://" + s.Addr().String()
+	unixClient := &http.Client{Transport: &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			return (&net.Dialer{}).DialContext(ctx, "unix", socket)
+		},
+	}}
+
+	assert.Equal(t, http.StatusOK, post(t, http.DefaultClient, base+"/update/", `{"id": "jobs", "type": "counter", "delta": 2}`))
+	assert.Equal(t, http.StatusOK, post(t, unixClient, "http://agent/updates/", `[
+		{"id": "jobs", "type": "counter", "delta": 3},
+		{"id": "queue", "type": "gauge", "value": 1, "labels": {"name": "mail"}},
+		{"id": "queue", "type": "gauge", "value": 4, "labels": {"name": "mail"}}
+	]`))
+	assert.Equal(t, http.StatusBadRequest, post(t, http.DefaultClient, base+"/update/", `{"id": "jobs", "type": "counter"}`))
+	assert.Equal(t, http.StatusBadRequest, post(t, http.DefaultClient, base+"/updates/", `not json`))
+
+	store, err := s.Collect(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, "5", store["jobs"].Value)
+	assert.Equal(t, "4", store[`queue{name="mail"}`].Value)
+
+	// Counter сбрасывается после отчета, последнее значение gauge сохраняется
+	store, err = s.Collect(context.Background())
+	require.NoError(t, err)
+	assert.NotContains(t, store, "jobs")
+	assert.Equal(t, "4", store[`queue{name="mail"}`].Value)
+}
+
+func TestServer_NoListeners(t *testing.T) {
+	assert.ErrorIs(t, NewServer("", "", time.Second).Start(), ErrNoListeners)
+}
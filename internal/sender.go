@@ -0,0 +1,137 @@
+package internal
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"net/http"
+	"strconv"
+
+	"github.com/go-resty/resty/v2"
+	"github.com/smartfor/metrics/internal/config"
+	"github.com/smartfor/metrics/internal/core"
+	"github.com/smartfor/metrics/internal/crypto"
+	"github.com/smartfor/metrics/internal/metrics"
+	"github.com/smartfor/metrics/internal/utils"
+)
+
+var (
+	// ErrBatchRejected Ошибка при отказе сервера принять пачку. Повторная отправка той же пачки не поможет.
+	ErrBatchRejected = errors.New("batch rejected by server")
+	// ErrServerUnavailable Ошибка при временной недоступности сервера, пачку нужно отправить повторно
+	ErrServerUnavailable = errors.New("server unavailable")
+)
+
+// Sender - транспорт доставки пачки метрик на сервер
+type Sender interface {
+	// Send - отправка пачки метрик с повторами при ошибках.
+	// Все попытки отправки идут с идентификатором id, чтобы сервер не применил пачку дважды.
+	Send(ctx context.Context, id core.BatchID, batch []metrics.Metrics) error
+	// Close - освобождение ресурсов транспорта
+	Close() error
+}
+
+// HTTPSender - отправка метрик в JSON со сжатием gzip на ендпоинт UpdateBatchURL
+type HTTPSender struct {
+	client    *resty.Client
+	secret    string
+	publicKey []byte
+	retry     *utils.RetryConfig
+}
+
+func NewHTTPSender(cfg *config.Config, publicKey []byte) *HTTPSender {
+	client := resty.
+		New().
+		SetBaseURL(cfg.HostEndpoint).
+		SetHeader("Content-Type", "application/json").
+		SetTimeout(cfg.ResponseTimeoutDuration)
+
+	return &HTTPSender{
+		client:    client,
+		secret:    cfg.Secret,
+		publicKey: publicKey,
+	}
+}
+
+func (h *HTTPSender) Send(ctx context.Context, id core.BatchID, batch []metrics.Metrics) error {
+	var (
+		err        error
+		body       []byte
+		key        []byte
+		compressed []byte
+		sign       hash.Hash
+		hexHash    string
+	)
+
+	if body, err = json.Marshal(batch); err != nil {
+		fmt.Println("Marshalling batch error: ", err)
+		return err
+	}
+
+	if h.secret != "" {
+		sign = utils.Sign(body, h.secret)
+		hexHash = hex.EncodeToString(sign.Sum(nil))
+	}
+
+	if h.publicKey != nil {
+		body, key, err = crypto.EncryptWithPublicKey(body, h.publicKey)
+		if err != nil {
+			fmt.Println("Encryption error: ", err)
+			return err
+		}
+	}
+
+	if compressed, err = utils.GzipCompress(body); err != nil {
+		fmt.Println("Compressed body error: ", err)
+		return err
+	}
+
+	resp, err := utils.Retry(func() (*resty.Response, error) {
+		r := h.client.R().
+			SetContext(ctx).
+			SetHeader("Content-Type", "application/json").
+			SetHeader("Accept-Encoding", "gzip").
+			SetHeader("Content-Encoding", "gzip").
+			SetHeader(utils.AgentIDHeader, id.AgentID).
+			SetHeader(utils.IdempotencyKeyHeader, id.Key).
+			SetHeader(utils.BatchSeqHeader, strconv.FormatUint(id.Seq, 10)).
+			SetBody(compressed)
+
+		if h.publicKey != nil {
+			r = r.SetHeader(utils.CryptoKey, hex.EncodeToString(key))
+		}
+
+		if h.secret != "" {
+			r = r.SetHeader(utils.AuthHeaderName, hexHash)
+		}
+
+		resp, err := r.Post(UpdateBatchURL)
+		if err == nil && retryableStatus(resp.StatusCode()) {
+			err = fmt.Errorf("%w: %s", ErrServerUnavailable, resp.Status())
+		}
+		return resp, err
+	}, h.retry)
+	if err != nil {
+		return err
+	}
+
+	if resp.IsError() {
+		return fmt.Errorf("%w: %s", ErrBatchRejected, resp.Status())
+	}
+
+	return nil
+}
+
+// retryableStatus - ответы, после которых пачку стоит отправить повторно
+func retryableStatus(code int) bool {
+	return code >= http.StatusInternalServerError ||
+		code == http.StatusRequestTimeout ||
+		code == http.StatusTooManyRequests
+}
+
+func (h *HTTPSender) Close() error {
+	return nil
+}
@@ -0,0 +1,93 @@
+package internal
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/smartfor/metrics/internal/config"
+	"github.com/smartfor/metrics/internal/core"
+	"github.com/smartfor/metrics/internal/metrics"
+	pb "github.com/smartfor/metrics/internal/proto"
+	"github.com/smartfor/metrics/internal/utils"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	gproto "google.golang.org/protobuf/proto"
+)
+
+// GRPCSender - отправка метрик вызовом UpdateBatch gRPC-сервиса Metrics
+type GRPCSender struct {
+	conn   *grpc.ClientConn
+	client pb.MetricsClient
+	config config.Config
+}
+
+func NewGRPCSender(cfg *config.Config, publicKey []byte) (*GRPCSender, error) {
+	conn, err := grpc.NewClient(
+		cfg.GRPCAddress,
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithUnaryInterceptor(MakeEnvelopeClientInterceptor(cfg.Secret, publicKey)),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return &GRPCSender{
+		conn:   conn,
+		client: pb.NewMetricsClient(conn),
+		config: *cfg,
+	}, nil
+}
+
+func (g *GRPCSender) Send(ctx context.Context, id core.BatchID, batch []metrics.Metrics) error {
+	req := &pb.UpdateBatchRequest{
+		AgentId:        id.AgentID,
+		IdempotencyKey: id.Key,
+		Seq:            id.Seq,
+	}
+	for _, m := range batch {
+		req.Metrics = append(req.Metrics, pb.FromMetrics(m))
+	}
+
+	_, err := utils.Retry(func() (*pb.UpdateBatchResponse, error) {
+		ctx, cancel := context.WithTimeout(ctx, g.config.ResponseTimeoutDuration)
+		defer cancel()
+
+		return g.client.UpdateBatch(ctx, req)
+	}, nil)
+
+	switch status.Code(err) {
+	case codes.InvalidArgument, codes.Unauthenticated, codes.PermissionDenied:
+		return fmt.Errorf("%w: %w", ErrBatchRejected, err)
+	}
+
+	return err
+}
+
+func (g *GRPCSender) Close() error {
+	return g.conn.Close()
+}
+
+// MakeEnvelopeClientInterceptor - перехватчик, подписывающий и шифрующий пачку метрик перед отправкой.
+// Запрос копируется, чтобы повторная отправка того же запроса не шифровала его дважды.
+func MakeEnvelopeClientInterceptor(secret string, publicKey []byte) grpc.UnaryClientInterceptor {
+	return func(
+		ctx context.Context,
+		method string,
+		req, reply any,
+		cc *grpc.ClientConn,
+		invoker grpc.UnaryInvoker,
+		opts ...grpc.CallOption,
+	) error {
+		if batch, ok := req.(*pb.UpdateBatchRequest); ok {
+			sealed := gproto.Clone(batch).(*pb.UpdateBatchRequest)
+			if err := pb.Seal(sealed, secret, publicKey); err != nil {
+				return err
+			}
+			req = sealed
+		}
+
+		return invoker(ctx, method, req, reply, cc, opts...)
+	}
+}
@@ -0,0 +1,145 @@
+package internal
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/smartfor/metrics/internal/core"
+	"github.com/smartfor/metrics/internal/metrics"
+	"github.com/smartfor/metrics/internal/spool"
+)
+
+// spooledBatch - пачка метрик в дисковой очереди вместе с идентификатором,
+// чтобы повтор после перезапуска агента сервер распознал как уже примененный.
+type spooledBatch struct {
+	AgentID string            `json:"agent_id"`
+	Key     string            `json:"key"`
+	Seq     uint64            `json:"seq"`
+	Metrics []metrics.Metrics `json:"metrics"`
+}
+
+// SpoolSender - транспорт, который сначала сохраняет пачку в дисковую очередь, а отправляет ее
+// транспортом next в фоне. Пачки отправляются строго в порядке записи: пока сервер недоступен,
+// они копятся на диске и отправляются, когда связь восстановится, в том числе после перезапуска агента.
+type SpoolSender struct {
+	next          Sender
+	spool         *spool.Spool
+	retryInterval time.Duration
+	notify        chan struct{}
+	cancel        context.CancelFunc
+	done          chan struct{}
+}
+
+// NewSpoolSender запускает фоновую отправку очереди s транспортом next.
+// После неудачной отправки следующая попытка делается через retryInterval или при появлении новой пачки.
+func NewSpoolSender(next Sender, s *spool.Spool, retryInterval time.Duration) *SpoolSender {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	sender := &SpoolSender{
+		next:          next,
+		spool:         s,
+		retryInterval: retryInterval,
+		notify:        make(chan struct{}, 1),
+		cancel:        cancel,
+		done:          make(chan struct{}),
+	}
+
+	go sender.run(ctx)
+
+	return sender
+}
+
+// Send сохраняет пачку в очередь. Ошибка возвращается, только если пачку не удалось записать на диск.
+func (s *SpoolSender) Send(_ context.Context, id core.BatchID, batch []metrics.Metrics) error {
+	payload, err := json.Marshal(spooledBatch{
+		AgentID: id.AgentID,
+		Key:     id.Key,
+		Seq:     id.Seq,
+		Metrics: batch,
+	})
+	if err != nil {
+		return err
+	}
+
+	if err := s.spool.Append(payload); err != nil {
+		return err
+	}
+
+	select {
+	case s.notify <- struct{}{}:
+	default:
+	}
+
+	return nil
+}
+
+// Close останавливает фоновую отправку. Неотправленные пачки остаются в очереди до следующего запуска.
+func (s *SpoolSender) Close() error {
+	s.cancel()
+	<-s.done
+
+	return errors.Join(s.spool.Close(), s.next.Close())
+}
+
+func (s *SpoolSender) run(ctx context.Context) {
+	defer close(s.done)
+
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-s.notify:
+		case <-timer.C:
+		}
+
+		if err := s.flush(ctx); err != nil && ctx.Err() == nil {
+			log.Printf("Spool flush failed: %v", err)
+		}
+
+		timer.Reset(s.retryInterval)
+	}
+}
+
+// flush отправляет пачки из очереди по одной, пока очередь не опустеет или отправка не завершится ошибкой.
+// Пачки, которые сервер отверг (ErrBatchRejected), удаляются из очереди, остальные ошибки оставляют пачку в ней.
+func (s *SpoolSender) flush(ctx context.Context) error {
+	for ctx.Err() == nil {
+		payload, err := s.spool.Peek()
+		if errors.Is(err, spool.ErrEmpty) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		var entry spooledBatch
+		if err := json.Unmarshal(payload, &entry); err != nil {
+			log.Printf("Skip unreadable spooled batch: %v", err)
+			if err := s.spool.Ack(); err != nil {
+				return err
+			}
+			continue
+		}
+
+		id := core.BatchID{AgentID: entry.AgentID, Key: entry.Key, Seq: entry.Seq}
+		err = s.next.Send(ctx, id, entry.Metrics)
+		if errors.Is(err, ErrBatchRejected) {
+			// Отвергнутая пачка не должна навсегда задерживать очередь
+			log.Printf("Drop spooled batch %s rejected by server: %v", entry.Key, err)
+		} else if err != nil {
+			return err
+		}
+
+		if err := s.spool.Ack(); err != nil {
+			return err
+		}
+	}
+
+	return ctx.Err()
+}
@@ -0,0 +1,87 @@
+package internal
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/smartfor/metrics/internal/config"
+	"github.com/smartfor/metrics/internal/core"
+	"github.com/smartfor/metrics/internal/metrics"
+	"github.com/smartfor/metrics/internal/spool"
+	"github.com/smartfor/metrics/internal/utils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// sentSender сообщает о каждой завершенной отправке
+type sentSender struct {
+	Sender
+	sent chan error
+}
+
+func (s *sentSender) Send(ctx context.Context, id core.BatchID, batch []metrics.Metrics) error {
+	err := s.Sender.Send(ctx, id, batch)
+	s.sent <- err
+	return err
+}
+
+func TestSpoolSenderServerErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		status int
+		queued bool
+	}{
+		{name: "Server unavailable keeps batch", status: http.StatusServiceUnavailable, queued: true},
+		{name: "Rejected batch is dropped", status: http.StatusBadRequest, queued: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(tt.status)
+			}))
+			defer server.Close()
+
+			httpSender := NewHTTPSender(&config.Config{
+				HostEndpoint:            server.URL,
+				ResponseTimeoutDuration: time.Second,
+			}, nil)
+			httpSender.retry = &utils.RetryConfig{
+				Attempts:         1,
+				IncrementDelayFn: func(prev time.Duration) time.Duration { return prev },
+			}
+
+			dir := t.TempDir()
+			s, err := spool.Open(spool.Config{Dir: dir})
+			require.NoError(t, err)
+
+			next := &sentSender{Sender: httpSender, sent: make(chan error, 1)}
+			sender := NewSpoolSender(next, s, time.Hour)
+			value := 1.0
+			batch := []metrics.Metrics{{ID: "Alloc", MType: "gauge", Value: &value}}
+			require.NoError(t, sender.Send(context.Background(), core.BatchID{AgentID: "agent", Key: "1", Seq: 1}, batch))
+
+			select {
+			case err := <-next.sent:
+				require.Error(t, err)
+			case <-time.After(5 * time.Second):
+				t.Fatal("batch was not sent")
+			}
+			require.NoError(t, sender.Close())
+
+			s, err = spool.Open(spool.Config{Dir: dir})
+			require.NoError(t, err)
+			defer s.Close()
+
+			_, err = s.Peek()
+			if tt.queued {
+				assert.NoError(t, err, "batch must stay in spool")
+			} else {
+				assert.ErrorIs(t, err, spool.ErrEmpty)
+			}
+		})
+	}
+}
@@ -0,0 +1,71 @@
+package internal
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const (
+	// batchSeqFile - файл в каталоге очереди с границей зарезервированных номеров пачек
+	batchSeqFile = "batch_seq"
+	// batchSeqReserve - количество номеров, резервируемых одной записью файла
+	batchSeqReserve = 256
+)
+
+// batchSequence выдает порядковые номера пачек агента, начиная с 1.
+// Если задан каталог, номера растут и между перезапусками: в файл записывается граница резерва,
+// и после перезапуска выдача продолжается с нее. Неиспользованные номера резерва пропускаются.
+type batchSequence struct {
+	mu       *sync.Mutex
+	path     string
+	last     uint64
+	reserved uint64
+}
+
+func newBatchSequence(dir string) (*batchSequence, error) {
+	s := &batchSequence{mu: &sync.Mutex{}}
+	if dir == "" {
+		return s, nil
+	}
+
+	s.path = filepath.Join(dir, batchSeqFile)
+	data, err := os.ReadFile(s.path)
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+	case err != nil:
+		return nil, err
+	default:
+		s.last, err = strconv.ParseUint(strings.TrimSpace(string(data)), 10, 64)
+		if err != nil {
+			return nil, err
+		}
+		s.reserved = s.last
+	}
+
+	return s, nil
+}
+
+// Next возвращает следующий номер пачки.
+func (s *batchSequence) Next() (uint64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.path != "" && s.last >= s.reserved {
+		reserved := s.last + batchSeqReserve
+		tmp := s.path + ".tmp"
+		if err := os.WriteFile(tmp, []byte(strconv.FormatUint(reserved, 10)+"\n"), 0o600); err != nil {
+			return 0, err
+		}
+		if err := os.Rename(tmp, s.path); err != nil {
+			return 0, err
+		}
+		s.reserved = reserved
+	}
+
+	s.last++
+	return s.last, nil
+}
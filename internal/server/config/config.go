@@ -7,6 +7,8 @@ import (
 	"flag"
 	"fmt"
 	"os"
+	"path"
+	"strings"
 	"time"
 
 	"github.com/smartfor/metrics/internal/cfgutils"
@@ -19,6 +21,13 @@ var (
 
 	// ErrUnknownArguments Ошибка при передаче несуществующиего параметра конфигурации
 	ErrUnknownArguments = errors.New(fmt.Sprint("unknown flags:", flag.Args()))
+
+	// ErrInvalidFlushInterval Ошибка при неположительном интервале записи метрик StatsD
+	ErrInvalidFlushInterval = errors.New("invalid statsd flush interval")
+	// ErrInvalidSnapshotGenerations Ошибка при количестве снимков файлового хранилища меньше одного
+	ErrInvalidSnapshotGenerations = errors.New("snapshot generations must be at least 1")
+	// ErrInvalidInfluxGaugeField Ошибка при некорректном шаблоне имени целочисленного gauge InfluxDB
+	ErrInvalidInfluxGaugeField = errors.New("invalid influx gauge field pattern")
 )
 
 // Config Конфигурация сервера
@@ -29,6 +38,12 @@ type Config struct {
 	LogLevel string `json:"log_level"`
 	// FileStoragePath путь к файловому хранилищу метрик
 	FileStoragePath string `json:"file_storage_path"`
+	// SnapshotGenerations количество хранимых снимков файлового хранилища вместе с текущим
+	SnapshotGenerations int `json:"snapshot_generations"`
+	// SnapshotFormat формат снимков файлового хранилища: json или binary
+	SnapshotFormat string `json:"snapshot_format"`
+	// SnapshotCompression сжатие снимков файлового хранилища: none, gzip или zstd
+	SnapshotCompression string `json:"snapshot_compression"`
 	// DatabaseDSN строка подключения к базе данных хранения метрик
 	DatabaseDSN string `json:"database_dsn"`
 	// Secret секретный код для создания и идентификации ключа аутентификации клиентов
@@ -39,19 +54,41 @@ type Config struct {
 	Restore bool `json:"restore"`
 	// CryptoKey путь к ключу для шифрования данных
 	CryptoKey string `json:"crypto_key"`
+	// GRPCAddress адрес gRPC-сервера, если пустой - gRPC-сервер не запускается
+	GRPCAddress string `json:"grpc_address"`
+	// StatsDAddress адрес UDP-сокета приема метрик StatsD, если пустой - прием StatsD выключен
+	StatsDAddress string `json:"statsd_address"`
+	// StatsDFlushInterval интервал записи накопленных метрик StatsD в хранилище
+	StatsDFlushInterval string `json:"statsd_flush_interval"` // as string 1s, 1m, 1h
+	// GraphiteAddress адрес TCP-сокета приема метрик Graphite plaintext, если пустой - прием Graphite выключен
+	GraphiteAddress string `json:"graphite_address"`
+	// InfluxGaugeFields шаблоны имен measurement_field через запятую, целочисленные поля InfluxDB с такими
+	// именами записываются как gauge, остальные - как накопительные счетчики
+	InfluxGaugeFields string `json:"influx_gauge_fields"`
+	// HistorySize количество последних значений каждой серии, хранимых в памяти для запросов истории
+	HistorySize int `json:"history_size"`
 	// StoreIntervalDuration - StoreInterval as time.Duration
 	StoreIntervalDuration time.Duration
+	// StatsDFlushIntervalDuration - StatsDFlushInterval as time.Duration
+	StatsDFlushIntervalDuration time.Duration
+	// InfluxGaugeFieldsList - InfluxGaugeFields as list
+	InfluxGaugeFieldsList []string
 }
 
 // GetConfig Функция для получения конфигурации сервера.
 // Если параметры не найдены в переменных окружения то берутся значения из флагов либо значения по умолчанию
 func GetConfig() (*Config, error) {
 	config := &Config{
-		Addr:            ":8080",
-		LogLevel:        "info",
-		FileStoragePath: "/tmp/metrics-db.json",
-		StoreInterval:   "300s",
-		Restore:         true,
+		Addr:                ":8080",
+		LogLevel:            "info",
+		FileStoragePath:     "/tmp/metrics-db.json",
+		SnapshotGenerations: 3,
+		SnapshotFormat:      "json",
+		SnapshotCompression: "none",
+		StoreInterval:       "300s",
+		Restore:             true,
+		HistorySize:         1024,
+		StatsDFlushInterval: "10s",
 	}
 
 	// resolve config path
@@ -78,10 +115,47 @@ func GetConfig() (*Config, error) {
 
 	cfgutils.ParseString("l", "LOG_LEVEL", "log level", &config.LogLevel)
 	cfgutils.ParseString("f", "FILE_STORAGE_PATH", "file storage path", &config.FileStoragePath)
+	cfgutils.ParseInt("snapshot-generations", "SNAPSHOT_GENERATIONS", "number of file storage snapshots to keep", &config.SnapshotGenerations)
+	if config.SnapshotGenerations < 1 {
+		return nil, ErrInvalidSnapshotGenerations
+	}
+	cfgutils.ParseString("snapshot-format", "SNAPSHOT_FORMAT", "file storage snapshot format: json or binary", &config.SnapshotFormat)
+	cfgutils.ParseString("snapshot-compression", "SNAPSHOT_COMPRESSION", "file storage snapshot compression: none, gzip or zstd", &config.SnapshotCompression)
 	cfgutils.ParseBool("r", "RESTORE", "restore metrics when server starts", &config.Restore)
 	cfgutils.ParseString("d", "DATABASE_DSN", "database DSN", &config.DatabaseDSN)
 	cfgutils.ParseString("k", "KEY", "very very very secret key", &config.Secret)
 	cfgutils.ParseString("crypto-key", "CRYPTO_KEY", "Crypto key", &config.CryptoKey)
+	cfgutils.ParseString("grpc-address", "GRPC_ADDRESS", "address and port to run gRPC server", &config.GRPCAddress)
+	if config.GRPCAddress != "" {
+		if err := utils.ValidateAddress(config.GRPCAddress); err != nil {
+			return nil, err
+		}
+	}
+	cfgutils.ParseString("statsd-address", "STATSD_ADDRESS", "address and port to receive StatsD metrics (udp)", &config.StatsDAddress)
+	if config.StatsDAddress != "" {
+		if err := utils.ValidateAddress(config.StatsDAddress); err != nil {
+			return nil, err
+		}
+	}
+	cfgutils.ParseString("statsd-flush-interval", "STATSD_FLUSH_INTERVAL", "StatsD metrics flush interval", &config.StatsDFlushInterval)
+	cfgutils.ParseString("graphite-address", "GRAPHITE_ADDRESS", "address and port to receive Graphite plaintext metrics (tcp)", &config.GraphiteAddress)
+	if config.GraphiteAddress != "" {
+		if err := utils.ValidateAddress(config.GraphiteAddress); err != nil {
+			return nil, err
+		}
+	}
+	cfgutils.ParseString("influx-gauge-fields", "INFLUX_GAUGE_FIELDS", "comma separated name patterns of InfluxDB integer fields written as gauges instead of counters", &config.InfluxGaugeFields)
+	for _, pattern := range strings.Split(config.InfluxGaugeFields, ",") {
+		pattern = strings.TrimSpace(pattern)
+		if pattern == "" {
+			continue
+		}
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("%w: %s", ErrInvalidInfluxGaugeField, pattern)
+		}
+		config.InfluxGaugeFieldsList = append(config.InfluxGaugeFieldsList, pattern)
+	}
+	cfgutils.ParseInt("history-size", "HISTORY_SIZE", "number of samples kept in memory per series", &config.HistorySize)
 	err := cfgutils.ParseStringWithValidator("a", "ADDRESS", "address and port to run server", &config.Addr, utils.ValidateAddress)
 	if err != nil {
 		return nil, err
@@ -94,5 +168,14 @@ func GetConfig() (*Config, error) {
 	}
 	config.StoreIntervalDuration = val
 
+	val, err = time.ParseDuration(config.StatsDFlushInterval)
+	if err != nil {
+		return nil, err
+	}
+	if val <= 0 {
+		return nil, ErrInvalidFlushInterval
+	}
+	config.StatsDFlushIntervalDuration = val
+
 	return config, nil
 }
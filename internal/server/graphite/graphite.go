@@ -0,0 +1,296 @@
+// Package graphite содержит прием метрик по протоколу Graphite plaintext через TCP.
+// Каждая точка записывается в core.Storage как gauge.
+package graphite
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"io"
+	"math"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/smartfor/metrics/internal/core"
+	"go.uber.org/zap"
+)
+
+var (
+	ErrBadLine      = errors.New("malformed graphite line")
+	ErrBadValue     = errors.New("bad graphite value")
+	ErrBadTimestamp = errors.New("bad graphite timestamp")
+
+	errLineTooLong = errors.New("line too long")
+)
+
+const (
+	// MalformedLinesMetric - счетчик отброшенных строк, записывается в хранилище вместе с точками
+	MalformedLinesMetric = "graphite_malformed_lines"
+	// maxLineLength - размер буфера чтения соединения, строки длиннее отбрасываются как некорректные
+	maxLineLength = 64 << 10
+	// maxBatchSize - количество точек, после которого буфер соединения записывается в хранилище
+	maxBatchSize = 1000
+	// defaultIdleTimeout - время без данных, после которого соединение закрывается
+	defaultIdleTimeout = 5 * time.Minute
+)
+
+// Point - разобранная строка протокола Graphite
+type Point struct {
+	Path      string
+	Labels    core.Labels
+	Value     float64
+	Timestamp time.Time
+}
+
+// Parse разбирает строку вида path.to.metric[;tag=value...] value timestamp.
+// Отрицательная метка времени означает текущее время now.
+func Parse(line string, now time.Time) (Point, error) {
+	parts := strings.Fields(line)
+	if len(parts) != 3 {
+		return Point{}, ErrBadLine
+	}
+
+	path, tags, _ := strings.Cut(parts[0], ";")
+	if path == "" {
+		return Point{}, ErrBadLine
+	}
+
+	p := Point{Path: path, Timestamp: now}
+
+	if tags != "" {
+		p.Labels = core.Labels{}
+		for _, tag := range strings.Split(tags, ";") {
+			key, value, ok := strings.Cut(tag, "=")
+			if !ok || value == "" {
+				return Point{}, ErrBadLine
+			}
+			p.Labels[key] = value
+		}
+
+		if err := p.Labels.Validate(); err != nil {
+			return Point{}, err
+		}
+	}
+
+	value, err := strconv.ParseFloat(parts[1], 64)
+	if err != nil || math.IsNaN(value) {
+		return Point{}, ErrBadValue
+	}
+	p.Value = value
+
+	ts, err := strconv.ParseFloat(parts[2], 64)
+	if err != nil {
+		return Point{}, ErrBadTimestamp
+	}
+	if ts >= 0 {
+		p.Timestamp = time.Unix(int64(ts), 0)
+	}
+
+	return p, nil
+}
+
+// Server - TCP-приемник Graphite
+type Server struct {
+	listener  net.Listener
+	storage   core.Storage
+	logger    *zap.Logger
+	malformed atomic.Int64
+	// idleTimeout - дедлайн чтения, который продлевается перед каждым чтением строки
+	idleTimeout time.Duration
+
+	mu     *sync.Mutex
+	conns  map[net.Conn]struct{}
+	wg     *sync.WaitGroup
+	closed bool
+}
+
+// NewServer открывает TCP-сокет address.
+func NewServer(address string, storage core.Storage, logger *zap.Logger) (*Server, error) {
+	listener, err := net.Listen("tcp", address)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Server{
+		listener:    listener,
+		storage:     storage,
+		logger:      logger,
+		idleTimeout: defaultIdleTimeout,
+		mu:          &sync.Mutex{},
+		conns:       make(map[net.Conn]struct{}),
+		wg:          &sync.WaitGroup{},
+	}, nil
+}
+
+// Addr возвращает фактический адрес сокета.
+func (s *Server) Addr() net.Addr {
+	return s.listener.Addr()
+}
+
+// Malformed возвращает количество отброшенных строк с момента запуска.
+func (s *Server) Malformed() int64 {
+	return s.malformed.Load()
+}
+
+// Serve принимает соединения до вызова Shutdown.
+func (s *Server) Serve() error {
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return nil
+			}
+			return err
+		}
+
+		s.mu.Lock()
+		if s.closed {
+			s.mu.Unlock()
+			conn.Close()
+			continue
+		}
+		s.conns[conn] = struct{}{}
+		s.wg.Add(1)
+		s.mu.Unlock()
+
+		go s.handleConn(conn)
+	}
+}
+
+// Shutdown перестает принимать соединения и прерывает чтение открытых соединений.
+// Уже полученные точки записываются в хранилище. Ожидание ограничено ctx.
+func (s *Server) Shutdown(ctx context.Context) error {
+	err := s.listener.Close()
+
+	s.mu.Lock()
+	s.closed = true
+	for conn := range s.conns {
+		conn.SetReadDeadline(time.Now())
+	}
+	s.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		s.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// handleConn читает строки соединения и накапливает точки в буфере.
+// Буфер записывается в хранилище, когда прочитаны все пришедшие данные, набрано maxBatchSize точек
+// или соединение закрыто. Соединение, не присылающее данных дольше idleTimeout, закрывается.
+func (s *Server) handleConn(conn net.Conn) {
+	defer func() {
+		conn.Close()
+
+		s.mu.Lock()
+		delete(s.conns, conn)
+		s.mu.Unlock()
+		s.wg.Done()
+	}()
+
+	reader := bufio.NewReaderSize(conn, maxLineLength)
+	batch := core.NewBaseMetricStorage()
+	var pending, malformed int64
+
+	flush := func() {
+		if pending == 0 && malformed == 0 {
+			return
+		}
+
+		if malformed > 0 {
+			batch.SetCounter(MalformedLinesMetric, malformed)
+		}
+
+		if err := s.storage.SetBatch(context.Background(), batch); err != nil {
+			s.logger.Error("Error writing graphite metrics: ", zap.Error(err))
+		}
+
+		batch = core.NewBaseMetricStorage()
+		pending, malformed = 0, 0
+	}
+	defer flush()
+
+	for {
+		if !s.extendDeadline(conn) {
+			return
+		}
+
+		line, err := readLine(reader)
+		// Строка, чтение которой прервано остановкой сервера, может быть неполной
+		if line != "" && (err == nil || errors.Is(err, io.EOF)) {
+			p, perr := Parse(line, time.Now())
+			if perr != nil {
+				s.malformed.Add(1)
+				malformed++
+				s.logger.Debug("Skip graphite line", zap.String("line", line), zap.Error(perr))
+			} else {
+				batch.SetGauge(core.MetricKey(p.Path, p.Labels), p.Value)
+				pending++
+			}
+		}
+
+		if errors.Is(err, errLineTooLong) {
+			s.malformed.Add(1)
+			malformed++
+			continue
+		}
+		if err != nil {
+			if !errors.Is(err, io.EOF) && !isTimeout(err) {
+				s.logger.Debug("Graphite connection error", zap.Error(err))
+			}
+			return
+		}
+
+		if pending >= maxBatchSize || reader.Buffered() == 0 {
+			flush()
+		}
+	}
+}
+
+// extendDeadline продлевает дедлайн чтения соединения на idleTimeout.
+// После Shutdown дедлайн не продлевается, чтобы не отменить прерывание чтения, и возвращается false.
+func (s *Server) extendDeadline(conn net.Conn) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed {
+		return false
+	}
+
+	conn.SetReadDeadline(time.Now().Add(s.idleTimeout))
+	return true
+}
+
+// readLine читает строку до '\n'. Строка длиннее буфера чтения пропускается целиком.
+func readLine(r *bufio.Reader) (string, error) {
+	line, err := r.ReadSlice('\n')
+	if !errors.Is(err, bufio.ErrBufferFull) {
+		return strings.TrimSpace(string(line)), err
+	}
+
+	for errors.Is(err, bufio.ErrBufferFull) {
+		_, err = r.ReadSlice('\n')
+	}
+	if err != nil {
+		return "", err
+	}
+
+	return "", errLineTooLong
+}
+
+func isTimeout(err error) bool {
+	var ne net.Error
+	return errors.As(err, &ne) && ne.Timeout()
+}
@@ -0,0 +1,133 @@
+package graphite
+
+import (
+	"context"
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/smartfor/metrics/internal/core"
+	"github.com/smartfor/metrics/internal/server/storage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+func TestParse(t *testing.T) {
+	now := time.Unix(100, 0)
+
+	tests := []struct {
+		name    string
+		line    string
+		want    Point
+		wantErr error
+	}{
+		{
+			name: "plain",
+			line: "servers.web01.load 0.75 1700000000",
+			want: Point{Path: "servers.web01.load", Value: 0.75, Timestamp: time.Unix(1700000000, 0)},
+		},
+		{
+			name: "tagged, current time",
+			line: "disk.used;host=web01;mount=root 42 -1",
+			want: Point{Path: "disk.used", Labels: core.Labels{"host": "web01", "mount": "root"}, Value: 42, Timestamp: now},
+		},
+		{name: "missing timestamp", line: "a.b 1", wantErr: ErrBadLine},
+		{name: "bad value", line: "a.b x 1", wantErr: ErrBadValue},
+		{name: "nan value", line: "a.b nan 1", wantErr: ErrBadValue},
+		{name: "bad timestamp", line: "a.b 1 yesterday", wantErr: ErrBadTimestamp},
+		{name: "bad tag", line: "a.b;host 1 1", wantErr: ErrBadLine},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Parse(tt.line, now)
+			if tt.wantErr != nil {
+				assert.ErrorIs(t, err, tt.wantErr)
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestServer(t *testing.T) {
+	ctx := context.Background()
+
+	fs, err := storage.NewFileStorage("/tmp/metrics-graphite.json")
+	require.NoError(t, err)
+	s, err := storage.NewMemStorage(fs, false, false, 0)
+	require.NoError(t, err)
+
+	server, err := NewServer("127.0.0.1:0", s, zap.NewNop())
+	require.NoError(t, err)
+
+	served := make(chan error)
+	go func() { served <- server.Serve() }()
+
+	conn, err := net.Dial("tcp", server.Addr().String())
+	require.NoError(t, err)
+
+	_, err = conn.Write([]byte("app.requests 10 -1\nbroken\napp.latency;host=a 0.5 -1\n"))
+	require.NoError(t, err)
+	_, err = conn.Write([]byte(strings.Repeat("x", maxLineLength+10) + "\napp.requests 12 -1\n"))
+	require.NoError(t, err)
+
+	require.Eventually(t, func() bool {
+		v, err := s.Get(ctx, "app.requests", core.Gauge)
+		return err == nil && v == "12"
+	}, time.Second, 10*time.Millisecond)
+
+	latency, err := s.Get(ctx, `app.latency{host="a"}`, core.Gauge)
+	require.NoError(t, err)
+	assert.Equal(t, "0.5", latency)
+
+	assert.Equal(t, int64(2), server.Malformed())
+
+	// Открытое соединение не мешает остановке сервера
+	shutdownCtx, cancel := context.WithTimeout(ctx, time.Second)
+	defer cancel()
+	require.NoError(t, server.Shutdown(shutdownCtx))
+	require.NoError(t, <-served)
+
+	malformed, err := s.Get(ctx, MalformedLinesMetric, core.Counter)
+	require.NoError(t, err)
+	assert.Equal(t, "2", malformed)
+
+	conn.Close()
+}
+
+func TestServer_IdleTimeout(t *testing.T) {
+	fs, err := storage.NewFileStorage("/tmp/metrics-graphite.json")
+	require.NoError(t, err)
+	s, err := storage.NewMemStorage(fs, false, false, 0)
+	require.NoError(t, err)
+
+	server, err := NewServer("127.0.0.1:0", s, zap.NewNop())
+	require.NoError(t, err)
+	server.idleTimeout = 50 * time.Millisecond
+
+	served := make(chan error)
+	go func() { served <- server.Serve() }()
+
+	conn, err := net.Dial("tcp", server.Addr().String())
+	require.NoError(t, err)
+	defer conn.Close()
+
+	_, err = conn.Write([]byte("app.requests 10 -1\n"))
+	require.NoError(t, err)
+
+	// Сервер закрывает молчащее соединение
+	require.NoError(t, conn.SetReadDeadline(time.Now().Add(time.Second)))
+	_, err = conn.Read(make([]byte, 1))
+	require.ErrorIs(t, err, io.EOF)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	require.NoError(t, server.Shutdown(ctx))
+	require.NoError(t, <-served)
+}
@@ -0,0 +1,90 @@
+package grpcserver
+
+import (
+	"context"
+	"time"
+
+	pb "github.com/smartfor/metrics/internal/proto"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// MakeEnvelopeUnaryInterceptor - перехватчик, расшифровывающий и проверяющий подпись пачки метрик
+// в унарных вызовах, аналог MakeCryptoMiddleware и MakeAuthMiddleware для HTTP.
+func MakeEnvelopeUnaryInterceptor(secret string, privateKey []byte) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		if batch, ok := req.(*pb.UpdateBatchRequest); ok {
+			if err := pb.Open(batch, secret, privateKey); err != nil {
+				return nil, status.Error(codes.InvalidArgument, err.Error())
+			}
+		}
+
+		return handler(ctx, req)
+	}
+}
+
+// MakeEnvelopeStreamInterceptor - перехватчик, расшифровывающий и проверяющий подпись
+// каждой пачки метрик, полученной в потоке.
+func MakeEnvelopeStreamInterceptor(secret string, privateKey []byte) grpc.StreamServerInterceptor {
+	return func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		return handler(srv, &envelopeServerStream{
+			ServerStream: ss,
+			secret:       secret,
+			privateKey:   privateKey,
+		})
+	}
+}
+
+type envelopeServerStream struct {
+	grpc.ServerStream
+	secret     string
+	privateKey []byte
+}
+
+func (s *envelopeServerStream) RecvMsg(m any) error {
+	if err := s.ServerStream.RecvMsg(m); err != nil {
+		return err
+	}
+
+	if batch, ok := m.(*pb.UpdateBatchRequest); ok {
+		if err := pb.Open(batch, s.secret, s.privateKey); err != nil {
+			return status.Error(codes.InvalidArgument, err.Error())
+		}
+	}
+
+	return nil
+}
+
+// MakeLoggerUnaryInterceptor - перехватчик для логирования унарных вызовов
+func MakeLoggerUnaryInterceptor(logger *zap.Logger) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		start := time.Now()
+		resp, err := handler(ctx, req)
+
+		logger.Sugar().Infoln(
+			"method", info.FullMethod,
+			"duration", time.Since(start),
+			"status", status.Code(err),
+		)
+
+		return resp, err
+	}
+}
+
+// MakeLoggerStreamInterceptor - перехватчик для логирования потоковых вызовов
+func MakeLoggerStreamInterceptor(logger *zap.Logger) grpc.StreamServerInterceptor {
+	return func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		start := time.Now()
+		err := handler(srv, ss)
+
+		logger.Sugar().Infoln(
+			"method", info.FullMethod,
+			"duration", time.Since(start),
+			"status", status.Code(err),
+		)
+
+		return err
+	}
+}
@@ -0,0 +1,142 @@
+// Package grpcserver содержит gRPC-сервис приема и чтения метрик поверх core.Storage.
+package grpcserver
+
+import (
+	"context"
+	"errors"
+	"io"
+
+	"github.com/smartfor/metrics/internal/core"
+	"github.com/smartfor/metrics/internal/metrics"
+	pb "github.com/smartfor/metrics/internal/proto"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// MetricsServer - реализация gRPC-сервиса Metrics
+type MetricsServer struct {
+	pb.UnimplementedMetricsServer
+	storage core.Storage
+}
+
+// NewServer создает gRPC-сервер с зарегистрированным сервисом Metrics.
+// Подпись (secret) и шифрование (privateKey) пачек метрик проверяются перехватчиками.
+func NewServer(s core.Storage, logger *zap.Logger, secret string, privateKey []byte) *grpc.Server {
+	server := grpc.NewServer(
+		grpc.ChainUnaryInterceptor(
+			MakeLoggerUnaryInterceptor(logger),
+			MakeEnvelopeUnaryInterceptor(secret, privateKey),
+		),
+		grpc.ChainStreamInterceptor(
+			MakeLoggerStreamInterceptor(logger),
+			MakeEnvelopeStreamInterceptor(secret, privateKey),
+		),
+	)
+
+	pb.RegisterMetricsServer(server, &MetricsServer{storage: s})
+
+	return server
+}
+
+// UpdateBatch записывает пачку метрик в хранилище.
+func (m *MetricsServer) UpdateBatch(ctx context.Context, req *pb.UpdateBatchRequest) (*pb.UpdateBatchResponse, error) {
+	if err := m.setBatch(ctx, req); err != nil {
+		return nil, err
+	}
+
+	return &pb.UpdateBatchResponse{}, nil
+}
+
+// Update принимает поток пачек метрик и записывает каждую пачку по мере получения.
+func (m *MetricsServer) Update(stream pb.Metrics_UpdateServer) error {
+	var accepted int64
+
+	for {
+		req, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			return stream.SendAndClose(&pb.UpdateResponse{Accepted: accepted})
+		}
+		if err != nil {
+			return err
+		}
+
+		if err := m.setBatch(stream.Context(), req); err != nil {
+			return err
+		}
+		accepted += int64(len(req.GetMetrics()))
+	}
+}
+
+// Get возвращает значение метрики.
+func (m *MetricsServer) Get(ctx context.Context, req *pb.GetRequest) (*pb.GetResponse, error) {
+	metric := metrics.Metrics{
+		ID:     req.GetId(),
+		MType:  req.GetType(),
+		Labels: req.GetLabels(),
+	}
+
+	mType := core.NewMetricType(metric.MType)
+	if mType == core.Unknown {
+		return nil, status.Error(codes.InvalidArgument, core.ErrUnknownMetricType.Error())
+	}
+
+	value, err := m.storage.Get(ctx, metric.Key(), mType)
+	if err != nil {
+		return nil, toStatus(err)
+	}
+
+	model := metrics.Metrics{ID: metric.ID, MType: metric.MType, Labels: metric.Labels}
+	if err := metrics.SetValueFromString(&model, value); err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+
+	return &pb.GetResponse{Metric: pb.FromMetrics(model)}, nil
+}
+
+// GetAll возвращает все метрики хранилища.
+func (m *MetricsServer) GetAll(ctx context.Context, _ *pb.GetAllRequest) (*pb.GetAllResponse, error) {
+	all, err := m.storage.GetAll(ctx)
+	if err != nil {
+		return nil, toStatus(err)
+	}
+
+	resp := &pb.GetAllResponse{}
+	for _, metric := range metrics.FromBaseStorage(&all) {
+		resp.Metrics = append(resp.Metrics, pb.FromMetrics(metric))
+	}
+
+	return resp, nil
+}
+
+func (m *MetricsServer) setBatch(ctx context.Context, req *pb.UpdateBatchRequest) error {
+	batch, err := metrics.ToBatch(pb.MetricsFromProto(req.GetMetrics()))
+	if err != nil {
+		return status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	id := core.BatchID{
+		AgentID: req.GetAgentId(),
+		Key:     req.GetIdempotencyKey(),
+		Seq:     req.GetSeq(),
+	}
+
+	// Повтор уже примененной пачки подтверждается так же, как первая доставка
+	if err := core.SetBatchOnce(ctx, m.storage, id, batch); err != nil && !errors.Is(err, core.ErrDuplicateBatch) {
+		return toStatus(err)
+	}
+
+	return nil
+}
+
+func toStatus(err error) error {
+	switch {
+	case errors.Is(err, core.ErrNotFound):
+		return status.Error(codes.NotFound, err.Error())
+	case errors.Is(err, core.ErrUnknownMetricType), errors.Is(err, core.ErrBadMetricValue):
+		return status.Error(codes.InvalidArgument, err.Error())
+	default:
+		return status.Error(codes.Internal, err.Error())
+	}
+}
@@ -0,0 +1,161 @@
+package grpcserver
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"net"
+	"testing"
+
+	"github.com/smartfor/metrics/internal"
+	pb "github.com/smartfor/metrics/internal/proto"
+	"github.com/smartfor/metrics/internal/server/storage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+const secret = "very very very secret key"
+
+func generateKeys(t *testing.T) (publicKey []byte, privateKey []byte) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	pub, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	require.NoError(t, err)
+
+	publicKey = pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: pub})
+	privateKey = pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})
+
+	return publicKey, privateKey
+}
+
+func startServer(t *testing.T, privateKey []byte) *bufconn.Listener {
+	fs, err := storage.NewFileStorage("/tmp/metrics-grpc.json")
+	require.NoError(t, err)
+	s, err := storage.NewMemStorage(fs, false, false, 0)
+	require.NoError(t, err)
+
+	listener := bufconn.Listen(1 << 20)
+	server := NewServer(s, zap.NewNop(), secret, privateKey)
+	go server.Serve(listener)
+	t.Cleanup(server.Stop)
+
+	return listener
+}
+
+func dial(t *testing.T, listener *bufconn.Listener, secret string, publicKey []byte) pb.MetricsClient {
+	conn, err := grpc.NewClient(
+		"passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return listener.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithUnaryInterceptor(internal.MakeEnvelopeClientInterceptor(secret, publicKey)),
+	)
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+
+	return pb.NewMetricsClient(conn)
+}
+
+func TestMetricsServer(t *testing.T) {
+	ctx := context.Background()
+	publicKey, privateKey := generateKeys(t)
+	listener := startServer(t, privateKey)
+
+	t.Run("UpdateBatch - signed and encrypted", func(t *testing.T) {
+		client := dial(t, listener, secret, publicKey)
+
+		_, err := client.UpdateBatch(ctx, &pb.UpdateBatchRequest{Metrics: []*pb.Metric{
+			{Id: "Alloc", Type: "gauge", Value: 1.5, Labels: map[string]string{"host": "a"}},
+			{Id: "PollCount", Type: "counter", Delta: 2},
+			{Id: "PollCount", Type: "counter", Delta: 3},
+		}})
+		require.NoError(t, err)
+
+		resp, err := client.Get(ctx, &pb.GetRequest{Id: "Alloc", Type: "gauge", Labels: map[string]string{"host": "a"}})
+		require.NoError(t, err)
+		assert.Equal(t, 1.5, resp.GetMetric().GetValue())
+
+		resp, err = client.Get(ctx, &pb.GetRequest{Id: "PollCount", Type: "counter"})
+		require.NoError(t, err)
+		assert.Equal(t, int64(5), resp.GetMetric().GetDelta())
+	})
+
+	t.Run("Update - client stream", func(t *testing.T) {
+		client := dial(t, listener, "", nil)
+
+		stream, err := client.Update(ctx)
+		require.NoError(t, err)
+
+		for _, delta := range []int64{1, 2, 3} {
+			req := &pb.UpdateBatchRequest{Metrics: []*pb.Metric{{Id: "Streamed", Type: "counter", Delta: delta}}}
+			require.NoError(t, pb.Seal(req, secret, publicKey))
+			require.NoError(t, stream.Send(req))
+		}
+
+		resp, err := stream.CloseAndRecv()
+		require.NoError(t, err)
+		assert.Equal(t, int64(3), resp.GetAccepted())
+
+		all, err := client.GetAll(ctx, &pb.GetAllRequest{})
+		require.NoError(t, err)
+
+		var found bool
+		for _, m := range all.GetMetrics() {
+			if m.GetId() == "Streamed" {
+				found = true
+				assert.Equal(t, int64(6), m.GetDelta())
+			}
+		}
+		assert.True(t, found)
+	})
+
+	t.Run("UpdateBatch - retry with same idempotency key", func(t *testing.T) {
+		client := dial(t, listener, secret, publicKey)
+
+		req := &pb.UpdateBatchRequest{
+			Metrics:        []*pb.Metric{{Id: "Retried", Type: "counter", Delta: 4}},
+			AgentId:        "agent",
+			IdempotencyKey: "batch-1",
+			Seq:            1,
+		}
+		for i := 0; i < 2; i++ {
+			_, err := client.UpdateBatch(ctx, req)
+			require.NoError(t, err)
+		}
+
+		resp, err := client.Get(ctx, &pb.GetRequest{Id: "Retried", Type: "counter"})
+		require.NoError(t, err)
+		assert.Equal(t, int64(4), resp.GetMetric().GetDelta())
+	})
+
+	t.Run("Negative - not encrypted", func(t *testing.T) {
+		client := dial(t, listener, secret, nil)
+
+		_, err := client.UpdateBatch(ctx, &pb.UpdateBatchRequest{Metrics: []*pb.Metric{{Id: "Alloc", Type: "gauge", Value: 1}}})
+		assert.Equal(t, codes.InvalidArgument, status.Code(err))
+	})
+
+	t.Run("Negative - wrong secret", func(t *testing.T) {
+		client := dial(t, listener, "other secret", publicKey)
+
+		_, err := client.UpdateBatch(ctx, &pb.UpdateBatchRequest{Metrics: []*pb.Metric{{Id: "Alloc", Type: "gauge", Value: 1}}})
+		assert.Equal(t, codes.InvalidArgument, status.Code(err))
+	})
+
+	t.Run("Negative - not found", func(t *testing.T) {
+		client := dial(t, listener, "", nil)
+
+		_, err := client.Get(ctx, &pb.GetRequest{Id: "Unknown", Type: "gauge"})
+		assert.Equal(t, codes.NotFound, status.Code(err))
+	})
+}
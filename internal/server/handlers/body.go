@@ -0,0 +1,29 @@
+package handlers
+
+import (
+	"errors"
+	"io"
+	"net/http"
+
+	"github.com/smartfor/metrics/internal/server/utils"
+)
+
+// MaxWriteBodySize - максимальный размер тела запроса записи метрик (remote_write, OTLP, Influx).
+const MaxWriteBodySize = 32 << 20
+
+// readWriteBody читает тело запроса записи не больше MaxWriteBodySize.
+// При ошибке ответ уже записан: 413 для слишком большого тела, 400 для остальных ошибок.
+func readWriteBody(w http.ResponseWriter, r *http.Request) ([]byte, bool) {
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, MaxWriteBodySize))
+	if err != nil {
+		status := http.StatusBadRequest
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			status = http.StatusRequestEntityTooLarge
+		}
+		utils.WriteError(w, err, status)
+		return nil, false
+	}
+
+	return body, true
+}
@@ -48,6 +48,29 @@ func MakeGetMetricsPageHandler(s core.Storage) func(w http.ResponseWriter, r *ht
 			out += fmt.Sprintf("<li>%s : %s</li>", k, utils.CounterAsString(counters[k]))
 		}
 
+		out += `
+</ul>
+<h2>Histograms</h2>
+<ul>
+`
+		histograms := m.Histograms()
+		hKeys := make([]string, 0, len(histograms))
+		for k := range histograms {
+			hKeys = append(hKeys, k)
+		}
+		slices.Sort(hKeys)
+		for _, k := range hKeys {
+			h := histograms[k]
+			out += fmt.Sprintf(
+				"<li>%s : count=%d sum=%s p50=%s p99=%s</li>",
+				k,
+				h.Count,
+				utils.GaugeAsString(h.Sum),
+				utils.GaugeAsString(h.Quantile(0.5)),
+				utils.GaugeAsString(h.Quantile(0.99)),
+			)
+		}
+
 		out += `
 <ul>`
 
@@ -42,7 +42,7 @@ func MakeGetValueJSONHandler(s core.Storage) func(w http.ResponseWriter, r *http
 
 		mType := core.NewMetricType(req.MType)
 
-		value, err := s.Get(r.Context(), req.ID, mType)
+		value, err := s.Get(r.Context(), req.Key(), mType)
 		if err != nil {
 			utils.WriteError(w, err, http.StatusNotFound)
 			return
@@ -69,6 +69,16 @@ func MakeGetValueJSONHandler(s core.Storage) func(w http.ResponseWriter, r *http
 				}
 				req.Value = &v
 			}
+		case core.Histogram:
+			{
+				var v core.HistogramValue
+				v, err = core.ParseHistogram(value)
+				if err != nil {
+					utils.WriteError(w, err, http.StatusInternalServerError)
+					return
+				}
+				req.Histogram = &v
+			}
 		default:
 			utils.WriteError(w, core.ErrUnknownMetricType, http.StatusBadRequest)
 			return
@@ -0,0 +1,51 @@
+package handlers
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/smartfor/metrics/internal/core"
+	"github.com/smartfor/metrics/internal/server/influx"
+	"github.com/smartfor/metrics/internal/server/utils"
+)
+
+// MakeInfluxWriteHandler создает хендлер, принимающий точки в формате InfluxDB line protocol
+// (совместим с /api/v2/write InfluxDB, параметр precision: ns, us, ms или s).
+// Значения записываются в хранилище одной пачкой, gaugeFields - шаблоны имен целочисленных gauge.
+func MakeInfluxWriteHandler(s core.Storage, gaugeFields []string) http.HandlerFunc {
+	receiver := influx.NewReceiver(gaugeFields)
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		defer r.Body.Close()
+
+		precision, err := influx.Precision(r.URL.Query().Get("precision"))
+		if err != nil {
+			utils.WriteError(w, err, http.StatusBadRequest)
+			return
+		}
+
+		body, ok := readWriteBody(w, r)
+		if !ok {
+			return
+		}
+
+		points, err := influx.Parse(body, precision, time.Now())
+		if err != nil {
+			utils.WriteError(w, err, http.StatusBadRequest)
+			return
+		}
+
+		batch, err := receiver.ToBatch(points)
+		if err != nil {
+			utils.WriteError(w, err, http.StatusBadRequest)
+			return
+		}
+
+		if err := s.SetBatch(r.Context(), batch); err != nil {
+			utils.WriteError(w, err, http.StatusInternalServerError)
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
@@ -0,0 +1,53 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/smartfor/metrics/internal/core"
+	"github.com/smartfor/metrics/internal/server/otlp"
+	"github.com/smartfor/metrics/internal/server/utils"
+)
+
+// MakeOTLPMetricsHandler создает хендлер, принимающий метрики OpenTelemetry по OTLP/HTTP
+// в кодировке protobuf (application/x-protobuf) или JSON (application/json).
+// Значения записываются в хранилище одной пачкой.
+func MakeOTLPMetricsHandler(s core.Storage) http.HandlerFunc {
+	receiver := otlp.NewReceiver()
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		defer r.Body.Close()
+
+		contentType := r.Header.Get("Content-Type")
+
+		body, ok := readWriteBody(w, r)
+		if !ok {
+			return
+		}
+
+		data, err := otlp.Decode(body, contentType)
+		if err != nil {
+			status := http.StatusBadRequest
+			if errors.Is(err, otlp.ErrUnsupportedContentType) {
+				status = http.StatusUnsupportedMediaType
+			}
+			utils.WriteError(w, err, status)
+			return
+		}
+
+		batch, rejected, err := receiver.ToBatch(data)
+		if err != nil {
+			utils.WriteError(w, err, http.StatusBadRequest)
+			return
+		}
+
+		if err := s.SetBatch(r.Context(), batch); err != nil {
+			utils.WriteError(w, err, http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", contentType)
+		w.WriteHeader(http.StatusOK)
+		w.Write(otlp.Encode(contentType, rejected))
+	}
+}
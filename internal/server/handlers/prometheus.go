@@ -0,0 +1,250 @@
+package handlers
+
+import (
+	"bufio"
+	"log"
+	"math"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/smartfor/metrics/internal/core"
+)
+
+const (
+	// PrometheusContentType - тип ответа в текстовом формате Prometheus 0.0.4
+	PrometheusContentType = "text/plain; version=0.0.4; charset=utf-8"
+	// OpenMetricsContentType - тип ответа в формате OpenMetrics 1.0.0
+	OpenMetricsContentType = "application/openmetrics-text; version=1.0.0; charset=utf-8"
+)
+
+// promSeries - одна серия метрики: метки и значение соответствующего типа
+type promSeries struct {
+	labels    core.Labels
+	key       string
+	gauge     float64
+	counter   int64
+	histogram core.HistogramValue
+}
+
+// promFamily - семейство серий с одинаковым именем и типом
+type promFamily struct {
+	name   string
+	mType  core.MetricType
+	series []promSeries
+}
+
+// MakePrometheusHandler создает хендлер, отдающий все метрики хранилища в текстовом формате Prometheus.
+// Если клиент принимает application/openmetrics-text, ответ формируется в формате OpenMetrics.
+func MakePrometheusHandler(s core.Storage) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		m, err := s.GetAll(r.Context())
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		openMetrics := acceptsOpenMetrics(r.Header.Get("Accept"))
+		if openMetrics {
+			w.Header().Set("Content-Type", OpenMetricsContentType)
+		} else {
+			w.Header().Set("Content-Type", PrometheusContentType)
+		}
+
+		bw := bufio.NewWriter(w)
+		for _, f := range collectPromFamilies(&m) {
+			writePromFamily(bw, f, openMetrics)
+		}
+		if openMetrics {
+			bw.WriteString("# EOF\n")
+		}
+
+		if err := bw.Flush(); err != nil {
+			log.Printf("Error writing response: %v", err)
+		}
+	}
+}
+
+// acceptsOpenMetrics проверяет, запрашивает ли клиент формат OpenMetrics.
+func acceptsOpenMetrics(accept string) bool {
+	for _, part := range strings.Split(accept, ",") {
+		mediaType, _, _ := strings.Cut(part, ";")
+		if strings.TrimSpace(mediaType) == "application/openmetrics-text" {
+			return true
+		}
+	}
+
+	return false
+}
+
+// collectPromFamilies группирует серии по имени метрики. Имена приводятся к допустимым в Prometheus.
+// Если одно и то же имя встречается у метрик разных типов, остается первое семейство
+// в порядке gauge, counter, histogram - иначе экспозиция была бы некорректной.
+func collectPromFamilies(m *core.BaseMetricStorage) []*promFamily {
+	families := make(map[string]*promFamily)
+
+	add := func(key string, mType core.MetricType, fill func(*promSeries)) {
+		name, labels, err := core.ParseMetricKey(key)
+		if err != nil {
+			name, labels = key, nil
+		}
+		name = sanitizePromName(name)
+
+		f, ok := families[name]
+		if !ok {
+			f = &promFamily{name: name, mType: mType}
+			families[name] = f
+		}
+		if f.mType != mType {
+			return
+		}
+
+		series := promSeries{key: key, labels: labels}
+		fill(&series)
+		f.series = append(f.series, series)
+	}
+
+	for k, v := range m.Gauges() {
+		add(k, core.Gauge, func(s *promSeries) { s.gauge = v })
+	}
+	for k, v := range m.Counters() {
+		add(k, core.Counter, func(s *promSeries) { s.counter = v })
+	}
+	for k, v := range m.Histograms() {
+		add(k, core.Histogram, func(s *promSeries) { s.histogram = v })
+	}
+
+	out := make([]*promFamily, 0, len(families))
+	for _, f := range families {
+		slices.SortFunc(f.series, func(a, b promSeries) int {
+			return strings.Compare(a.key, b.key)
+		})
+		out = append(out, f)
+	}
+	slices.SortFunc(out, func(a, b *promFamily) int {
+		return strings.Compare(a.name, b.name)
+	})
+
+	return out
+}
+
+func writePromFamily(w *bufio.Writer, f *promFamily, openMetrics bool) {
+	switch f.mType {
+	case core.Gauge:
+		writePromType(w, f.name, "gauge")
+		for _, s := range f.series {
+			writePromSample(w, f.name, s.labels, formatPromFloat(s.gauge))
+		}
+
+	case core.Counter:
+		// В OpenMetrics имя семейства счетчика не содержит суффикса _total, а имена значений - содержат.
+		family, sample := f.name, f.name
+		if openMetrics {
+			family = strings.TrimSuffix(f.name, "_total")
+			sample = family + "_total"
+		}
+
+		writePromType(w, family, "counter")
+		for _, s := range f.series {
+			writePromSample(w, sample, s.labels, strconv.FormatInt(s.counter, 10))
+		}
+
+	case core.Histogram:
+		writePromType(w, f.name, "histogram")
+		for _, s := range f.series {
+			var cumulative uint64
+			for i, c := range s.histogram.Counts {
+				cumulative += c
+
+				le := "+Inf"
+				if i < len(s.histogram.Bounds) {
+					le = formatPromFloat(s.histogram.Bounds[i])
+				}
+
+				writePromSample(w, f.name+"_bucket", s.labels.Merge(core.Labels{"le": le}), strconv.FormatUint(cumulative, 10))
+			}
+			writePromSample(w, f.name+"_sum", s.labels, formatPromFloat(s.histogram.Sum))
+			writePromSample(w, f.name+"_count", s.labels, strconv.FormatUint(s.histogram.Count, 10))
+		}
+	}
+}
+
+func writePromType(w *bufio.Writer, name string, mType string) {
+	w.WriteString("# TYPE ")
+	w.WriteString(name)
+	w.WriteByte(' ')
+	w.WriteString(mType)
+	w.WriteByte('\n')
+}
+
+func writePromSample(w *bufio.Writer, name string, labels core.Labels, value string) {
+	w.WriteString(name)
+
+	if len(labels) > 0 {
+		names := make([]string, 0, len(labels))
+		for k := range labels {
+			names = append(names, k)
+		}
+		slices.Sort(names)
+
+		w.WriteByte('{')
+		for i, k := range names {
+			if i > 0 {
+				w.WriteByte(',')
+			}
+			w.WriteString(k)
+			w.WriteString(`="`)
+			w.WriteString(escapePromLabelValue(labels[k]))
+			w.WriteByte('"')
+		}
+		w.WriteByte('}')
+	}
+
+	w.WriteByte(' ')
+	w.WriteString(value)
+	w.WriteByte('\n')
+}
+
+// sanitizePromName заменяет недопустимые в имени метрики Prometheus символы на '_'.
+func sanitizePromName(name string) string {
+	if name == "" {
+		return "_"
+	}
+
+	var b strings.Builder
+	for i, r := range name {
+		switch {
+		case r == '_', r == ':', r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z':
+			b.WriteRune(r)
+		case r >= '0' && r <= '9':
+			if i == 0 {
+				b.WriteByte('_')
+			}
+			b.WriteRune(r)
+		default:
+			b.WriteByte('_')
+		}
+	}
+
+	return b.String()
+}
+
+var promLabelValueReplacer = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func escapePromLabelValue(v string) string {
+	return promLabelValueReplacer.Replace(v)
+}
+
+func formatPromFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	default:
+		return strconv.FormatFloat(v, 'g', -1, 64)
+	}
+}
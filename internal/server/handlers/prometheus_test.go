@@ -0,0 +1,87 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/smartfor/metrics/internal/core"
+	"github.com/smartfor/metrics/internal/server/storage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMakePrometheusHandler(t *testing.T) {
+	fs, err := storage.NewFileStorage("/tmp/metrics-prometheus.json")
+	require.NoError(t, err)
+	s, err := storage.NewMemStorage(fs, false, false, 0)
+	require.NoError(t, err)
+
+	ctx := context.Background()
+	h, err := core.NewHistogramValue([]float64{0.1, 1})
+	require.NoError(t, err)
+	h.Observe(0.05)
+	h.Observe(0.5)
+	h.Observe(3)
+
+	require.NoError(t, s.Set(ctx, "Alloc", "1.5", core.Gauge))
+	require.NoError(t, s.Set(ctx, core.MetricKey("requests_total", core.Labels{"host": `a"b`}), "7", core.Counter))
+	require.NoError(t, s.Set(ctx, "latency.seconds", h.String(), core.Histogram))
+
+	tests := []struct {
+		name        string
+		accept      string
+		contentType string
+		body        string
+	}{
+		{
+			name:        "Prometheus text format 0.0.4",
+			contentType: PrometheusContentType,
+			body: `# TYPE Alloc gauge
+Alloc 1.5
+# TYPE latency_seconds histogram
+latency_seconds_bucket{le="0.1"} 1
+latency_seconds_bucket{le="1"} 2
+latency_seconds_bucket{le="+Inf"} 3
+latency_seconds_sum 3.55
+latency_seconds_count 3
+# TYPE requests_total counter
+requests_total{host="a\"b"} 7
+`,
+		},
+		{
+			name:        "OpenMetrics negotiated by Accept header",
+			accept:      "application/openmetrics-text;version=1.0.0,text/plain;version=0.0.4;q=0.5",
+			contentType: OpenMetricsContentType,
+			body: `# TYPE Alloc gauge
+Alloc 1.5
+# TYPE latency_seconds histogram
+latency_seconds_bucket{le="0.1"} 1
+latency_seconds_bucket{le="1"} 2
+latency_seconds_bucket{le="+Inf"} 3
+latency_seconds_sum 3.55
+latency_seconds_count 3
+# TYPE requests counter
+requests_total{host="a\"b"} 7
+# EOF
+`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+			if tt.accept != "" {
+				req.Header.Set("Accept", tt.accept)
+			}
+			rec := httptest.NewRecorder()
+
+			MakePrometheusHandler(s)(rec, req)
+
+			assert.Equal(t, http.StatusOK, rec.Code)
+			assert.Equal(t, tt.contentType, rec.Header().Get("Content-Type"))
+			assert.Equal(t, tt.body, rec.Body.String())
+		})
+	}
+}
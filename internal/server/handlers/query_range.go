@@ -0,0 +1,158 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/smartfor/metrics/internal/core"
+	"github.com/smartfor/metrics/internal/server/utils"
+)
+
+const (
+	// defaultQueryRange - интервал запроса истории, если параметр from не передан
+	defaultQueryRange = time.Hour
+	// maxQueryRangePoints - ограничение количества шагов (или значений без step) в одном запросе истории
+	maxQueryRangePoints = 11000
+)
+
+var (
+	ErrBadTimeParam     = errors.New("bad time parameter")
+	ErrBadStepParam     = errors.New("bad step parameter")
+	ErrBadRange         = errors.New("from must not be after to")
+	ErrTooManyPoints    = errors.New("too many points requested, increase step")
+	ErrMissingNameParam = errors.New("name parameter is required")
+)
+
+// QueryRangeResponse - ответ на запрос истории значений метрики
+type QueryRangeResponse struct {
+	Name   string        `json:"name"`   // идентификатор серии метрики
+	MType  string        `json:"type"`   // тип метрики
+	Points []core.Sample `json:"points"` // значения метрики по времени
+}
+
+// MakeQueryRangeHandler создает хендлер для получения истории значений метрики за интервал.
+// Параметры запроса: name - имя метрики или идентификатор серии с метками, type - тип метрики (по умолчанию gauge),
+// from и to - границы интервала в RFC3339 или unix-секундах, step - шаг прореживания (например 15s).
+func MakeQueryRangeHandler(s core.Storage) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		hs, ok := s.(core.HistoryStorage)
+		if !ok {
+			utils.WriteError(w, core.ErrHistoryNotSupported, http.StatusNotImplemented)
+			return
+		}
+
+		query := r.URL.Query()
+
+		name := query.Get("name")
+		if name == "" {
+			utils.WriteError(w, ErrMissingNameParam, http.StatusBadRequest)
+			return
+		}
+
+		mType := core.Gauge
+		if t := query.Get("type"); t != "" {
+			mType = core.NewMetricType(t)
+		}
+
+		to := time.Now()
+		if v := query.Get("to"); v != "" {
+			parsed, err := parseQueryTime(v)
+			if err != nil {
+				utils.WriteError(w, err, http.StatusBadRequest)
+				return
+			}
+			to = parsed
+		}
+
+		from := to.Add(-defaultQueryRange)
+		if v := query.Get("from"); v != "" {
+			parsed, err := parseQueryTime(v)
+			if err != nil {
+				utils.WriteError(w, err, http.StatusBadRequest)
+				return
+			}
+			from = parsed
+		}
+
+		if from.After(to) {
+			utils.WriteError(w, ErrBadRange, http.StatusBadRequest)
+			return
+		}
+
+		var step time.Duration
+		if v := query.Get("step"); v != "" {
+			parsed, err := parseQueryStep(v)
+			if err != nil {
+				utils.WriteError(w, err, http.StatusBadRequest)
+				return
+			}
+			step = parsed
+		}
+
+		if step > 0 && to.Sub(from)/step > maxQueryRangePoints {
+			utils.WriteError(w, ErrTooManyPoints, http.StatusBadRequest)
+			return
+		}
+
+		points, err := hs.QueryRange(r.Context(), name, mType, from, to, step, maxQueryRangePoints)
+		if err != nil {
+			switch {
+			case errors.Is(err, core.ErrNotFound):
+				utils.WriteError(w, err, http.StatusNotFound)
+			case errors.Is(err, core.ErrUnknownMetricType):
+				utils.WriteError(w, err, http.StatusBadRequest)
+			case errors.Is(err, core.ErrTooManySamples):
+				utils.WriteError(w, ErrTooManyPoints, http.StatusBadRequest)
+			default:
+				utils.WriteError(w, err, http.StatusInternalServerError)
+			}
+			return
+		}
+
+		resp := QueryRangeResponse{
+			Name:   name,
+			MType:  string(mType),
+			Points: points,
+		}
+
+		if err := json.NewEncoder(w).Encode(resp); err != nil {
+			utils.WriteError(w, err, http.StatusInternalServerError)
+			return
+		}
+	}
+}
+
+// parseQueryTime разбирает время в формате RFC3339 или в unix-секундах (допускается дробная часть).
+func parseQueryTime(v string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339Nano, v); err == nil {
+		return t, nil
+	}
+
+	sec, err := strconv.ParseFloat(v, 64)
+	if err != nil || math.IsNaN(sec) || math.IsInf(sec, 0) {
+		return time.Time{}, ErrBadTimeParam
+	}
+
+	whole, frac := math.Modf(sec)
+	return time.Unix(int64(whole), int64(frac*float64(time.Second))), nil
+}
+
+// parseQueryStep разбирает шаг в формате time.Duration (15s, 1m) или в секундах.
+func parseQueryStep(v string) (time.Duration, error) {
+	if d, err := time.ParseDuration(v); err == nil && d >= 0 {
+		return d, nil
+	}
+
+	sec, err := strconv.ParseFloat(v, 64)
+	if err != nil || sec < 0 || math.IsNaN(sec) || math.IsInf(sec, 0) {
+		return 0, ErrBadStepParam
+	}
+
+	return time.Duration(sec * float64(time.Second)), nil
+}
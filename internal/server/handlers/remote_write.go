@@ -0,0 +1,43 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/smartfor/metrics/internal/core"
+	"github.com/smartfor/metrics/internal/server/remotewrite"
+	"github.com/smartfor/metrics/internal/server/utils"
+)
+
+// MakeRemoteWriteHandler создает хендлер, принимающий запросы Prometheus remote_write:
+// сжатое snappy protobuf-сообщение WriteRequest. Значения записываются в хранилище одной пачкой.
+func MakeRemoteWriteHandler(s core.Storage) http.HandlerFunc {
+	receiver := remotewrite.NewReceiver()
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		defer r.Body.Close()
+
+		body, ok := readWriteBody(w, r)
+		if !ok {
+			return
+		}
+
+		series, err := remotewrite.Decode(body)
+		if err != nil {
+			utils.WriteError(w, err, http.StatusBadRequest)
+			return
+		}
+
+		batch, err := receiver.ToBatch(series)
+		if err != nil {
+			utils.WriteError(w, err, http.StatusBadRequest)
+			return
+		}
+
+		if err := s.SetBatch(r.Context(), batch); err != nil {
+			utils.WriteError(w, err, http.StatusInternalServerError)
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
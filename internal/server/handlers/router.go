@@ -9,8 +9,10 @@ import (
 	"go.uber.org/zap"
 )
 
-// Router создает роутер сервера со всем обработчиками ендпоинтов включая ендпоинты профилирования
-func Router(s core.Storage, logger *zap.Logger, secret string, cryptoKey []byte) chi.Router {
+// Router создает роутер сервера со всеми обработчиками ендпоинтов, включая ендпоинты профилирования.
+// Если задан secret, эндпоинты приема метрик от сторонних клиентов и чтения истории требуют аутентификации.
+// Параметр influxGaugeFields - шаблоны имен целочисленных полей InfluxDB, которые записываются как gauge.
+func Router(s core.Storage, logger *zap.Logger, secret string, cryptoKey []byte, influxGaugeFields []string) chi.Router {
 	r := chi.NewRouter()
 
 	r.Use(middlewares.GzipMiddleware)
@@ -19,12 +21,24 @@ func Router(s core.Storage, logger *zap.Logger, secret string, cryptoKey []byte)
 	r.Get("/ping", MakePingHandler(s))
 
 	r.Get("/", MakeGetMetricsPageHandler(s))
+	r.Get("/metrics", MakePrometheusHandler(s))
 
 	r.Post("/value/", MakeGetValueJSONHandler(s))
 	r.Get("/value/{type}/{key}", MakeGetValueHandler(s))
 
 	r.Mount("/debug", middleware.Profiler())
 
+	r.Group(func(r chi.Router) {
+		if secret != "" {
+			r.Use(middlewares.MakeRequireAuthMiddleware(secret))
+		}
+
+		r.Get("/api/v1/query_range", MakeQueryRangeHandler(s))
+		r.Post("/api/v1/write", MakeRemoteWriteHandler(s))
+		r.Post("/api/v2/write", MakeInfluxWriteHandler(s, influxGaugeFields))
+		r.Post("/v1/metrics", MakeOTLPMetricsHandler(s))
+	})
+
 	r.Group(func(r chi.Router) {
 		if cryptoKey != nil {
 			r.Use(middlewares.MakeCryptoMiddleware(cryptoKey))
@@ -1,17 +1,21 @@
 package handlers
 
 import (
+	"encoding/hex"
 	"io"
 	"log"
 	"net/http"
 	"net/http/httptest"
+	"path/filepath"
 	"strings"
 	"testing"
 
 	"github.com/smartfor/metrics/internal/logger"
 	"github.com/smartfor/metrics/internal/server/storage"
+	"github.com/smartfor/metrics/internal/utils"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
 )
 
 func testRequest(
@@ -49,12 +53,12 @@ func TestRouter(t *testing.T) {
 	if err != nil {
 		t.Fatal(err)
 	}
-	s, err := storage.NewMemStorage(fs, false, false)
+	s, err := storage.NewMemStorage(fs, false, false, storage.DefaultHistorySize)
 	if err != nil {
 		t.Fatal(err)
 	}
 
-	ts := httptest.NewServer(Router(s, zlog, "", nil))
+	ts := httptest.NewServer(Router(s, zlog, "", nil, nil))
 	defer ts.Close()
 
 	tests := []struct {
@@ -194,6 +198,31 @@ func TestRouter(t *testing.T) {
 				code: http.StatusOK,
 			},
 		},
+		{
+			name:       "Positive - Query gauge history",
+			requestURL: "/api/v1/query_range?name=key1&type=gauge&step=1s",
+			method:     http.MethodGet,
+			want: want{
+				code:        http.StatusOK,
+				contentType: "application/json",
+			},
+		},
+		{
+			name:       "Negative - Query history without name",
+			requestURL: "/api/v1/query_range",
+			method:     http.MethodGet,
+			want: want{
+				code: http.StatusBadRequest,
+			},
+		},
+		{
+			name:       "Negative - Query history of unknown metric",
+			requestURL: "/api/v1/query_range?name=foo",
+			method:     http.MethodGet,
+			want: want{
+				code: http.StatusNotFound,
+			},
+		},
 
 		// JSON HANDLERS TESTS
 		{
@@ -247,6 +276,79 @@ func TestRouter(t *testing.T) {
 				response:    `{ "id": "counterKey1", "type": "counter", "delta": 2}`,
 			},
 		},
+		{
+			name:        "JSON :: Positive - gauge with labels",
+			requestURL:  "/update/",
+			method:      http.MethodPost,
+			requestBody: `{ "id": "Alloc", "type": "gauge", "value": 1, "labels": { "host": "a" } }`,
+			want: want{
+				code:        http.StatusOK,
+				contentType: "application/json",
+			},
+		},
+		{
+			name:        "JSON :: Positive - same gauge with other labels",
+			requestURL:  "/update/",
+			method:      http.MethodPost,
+			requestBody: `{ "id": "Alloc", "type": "gauge", "value": 2, "labels": { "host": "b" } }`,
+			want: want{
+				code:        http.StatusOK,
+				contentType: "application/json",
+			},
+		},
+		{
+			name:        "JSON :: Positive - labels are part of metric identity",
+			requestURL:  "/value/",
+			method:      http.MethodPost,
+			requestBody: `{ "id": "Alloc", "type": "gauge", "labels": { "host": "a" } }`,
+			want: want{
+				code:        http.StatusOK,
+				contentType: "application/json",
+				response:    `{ "id": "Alloc", "type": "gauge", "value": 1, "labels": { "host": "a" } }`,
+			},
+		},
+		{
+			name:        "JSON :: Negative - bad label name",
+			requestURL:  "/update/",
+			method:      http.MethodPost,
+			requestBody: `{ "id": "Alloc", "type": "gauge", "value": 1, "labels": { "ho-st": "a" } }`,
+			want: want{
+				code:        http.StatusBadRequest,
+				contentType: "application/json",
+			},
+		},
+		{
+			name:        "JSON :: Positive - histogram",
+			requestURL:  "/update/",
+			method:      http.MethodPost,
+			requestBody: `{ "id": "latency", "type": "histogram", "histogram": { "bounds": [0.1, 1], "counts": [1, 1, 0], "sum": 0.5, "count": 2 } }`,
+			want: want{
+				code:        http.StatusOK,
+				contentType: "application/json",
+				response:    `{ "id": "latency", "type": "histogram", "histogram": { "bounds": [0.1, 1], "counts": [1, 1, 0], "sum": 0.5, "count": 2 } }`,
+			},
+		},
+		{
+			name:        "JSON :: Positive - histogram observations are accumulated",
+			requestURL:  "/update/",
+			method:      http.MethodPost,
+			requestBody: `{ "id": "latency", "type": "histogram", "histogram": { "bounds": [0.1, 1], "counts": [0, 0, 1], "sum": 2, "count": 1 } }`,
+			want: want{
+				code:        http.StatusOK,
+				contentType: "application/json",
+				response:    `{ "id": "latency", "type": "histogram", "histogram": { "bounds": [0.1, 1], "counts": [1, 1, 1], "sum": 2.5, "count": 3 } }`,
+			},
+		},
+		{
+			name:        "JSON :: Negative - histogram counts do not match bounds",
+			requestURL:  "/update/",
+			method:      http.MethodPost,
+			requestBody: `{ "id": "latency", "type": "histogram", "histogram": { "bounds": [0.1, 1], "counts": [1], "sum": 0.5, "count": 1 } }`,
+			want: want{
+				code:        http.StatusBadRequest,
+				contentType: "application/json",
+			},
+		},
 		{
 			name:        "JSON :: Negative - Unknown metric type",
 			requestURL:  "/value/",
@@ -317,6 +419,15 @@ func TestRouter(t *testing.T) {
 				contentType: "application/json",
 			},
 		},
+		{
+			name:        "Influx :: Negative - body too large",
+			requestURL:  "/api/v2/write",
+			requestBody: strings.Repeat("x", MaxWriteBodySize+1),
+			method:      http.MethodPost,
+			want: want{
+				code: http.StatusRequestEntityTooLarge,
+			},
+		},
 	}
 
 	for _, test := range tests {
@@ -349,3 +460,66 @@ func TestRouter(t *testing.T) {
 		})
 	}
 }
+
+func TestRouter_RequireAuth(t *testing.T) {
+	const secret = "secret"
+	const body = "cpu usage=1\n"
+
+	fs, err := storage.NewFileStorage(filepath.Join(t.TempDir(), "metrics.json"))
+	require.NoError(t, err)
+	s, err := storage.NewMemStorage(fs, false, false, storage.DefaultHistorySize)
+	require.NoError(t, err)
+
+	ts := httptest.NewServer(Router(s, zap.NewNop(), secret, nil, nil))
+	defer ts.Close()
+
+	tests := []struct {
+		name    string
+		method  string
+		path    string
+		headers map[string]string
+		code    int
+	}{
+		{name: "Influx write without auth", method: http.MethodPost, path: "/api/v2/write", code: http.StatusUnauthorized},
+		{name: "Remote write without auth", method: http.MethodPost, path: "/api/v1/write", code: http.StatusUnauthorized},
+		{name: "OTLP without auth", method: http.MethodPost, path: "/v1/metrics", code: http.StatusUnauthorized},
+		{name: "Query range without auth", method: http.MethodGet, path: "/api/v1/query_range?type=gauge&id=cpu_usage", code: http.StatusUnauthorized},
+		{
+			name: "Wrong token", method: http.MethodPost, path: "/api/v2/write",
+			headers: map[string]string{"Authorization": "Token wrong"}, code: http.StatusUnauthorized,
+		},
+		{
+			name: "Wrong signature", method: http.MethodPost, path: "/api/v2/write",
+			headers: map[string]string{utils.AuthHeaderName: hex.EncodeToString([]byte("wrong"))}, code: http.StatusBadRequest,
+		},
+		{
+			name: "Influx token", method: http.MethodPost, path: "/api/v2/write",
+			headers: map[string]string{"Authorization": "Token " + secret}, code: http.StatusNoContent,
+		},
+		{
+			name: "Bearer token", method: http.MethodPost, path: "/api/v2/write",
+			headers: map[string]string{"Authorization": "Bearer " + secret}, code: http.StatusNoContent,
+		},
+		{
+			name: "Body signature", method: http.MethodPost, path: "/api/v2/write",
+			headers: map[string]string{utils.AuthHeaderName: hex.EncodeToString(utils.Sign([]byte(body), secret).Sum(nil))},
+			code:    http.StatusNoContent,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := http.NewRequest(tt.method, ts.URL+tt.path, strings.NewReader(body))
+			require.NoError(t, err)
+			for k, v := range tt.headers {
+				req.Header.Set(k, v)
+			}
+
+			resp, err := ts.Client().Do(req)
+			require.NoError(t, err)
+			defer resp.Body.Close()
+
+			assert.Equal(t, tt.code, resp.StatusCode)
+		})
+	}
+}
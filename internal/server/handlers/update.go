@@ -2,12 +2,15 @@ package handlers
 
 import (
 	"encoding/json"
+	"errors"
 	"net/http"
+	"strconv"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/smartfor/metrics/internal/core"
 	"github.com/smartfor/metrics/internal/metrics"
 	"github.com/smartfor/metrics/internal/server/utils"
+	utils2 "github.com/smartfor/metrics/internal/utils"
 )
 
 // MakeUpdateHandler создает хендлер для обновления метрики в строковом формате
@@ -40,18 +43,24 @@ func MakeUpdateJSONHandler(s core.Storage) func(w http.ResponseWriter, r *http.R
 			return
 		}
 
+		if err := req.Labels.Validate(); err != nil {
+			utils.WriteError(w, err, http.StatusBadRequest)
+			return
+		}
+
 		mType := core.NewMetricType(req.MType)
+		key := req.Key()
 
 		switch mType {
 		case core.Counter:
 			{
-				err := s.Set(r.Context(), req.ID, utils.CounterAsString(*req.Delta), mType)
+				err := s.Set(r.Context(), key, utils.CounterAsString(*req.Delta), mType)
 				if err != nil {
 					utils.WriteError(w, err, http.StatusBadRequest)
 					return
 				}
 
-				newValue, err := s.Get(r.Context(), req.ID, mType)
+				newValue, err := s.Get(r.Context(), key, mType)
 				if err != nil {
 					utils.WriteError(w, err, http.StatusBadRequest)
 					return
@@ -71,12 +80,43 @@ func MakeUpdateJSONHandler(s core.Storage) func(w http.ResponseWriter, r *http.R
 			}
 		case core.Gauge:
 			{
-				err := s.Set(r.Context(), req.ID, utils.GaugeAsString(*req.Value), mType)
+				err := s.Set(r.Context(), key, utils.GaugeAsString(*req.Value), mType)
+				if err != nil {
+					utils.WriteError(w, err, http.StatusBadRequest)
+					return
+				}
+
+				if err = json.NewEncoder(w).Encode(req); err != nil {
+					utils.WriteError(w, err, http.StatusBadRequest)
+					return
+				}
+			}
+		case core.Histogram:
+			{
+				if req.Histogram == nil {
+					utils.WriteError(w, core.ErrBadMetricValue, http.StatusBadRequest)
+					return
+				}
+
+				err := s.Set(r.Context(), key, req.Histogram.String(), mType)
+				if err != nil {
+					utils.WriteError(w, err, http.StatusBadRequest)
+					return
+				}
+
+				newValue, err := s.Get(r.Context(), key, mType)
 				if err != nil {
 					utils.WriteError(w, err, http.StatusBadRequest)
 					return
 				}
 
+				histogram, err := core.ParseHistogram(newValue)
+				if err != nil {
+					utils.WriteError(w, err, http.StatusBadRequest)
+					return
+				}
+
+				req.Histogram = &histogram
 				if err = json.NewEncoder(w).Encode(req); err != nil {
 					utils.WriteError(w, err, http.StatusBadRequest)
 					return
@@ -103,27 +143,20 @@ func MakeBatchUpdateJSONHandler(s core.Storage) func(w http.ResponseWriter, r *h
 			return
 		}
 
-		gauges := make(map[string]float64)
-		counters := make(map[string]int64)
-
-		for _, m := range req {
-			switch core.NewMetricType(m.MType) {
-			case core.Gauge:
-				gauges[m.ID] = *m.Value
-			case core.Counter:
-				v, ok := counters[m.ID]
-				if !ok {
-					v = 0
-				}
-				counters[m.ID] = v + *m.Delta
-			default:
-				utils.WriteError(w, core.ErrUnknownMetricType, http.StatusBadRequest)
-				return
-			}
+		batch, err := metrics.ToBatch(req)
+		if err != nil {
+			utils.WriteError(w, err, http.StatusBadRequest)
+			return
 		}
 
-		batch := core.NewBaseMetricStorageWithValues(gauges, counters)
-		if err := s.SetBatch(r.Context(), batch); err != nil {
+		id, err := batchIDFromRequest(r)
+		if err != nil {
+			utils.WriteError(w, err, http.StatusBadRequest)
+			return
+		}
+
+		// Повтор уже примененной пачки подтверждается так же, как первая доставка
+		if err := core.SetBatchOnce(r.Context(), s, id, batch); err != nil && !errors.Is(err, core.ErrDuplicateBatch) {
 			utils.WriteError(w, err, http.StatusBadRequest)
 			return
 		}
@@ -131,3 +164,22 @@ func MakeBatchUpdateJSONHandler(s core.Storage) func(w http.ResponseWriter, r *h
 		w.WriteHeader(http.StatusOK)
 	}
 }
+
+// batchIDFromRequest читает идентификатор пачки из заголовков запроса.
+// Запрос без заголовков идентификатора возвращает пустой BatchID.
+func batchIDFromRequest(r *http.Request) (core.BatchID, error) {
+	id := core.BatchID{
+		AgentID: r.Header.Get(utils2.AgentIDHeader),
+		Key:     r.Header.Get(utils2.IdempotencyKeyHeader),
+	}
+
+	if seq := r.Header.Get(utils2.BatchSeqHeader); seq != "" {
+		v, err := strconv.ParseUint(seq, 10, 64)
+		if err != nil {
+			return core.BatchID{}, err
+		}
+		id.Seq = v
+	}
+
+	return id, nil
+}
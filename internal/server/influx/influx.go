@@ -0,0 +1,276 @@
+// Package influx содержит разбор InfluxDB line protocol и преобразование точек в метрики хранилища.
+package influx
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/smartfor/metrics/internal/core"
+)
+
+var (
+	ErrBadLine      = errors.New("malformed line protocol")
+	ErrBadPrecision = errors.New("unknown precision")
+)
+
+// FieldType - тип значения поля точки
+type FieldType int
+
+const (
+	FieldFloat FieldType = iota
+	FieldInteger
+	FieldUnsigned
+	FieldBoolean
+	FieldString
+)
+
+// Field - поле точки. Для строковых полей Value не заполняется.
+type Field struct {
+	Key   string
+	Type  FieldType
+	Value float64
+}
+
+// Point - точка line protocol: measurement[,tag=value...] field=value[,...] [timestamp]
+type Point struct {
+	Measurement string
+	Tags        map[string]string
+	Fields      []Field
+	Timestamp   time.Time
+}
+
+// Precision возвращает единицу времени меток точек по значению параметра precision.
+// Пустое значение означает наносекунды, как в InfluxDB.
+func Precision(value string) (time.Duration, error) {
+	switch value {
+	case "", "ns":
+		return time.Nanosecond, nil
+	case "us":
+		return time.Microsecond, nil
+	case "ms":
+		return time.Millisecond, nil
+	case "s":
+		return time.Second, nil
+	default:
+		return 0, ErrBadPrecision
+	}
+}
+
+// Parse разбирает тело запроса в формате line protocol. Точки без метки времени получают время now.
+func Parse(body []byte, precision time.Duration, now time.Time) ([]Point, error) {
+	var points []Point
+
+	for n, line := range strings.Split(string(body), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		p, err := parseLine(line, precision, now)
+		if err != nil {
+			return nil, fmt.Errorf("%w: line %d: %s", ErrBadLine, n+1, err.Error())
+		}
+		points = append(points, p)
+	}
+
+	return points, nil
+}
+
+func parseLine(line string, precision time.Duration, now time.Time) (Point, error) {
+	p := Point{Tags: make(map[string]string)}
+
+	measurement, i := scan(line, 0, ", ", false)
+	if measurement == "" {
+		return p, errors.New("missing measurement")
+	}
+	p.Measurement = measurement
+
+	for i < len(line) && line[i] == ',' {
+		var key, value string
+		key, i = scan(line, i+1, "=", false)
+		if i >= len(line) || key == "" {
+			return p, errors.New("bad tag")
+		}
+		value, i = scan(line, i+1, ", ", false)
+		if value == "" {
+			return p, errors.New("bad tag value")
+		}
+		p.Tags[key] = value
+	}
+
+	if i >= len(line) || line[i] != ' ' {
+		return p, errors.New("missing fields")
+	}
+
+	for {
+		var key, raw string
+		key, i = scan(line, i+1, "=", false)
+		if i >= len(line) || key == "" {
+			return p, errors.New("bad field")
+		}
+		raw, i = scan(line, i+1, ", ", true)
+
+		field, err := parseField(key, raw)
+		if err != nil {
+			return p, err
+		}
+		p.Fields = append(p.Fields, field)
+
+		if i >= len(line) || line[i] != ',' {
+			break
+		}
+	}
+
+	p.Timestamp = now
+	if ts := strings.TrimSpace(line[i:]); ts != "" {
+		value, err := strconv.ParseInt(ts, 10, 64)
+		if err != nil {
+			return p, errors.New("bad timestamp")
+		}
+		p.Timestamp = time.Unix(0, value*int64(precision))
+	}
+
+	return p, nil
+}
+
+// scan читает строку с позиции i до первого неэкранированного символа из stops.
+// Обратный слэш экранирует следующий символ. Если quoted, строки в двойных кавычках читаются целиком.
+func scan(line string, i int, stops string, quoted bool) (string, int) {
+	var b strings.Builder
+	inQuotes := false
+
+	for ; i < len(line); i++ {
+		c := line[i]
+		switch {
+		case c == '\\' && i+1 < len(line):
+			if inQuotes {
+				b.WriteByte(c)
+			}
+			i++
+			b.WriteByte(line[i])
+		case quoted && c == '"':
+			inQuotes = !inQuotes
+			b.WriteByte(c)
+		case !inQuotes && strings.IndexByte(stops, c) >= 0:
+			return b.String(), i
+		default:
+			b.WriteByte(c)
+		}
+	}
+
+	return b.String(), i
+}
+
+func parseField(key, raw string) (Field, error) {
+	f := Field{Key: key}
+
+	switch {
+	case len(raw) >= 2 && raw[0] == '"' && raw[len(raw)-1] == '"':
+		f.Type = FieldString
+		return f, nil
+	case strings.HasSuffix(raw, "i"):
+		v, err := strconv.ParseInt(raw[:len(raw)-1], 10, 64)
+		if err != nil {
+			return f, fmt.Errorf("bad integer field %s", key)
+		}
+		f.Type, f.Value = FieldInteger, float64(v)
+	case strings.HasSuffix(raw, "u"):
+		v, err := strconv.ParseUint(raw[:len(raw)-1], 10, 64)
+		if err != nil {
+			return f, fmt.Errorf("bad unsigned field %s", key)
+		}
+		f.Type, f.Value = FieldUnsigned, float64(v)
+	}
+
+	if f.Type != FieldFloat {
+		return f, nil
+	}
+
+	switch raw {
+	case "t", "T", "true", "True", "TRUE":
+		f.Type, f.Value = FieldBoolean, 1
+		return f, nil
+	case "f", "F", "false", "False", "FALSE":
+		f.Type, f.Value = FieldBoolean, 0
+		return f, nil
+	}
+
+	v, err := strconv.ParseFloat(raw, 64)
+	if err != nil {
+		return f, fmt.Errorf("bad float field %s", key)
+	}
+	f.Value = v
+
+	return f, nil
+}
+
+// Receiver преобразует точки line protocol в пачку метрик хранилища.
+// Целочисленные поля считаются накопительными счетчиками (байты, пакеты) и переводятся в приращения.
+// Telegraf отдает целыми числами и мгновенные значения (занятая память, число процессов):
+// поля, имена которых подходят под шаблоны gaugeFields, записываются как gauge.
+type Receiver struct {
+	tracker     *core.CounterTracker
+	gaugeFields []string
+}
+
+// NewReceiver - конструктор Receiver, где gaugeFields - шаблоны path.Match имен метрик
+// measurement_field целочисленных gauge, например "mem_*" или "processes_*".
+func NewReceiver(gaugeFields []string) *Receiver {
+	return &Receiver{tracker: core.NewCounterTracker(), gaugeFields: gaugeFields}
+}
+
+// isGauge сообщает, является ли целочисленное поле name мгновенным значением.
+func (r *Receiver) isGauge(name string) bool {
+	for _, pattern := range r.gaugeFields {
+		if ok, _ := path.Match(pattern, name); ok {
+			return true
+		}
+	}
+
+	return false
+}
+
+// ToBatch строит пачку метрик. Имя метрики - measurement_field, теги становятся метками.
+// Целочисленные поля (суффиксы i и u) записываются как counter, кроме подходящих под gaugeFields,
+// дробные числа и логические значения (1 или 0) - как gauge, строковые поля пропускаются.
+func (r *Receiver) ToBatch(points []Point) (core.BaseMetricStorage, error) {
+	batch := core.NewBaseMetricStorage()
+
+	sorted := slices.Clone(points)
+	slices.SortStableFunc(sorted, func(a, b Point) int {
+		return a.Timestamp.Compare(b.Timestamp)
+	})
+
+	for _, p := range sorted {
+		labels := make(core.Labels, len(p.Tags))
+		for k, v := range p.Tags {
+			labels[core.SanitizeLabelName(k)] = v
+		}
+		if err := labels.Validate(); err != nil {
+			return batch, err
+		}
+
+		for _, f := range p.Fields {
+			name := p.Measurement + "_" + f.Key
+			key := core.MetricKey(name, labels)
+
+			switch f.Type {
+			case FieldInteger, FieldUnsigned:
+				if r.isGauge(name) {
+					batch.SetGauge(key, f.Value)
+				} else {
+					batch.SetCounter(key, r.tracker.Delta(key, f.Value))
+				}
+			case FieldFloat, FieldBoolean:
+				batch.SetGauge(key, f.Value)
+			}
+		}
+	}
+
+	return batch, nil
+}
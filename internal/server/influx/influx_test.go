@@ -0,0 +1,99 @@
+package influx
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParse(t *testing.T) {
+	now := time.Unix(100, 0)
+
+	t.Run("Positive", func(t *testing.T) {
+		body := []byte(`# comment
+cpu,host=server\ 01,region=eu usage_idle=98.5,usage_user=1.5 1700000000
+net,interface=eth0 bytes_recv=1024i,packets=7u,up=true,name="eth 0, main"
+
+mem free=12`)
+
+		points, err := Parse(body, time.Second, now)
+		require.NoError(t, err)
+		require.Len(t, points, 3)
+
+		assert.Equal(t, "cpu", points[0].Measurement)
+		assert.Equal(t, map[string]string{"host": "server 01", "region": "eu"}, points[0].Tags)
+		assert.Equal(t, []Field{
+			{Key: "usage_idle", Type: FieldFloat, Value: 98.5},
+			{Key: "usage_user", Type: FieldFloat, Value: 1.5},
+		}, points[0].Fields)
+		assert.Equal(t, time.Unix(1700000000, 0), points[0].Timestamp)
+
+		assert.Equal(t, []Field{
+			{Key: "bytes_recv", Type: FieldInteger, Value: 1024},
+			{Key: "packets", Type: FieldUnsigned, Value: 7},
+			{Key: "up", Type: FieldBoolean, Value: 1},
+			{Key: "name", Type: FieldString},
+		}, points[1].Fields)
+		assert.Equal(t, now, points[1].Timestamp)
+
+		assert.Empty(t, points[2].Tags)
+	})
+
+	t.Run("Negative", func(t *testing.T) {
+		for _, line := range []string{
+			"cpu",
+			"cpu,host usage=1",
+			"cpu usage=",
+			"cpu usage=abc",
+			"cpu usage=1i2",
+			"cpu usage=1 notatime",
+		} {
+			_, err := Parse([]byte(line), time.Nanosecond, now)
+			assert.ErrorIs(t, err, ErrBadLine, line)
+		}
+	})
+}
+
+func TestReceiver_ToBatch(t *testing.T) {
+	now := time.Unix(100, 0)
+	r := NewReceiver([]string{"mem_*"})
+
+	points, err := Parse([]byte("net,interface=eth0 bytes=100i,up=true\ncpu,cpu-total=1 idle=90.5\nmem used=512i"), time.Nanosecond, now)
+	require.NoError(t, err)
+
+	batch, err := r.ToBatch(points)
+	require.NoError(t, err)
+
+	// Первое значение накопительного счетчика - точка отсчета
+	counter, ok := batch.GetCounter(`net_bytes{interface="eth0"}`)
+	require.True(t, ok)
+	assert.Equal(t, int64(0), counter)
+
+	up, _ := batch.GetGauge(`net_up{interface="eth0"}`)
+	assert.Equal(t, 1.0, up)
+
+	idle, ok := batch.GetGauge(`cpu_idle{cpu_total="1"}`)
+	require.True(t, ok)
+	assert.Equal(t, 90.5, idle)
+
+	// Целочисленные поля из списка gauge - мгновенные значения
+	used, ok := batch.GetGauge("mem_used")
+	require.True(t, ok)
+	assert.Equal(t, 512.0, used)
+
+	points, err = Parse([]byte("net,interface=eth0 bytes=160i\nmem used=256i"), time.Nanosecond, now)
+	require.NoError(t, err)
+
+	batch, err = r.ToBatch(points)
+	require.NoError(t, err)
+
+	counter, _ = batch.GetCounter(`net_bytes{interface="eth0"}`)
+	assert.Equal(t, int64(60), counter)
+
+	used, _ = batch.GetGauge("mem_used")
+	assert.Equal(t, 256.0, used)
+	_, ok = batch.GetCounter("mem_used")
+	assert.False(t, ok)
+}
@@ -3,9 +3,11 @@ package middlewares
 
 import (
 	"bytes"
+	"crypto/subtle"
 	"encoding/hex"
 	"io"
 	"net/http"
+	"strings"
 
 	"github.com/smartfor/metrics/internal/utils"
 )
@@ -47,3 +49,36 @@ func MakeAuthMiddleware(secret string) func(h http.Handler) http.Handler {
 		return http.HandlerFunc(fn)
 	}
 }
+
+// MakeRequireAuthMiddleware - middleware для эндпоинтов, которые вызывают сторонние клиенты
+// (Prometheus remote_write, Telegraf, OpenTelemetry Collector), и для чтения истории.
+// В отличие от MakeAuthMiddleware запрос без подписи отклоняется с 401. Принимается подпись тела
+// в заголовке HashSHA256 или секрет в заголовке Authorization: "Bearer <secret>" или "Token <secret>" (как в InfluxDB).
+func MakeRequireAuthMiddleware(secret string) func(h http.Handler) http.Handler {
+	return func(h http.Handler) http.Handler {
+		signed := MakeAuthMiddleware(secret)(h)
+
+		fn := func(w http.ResponseWriter, r *http.Request) {
+			if auth := r.Header.Get("Authorization"); auth != "" {
+				scheme, token, _ := strings.Cut(auth, " ")
+				if (strings.EqualFold(scheme, "Bearer") || strings.EqualFold(scheme, "Token")) &&
+					subtle.ConstantTimeCompare([]byte(token), []byte(secret)) == 1 {
+					h.ServeHTTP(w, r)
+					return
+				}
+
+				http.Error(w, "Invalid Authorization", http.StatusUnauthorized)
+				return
+			}
+
+			if r.Header.Get(utils.AuthHeaderName) == "" {
+				http.Error(w, "Unauthorized", http.StatusUnauthorized)
+				return
+			}
+
+			signed.ServeHTTP(w, r)
+		}
+
+		return http.HandlerFunc(fn)
+	}
+}
@@ -0,0 +1,300 @@
+// Package otlp содержит прием метрик OpenTelemetry (OTLP/HTTP) и их преобразование в метрики хранилища.
+package otlp
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/smartfor/metrics/internal/core"
+	commonpb "go.opentelemetry.io/proto/otlp/common/v1"
+	metricspb "go.opentelemetry.io/proto/otlp/metrics/v1"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/encoding/protowire"
+	"google.golang.org/protobuf/proto"
+)
+
+var (
+	ErrUnsupportedContentType = errors.New("unsupported content type")
+)
+
+const (
+	// rejectedMessage - сообщение partial_success об отброшенных точках
+	rejectedMessage = "invalid histogram data points were skipped"
+
+	ProtobufContentType = "application/x-protobuf"
+	JSONContentType     = "application/json"
+)
+
+// Decode разбирает тело запроса ExportMetricsServiceRequest в кодировке protobuf или JSON.
+// Сообщение ExportMetricsServiceRequest совпадает по схеме с MetricsData (repeated ResourceMetrics = 1),
+// поэтому разбирается в MetricsData без зависимости от пакета gRPC-сервиса коллектора.
+func Decode(body []byte, contentType string) (*metricspb.MetricsData, error) {
+	data := &metricspb.MetricsData{}
+
+	switch mediaType(contentType) {
+	case ProtobufContentType:
+		if err := proto.Unmarshal(body, data); err != nil {
+			return nil, err
+		}
+	case JSONContentType:
+		if err := (protojson.UnmarshalOptions{DiscardUnknown: true}).Unmarshal(body, data); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, ErrUnsupportedContentType
+	}
+
+	return data, nil
+}
+
+// Encode возвращает ExportMetricsServiceResponse в кодировке запроса. Если часть точек отброшена (rejected > 0),
+// ответ содержит partial_success с их числом, иначе ответ пустой.
+func Encode(contentType string, rejected int64) []byte {
+	if mediaType(contentType) == JSONContentType {
+		if rejected == 0 {
+			return []byte("{}")
+		}
+		return []byte(fmt.Sprintf(`{"partialSuccess":{"rejectedDataPoints":"%d","errorMessage":%q}}`, rejected, rejectedMessage))
+	}
+
+	if rejected == 0 {
+		return nil
+	}
+
+	// ExportMetricsPartialSuccess{rejected_data_points = 1, error_message = 2} в поле partial_success = 1
+	var partial []byte
+	partial = protowire.AppendTag(partial, 1, protowire.VarintType)
+	partial = protowire.AppendVarint(partial, uint64(rejected))
+	partial = protowire.AppendTag(partial, 2, protowire.BytesType)
+	partial = protowire.AppendString(partial, rejectedMessage)
+
+	out := protowire.AppendTag(nil, 1, protowire.BytesType)
+	return protowire.AppendBytes(out, partial)
+}
+
+func mediaType(contentType string) string {
+	t, _, _ := strings.Cut(contentType, ";")
+	return strings.TrimSpace(strings.ToLower(t))
+}
+
+// Receiver преобразует метрики OTLP в пачку метрик хранилища.
+// Накопительные (cumulative) значения переводятся в приращения (см. core.CounterTracker).
+type Receiver struct {
+	counters   *core.CounterTracker
+	histograms *histogramTracker
+}
+
+func NewReceiver() *Receiver {
+	return &Receiver{
+		counters:   core.NewCounterTracker(),
+		histograms: newHistogramTracker(),
+	}
+}
+
+// ToBatch строит пачку метрик. Атрибуты ресурса и точки становятся метками (точка перекрывает ресурс),
+// точки в имени атрибута заменяются на '_': service.name -> service_name.
+// Монотонный Sum записывается как counter, немонотонный Sum и Gauge - как gauge,
+// Histogram с явными границами - как histogram. ExponentialHistogram и Summary пропускаются.
+// Некорректные точки гистограмм отбрасываются, не отклоняя весь запрос: их число возвращается в rejected.
+func (r *Receiver) ToBatch(data *metricspb.MetricsData) (batch core.BaseMetricStorage, rejected int64, err error) {
+	batch = core.NewBaseMetricStorage()
+
+	for _, rm := range data.GetResourceMetrics() {
+		resource := toLabels(rm.GetResource().GetAttributes())
+
+		for _, sm := range rm.GetScopeMetrics() {
+			for _, m := range sm.GetMetrics() {
+				n, err := r.addMetric(&batch, m, resource)
+				if err != nil {
+					return batch, rejected, err
+				}
+				rejected += n
+			}
+		}
+	}
+
+	return batch, rejected, nil
+}
+
+func (r *Receiver) addMetric(batch *core.BaseMetricStorage, m *metricspb.Metric, resource core.Labels) (rejected int64, err error) {
+	switch data := m.GetData().(type) {
+	case *metricspb.Metric_Gauge:
+		for _, p := range data.Gauge.GetDataPoints() {
+			key, err := seriesKey(m.GetName(), resource, p.GetAttributes())
+			if err != nil {
+				return rejected, err
+			}
+			if value, ok := numberValue(p); ok {
+				batch.SetGauge(key, value)
+			}
+		}
+	case *metricspb.Metric_Sum:
+		cumulative := data.Sum.GetAggregationTemporality() == metricspb.AggregationTemporality_AGGREGATION_TEMPORALITY_CUMULATIVE
+
+		for _, p := range data.Sum.GetDataPoints() {
+			key, err := seriesKey(m.GetName(), resource, p.GetAttributes())
+			if err != nil {
+				return rejected, err
+			}
+			value, ok := numberValue(p)
+			if !ok {
+				continue
+			}
+
+			switch {
+			case !data.Sum.GetIsMonotonic():
+				// UpDownCounter хранит текущий уровень, а не накопленное количество событий
+				batch.SetGauge(key, value)
+			case cumulative:
+				batch.SetCounter(key, r.counters.DeltaSince(key, value, startTime(p.GetStartTimeUnixNano())))
+			default:
+				batch.SetCounter(key, int64(math.Round(value)))
+			}
+		}
+	case *metricspb.Metric_Histogram:
+		cumulative := data.Histogram.GetAggregationTemporality() == metricspb.AggregationTemporality_AGGREGATION_TEMPORALITY_CUMULATIVE
+
+		for _, p := range data.Histogram.GetDataPoints() {
+			if noRecordedValue(p.GetFlags()) {
+				continue
+			}
+
+			key, err := seriesKey(m.GetName(), resource, p.GetAttributes())
+			if err != nil {
+				return rejected, err
+			}
+
+			h := core.HistogramValue{
+				Bounds: slices.Clone(p.GetExplicitBounds()),
+				Counts: slices.Clone(p.GetBucketCounts()),
+				Sum:    p.GetSum(),
+				Count:  p.GetCount(),
+			}
+			if err := h.Validate(); err != nil {
+				rejected++
+				continue
+			}
+
+			if cumulative {
+				h = r.histograms.Delta(key, h, startTime(p.GetStartTimeUnixNano()))
+			}
+			batch.SetHistogram(key, h)
+		}
+	}
+
+	return rejected, nil
+}
+
+func numberValue(p *metricspb.NumberDataPoint) (float64, bool) {
+	if noRecordedValue(p.GetFlags()) {
+		return 0, false
+	}
+
+	var value float64
+	switch v := p.GetValue().(type) {
+	case *metricspb.NumberDataPoint_AsDouble:
+		value = v.AsDouble
+	case *metricspb.NumberDataPoint_AsInt:
+		value = float64(v.AsInt)
+	default:
+		return 0, false
+	}
+
+	return value, !math.IsNaN(value)
+}
+
+func noRecordedValue(flags uint32) bool {
+	return flags&uint32(metricspb.DataPointFlags_DATA_POINT_FLAGS_NO_RECORDED_VALUE_MASK) != 0
+}
+
+func seriesKey(name string, resource core.Labels, attributes []*commonpb.KeyValue) (string, error) {
+	labels := resource.Merge(toLabels(attributes))
+	if err := labels.Validate(); err != nil {
+		return "", err
+	}
+
+	return core.MetricKey(name, labels), nil
+}
+
+// toLabels переводит атрибуты со скалярными значениями в метки, составные значения пропускаются.
+func toLabels(attributes []*commonpb.KeyValue) core.Labels {
+	if len(attributes) == 0 {
+		return nil
+	}
+
+	labels := make(core.Labels, len(attributes))
+	for _, kv := range attributes {
+		var value string
+		switch v := kv.GetValue().GetValue().(type) {
+		case *commonpb.AnyValue_StringValue:
+			value = v.StringValue
+		case *commonpb.AnyValue_BoolValue:
+			value = strconv.FormatBool(v.BoolValue)
+		case *commonpb.AnyValue_IntValue:
+			value = strconv.FormatInt(v.IntValue, 10)
+		case *commonpb.AnyValue_DoubleValue:
+			value = strconv.FormatFloat(v.DoubleValue, 'g', -1, 64)
+		default:
+			continue
+		}
+
+		labels[core.SanitizeLabelName(kv.GetKey())] = value
+	}
+
+	return labels
+}
+
+// startTime переводит время начала накопления точки в time.Time, 0 - время неизвестно.
+func startTime(unixNano uint64) time.Time {
+	if unixNano == 0 {
+		return time.Time{}
+	}
+
+	return time.Unix(0, int64(unixNano))
+}
+
+// histogramTracker переводит накопительные гистограммы в приращения по тем же правилам,
+// что и core.CounterTracker для счетчиков.
+type histogramTracker struct {
+	values *core.CumulativeTracker[core.HistogramValue]
+}
+
+func newHistogramTracker() *histogramTracker {
+	return &histogramTracker{values: core.NewCumulativeTracker[core.HistogramValue](core.DefaultCumulativeTTL)}
+}
+
+// Delta возвращает приращение гистограммы серии key с прошлого вызова. Первое значение серии
+// дает пустую гистограмму (см. core.CumulativeTracker.Swap), уменьшение счетчиков или смена границ
+// считается сбросом источника.
+func (t *histogramTracker) Delta(key string, value core.HistogramValue, start time.Time) core.HistogramValue {
+	prev, ok := t.values.Swap(key, value.Clone(), start)
+	if !ok {
+		empty, _ := core.NewHistogramValue(value.Bounds)
+		return empty
+	}
+	if prev.Counts == nil {
+		// Серия началась после запуска сервера: все значение - приращение
+		return value
+	}
+
+	if !slices.Equal(prev.Bounds, value.Bounds) || value.Count < prev.Count {
+		return value
+	}
+
+	delta := value.Clone()
+	for i := range delta.Counts {
+		if delta.Counts[i] < prev.Counts[i] {
+			return value
+		}
+		delta.Counts[i] -= prev.Counts[i]
+	}
+	delta.Count -= prev.Count
+	delta.Sum -= prev.Sum
+
+	return delta
+}
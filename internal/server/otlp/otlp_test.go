@@ -0,0 +1,140 @@
+package otlp
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	commonpb "go.opentelemetry.io/proto/otlp/common/v1"
+	metricspb "go.opentelemetry.io/proto/otlp/metrics/v1"
+	resourcepb "go.opentelemetry.io/proto/otlp/resource/v1"
+	"google.golang.org/protobuf/proto"
+)
+
+func stringAttr(key, value string) *commonpb.KeyValue {
+	return &commonpb.KeyValue{Key: key, Value: &commonpb.AnyValue{Value: &commonpb.AnyValue_StringValue{StringValue: value}}}
+}
+
+func makeData(requests int64, buckets []uint64) *metricspb.MetricsData {
+	var count uint64
+	for _, c := range buckets {
+		count += c
+	}
+
+	return &metricspb.MetricsData{ResourceMetrics: []*metricspb.ResourceMetrics{{
+		Resource: &resourcepb.Resource{Attributes: []*commonpb.KeyValue{stringAttr("service.name", "api")}},
+		ScopeMetrics: []*metricspb.ScopeMetrics{{Metrics: []*metricspb.Metric{
+			{
+				Name: "requests",
+				Data: &metricspb.Metric_Sum{Sum: &metricspb.Sum{
+					IsMonotonic:            true,
+					AggregationTemporality: metricspb.AggregationTemporality_AGGREGATION_TEMPORALITY_CUMULATIVE,
+					DataPoints: []*metricspb.NumberDataPoint{{
+						Attributes: []*commonpb.KeyValue{stringAttr("method", "GET")},
+						Value:      &metricspb.NumberDataPoint_AsInt{AsInt: requests},
+					}},
+				}},
+			},
+			{
+				Name: "errors",
+				Data: &metricspb.Metric_Sum{Sum: &metricspb.Sum{
+					IsMonotonic:            true,
+					AggregationTemporality: metricspb.AggregationTemporality_AGGREGATION_TEMPORALITY_DELTA,
+					DataPoints:             []*metricspb.NumberDataPoint{{Value: &metricspb.NumberDataPoint_AsInt{AsInt: 2}}},
+				}},
+			},
+			{
+				Name: "queue",
+				Data: &metricspb.Metric_Sum{Sum: &metricspb.Sum{
+					AggregationTemporality: metricspb.AggregationTemporality_AGGREGATION_TEMPORALITY_CUMULATIVE,
+					DataPoints:             []*metricspb.NumberDataPoint{{Value: &metricspb.NumberDataPoint_AsInt{AsInt: 4}}},
+				}},
+			},
+			{
+				Name: "memory",
+				Data: &metricspb.Metric_Gauge{Gauge: &metricspb.Gauge{
+					DataPoints: []*metricspb.NumberDataPoint{{Value: &metricspb.NumberDataPoint_AsDouble{AsDouble: 12.5}}},
+				}},
+			},
+			{
+				Name: "latency",
+				Data: &metricspb.Metric_Histogram{Histogram: &metricspb.Histogram{
+					AggregationTemporality: metricspb.AggregationTemporality_AGGREGATION_TEMPORALITY_CUMULATIVE,
+					DataPoints: []*metricspb.HistogramDataPoint{{
+						ExplicitBounds: []float64{0.1, 1},
+						BucketCounts:   buckets,
+						Count:          count,
+						Sum:            proto.Float64(float64(count)),
+					}},
+				}},
+			},
+		}}},
+	}}}
+}
+
+func TestDecode(t *testing.T) {
+	data := makeData(10, []uint64{1, 2, 3})
+
+	body, err := proto.Marshal(data)
+	require.NoError(t, err)
+	decoded, err := Decode(body, "application/x-protobuf")
+	require.NoError(t, err)
+	assert.True(t, proto.Equal(data, decoded))
+
+	json := []byte(`{"resourceMetrics":[{"scopeMetrics":[{"metrics":[{"name":"memory","gauge":{"dataPoints":[{"asDouble":12.5,"attributes":[{"key":"host","value":{"stringValue":"a"}}]}]}}]}]}]}`)
+	decoded, err = Decode(json, "application/json; charset=utf-8")
+	require.NoError(t, err)
+	assert.Equal(t, "memory", decoded.GetResourceMetrics()[0].GetScopeMetrics()[0].GetMetrics()[0].GetName())
+
+	_, err = Decode(body, "text/plain")
+	assert.ErrorIs(t, err, ErrUnsupportedContentType)
+}
+
+func TestReceiver_ToBatch(t *testing.T) {
+	r := NewReceiver()
+
+	batch, rejected, err := r.ToBatch(makeData(10, []uint64{1, 2, 3}))
+	require.NoError(t, err)
+	assert.Zero(t, rejected)
+
+	// Первое накопительное значение - точка отсчета
+	requests, ok := batch.GetCounter(`requests{method="GET",service_name="api"}`)
+	require.True(t, ok)
+	assert.Equal(t, int64(0), requests)
+
+	errors, _ := batch.GetCounter(`errors{service_name="api"}`)
+	assert.Equal(t, int64(2), errors)
+
+	queue, ok := batch.GetGauge(`queue{service_name="api"}`)
+	require.True(t, ok)
+	assert.Equal(t, 4.0, queue)
+
+	memory, _ := batch.GetGauge(`memory{service_name="api"}`)
+	assert.Equal(t, 12.5, memory)
+
+	batch, _, err = r.ToBatch(makeData(25, []uint64{2, 2, 5}))
+	require.NoError(t, err)
+
+	requests, _ = batch.GetCounter(`requests{method="GET",service_name="api"}`)
+	assert.Equal(t, int64(15), requests)
+
+	latency, ok := batch.GetHistogram(`latency{service_name="api"}`)
+	require.True(t, ok)
+	assert.Equal(t, []uint64{1, 0, 2}, latency.Counts)
+	assert.Equal(t, uint64(3), latency.Count)
+
+	// Гистограмма без bucket_counts отбрасывается, остальные точки записываются
+	batch, rejected, err = r.ToBatch(makeData(30, nil))
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), rejected)
+
+	requests, _ = batch.GetCounter(`requests{method="GET",service_name="api"}`)
+	assert.Equal(t, int64(5), requests)
+	_, ok = batch.GetHistogram(`latency{service_name="api"}`)
+	assert.False(t, ok)
+
+	assert.JSONEq(t,
+		`{"partialSuccess":{"rejectedDataPoints":"1","errorMessage":"invalid histogram data points were skipped"}}`,
+		string(Encode(JSONContentType, rejected)),
+	)
+}
@@ -0,0 +1,285 @@
+// Package remotewrite содержит разбор запросов Prometheus remote_write и их преобразование в метрики хранилища.
+package remotewrite
+
+import (
+	"errors"
+	"math"
+	"slices"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/klauspost/compress/snappy"
+	"github.com/smartfor/metrics/internal/core"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+var (
+	ErrBadRequest    = errors.New("malformed remote write request")
+	ErrTooLarge      = errors.New("remote write request is too large")
+	ErrMissingName   = errors.New("time series without __name__ label")
+	ErrBadLabelValue = errors.New("label is not valid utf-8")
+)
+
+const (
+	// NameLabel - служебная метка Prometheus с именем метрики
+	NameLabel = "__name__"
+	// MaxDecodedSize - ограничение размера распакованного тела запроса
+	MaxDecodedSize = 32 << 20
+)
+
+// counterSuffixes - суффиксы имен, по которым метрика считается накопительным счетчиком
+var counterSuffixes = []string{"_total", "_count", "_sum", "_bucket"}
+
+// Sample - значение серии в момент времени (миллисекунды unix)
+type Sample struct {
+	Value     float64
+	Timestamp int64
+}
+
+// TimeSeries - серия из запроса remote_write: метки вместе с __name__ и значения
+type TimeSeries struct {
+	Labels  map[string]string
+	Samples []Sample
+}
+
+// Decode распаковывает тело запроса (snappy block format) и разбирает protobuf-сообщение WriteRequest.
+func Decode(body []byte) ([]TimeSeries, error) {
+	size, err := snappy.DecodedLen(body)
+	if err != nil {
+		return nil, err
+	}
+	if size > MaxDecodedSize {
+		return nil, ErrTooLarge
+	}
+
+	data, err := snappy.Decode(nil, body)
+	if err != nil {
+		return nil, err
+	}
+
+	return decodeWriteRequest(data)
+}
+
+// Receiver преобразует серии remote_write в пачку метрик хранилища.
+// Накопительные значения счетчиков переводятся в приращения (см. core.CounterTracker).
+type Receiver struct {
+	tracker *core.CounterTracker
+}
+
+func NewReceiver() *Receiver {
+	return &Receiver{tracker: core.NewCounterTracker()}
+}
+
+// ToBatch строит пачку метрик: имя берется из метки __name__, остальные метки становятся метками метрики.
+// Метрики с суффиксами _total, _count, _sum и _bucket записываются как counter, остальные - как gauge.
+func (r *Receiver) ToBatch(series []TimeSeries) (core.BaseMetricStorage, error) {
+	batch := core.NewBaseMetricStorage()
+
+	for _, ts := range series {
+		name, ok := ts.Labels[NameLabel]
+		if !ok || name == "" {
+			return batch, ErrMissingName
+		}
+
+		labels := make(core.Labels, len(ts.Labels)-1)
+		for k, v := range ts.Labels {
+			if k != NameLabel {
+				labels[k] = v
+			}
+		}
+		if err := labels.Validate(); err != nil {
+			return batch, err
+		}
+
+		key := core.MetricKey(name, labels)
+		samples := slices.Clone(ts.Samples)
+		slices.SortStableFunc(samples, func(a, b Sample) int {
+			switch {
+			case a.Timestamp < b.Timestamp:
+				return -1
+			case a.Timestamp > b.Timestamp:
+				return 1
+			default:
+				return 0
+			}
+		})
+
+		for _, s := range samples {
+			// NaN используется Prometheus как маркер устаревшей серии
+			if math.IsNaN(s.Value) {
+				continue
+			}
+
+			if isCounterName(name) {
+				batch.SetCounter(key, r.tracker.Delta(key, s.Value))
+			} else {
+				batch.SetGauge(key, s.Value)
+			}
+		}
+	}
+
+	return batch, nil
+}
+
+func isCounterName(name string) bool {
+	for _, suffix := range counterSuffixes {
+		if strings.HasSuffix(name, suffix) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// decodeWriteRequest разбирает сообщение
+//
+//	message WriteRequest { repeated TimeSeries timeseries = 1; ... }
+//
+// Остальные поля (metadata, exemplars, native histograms) пропускаются.
+func decodeWriteRequest(b []byte) ([]TimeSeries, error) {
+	var out []TimeSeries
+
+	err := walkFields(b, func(num protowire.Number, typ protowire.Type, v []byte) error {
+		if num != 1 || typ != protowire.BytesType {
+			return nil
+		}
+
+		ts, err := decodeTimeSeries(v)
+		if err != nil {
+			return err
+		}
+		out = append(out, ts)
+
+		return nil
+	})
+
+	return out, err
+}
+
+// decodeTimeSeries разбирает сообщение
+//
+//	message TimeSeries { repeated Label labels = 1; repeated Sample samples = 2; ... }
+func decodeTimeSeries(b []byte) (TimeSeries, error) {
+	ts := TimeSeries{Labels: make(map[string]string)}
+
+	err := walkFields(b, func(num protowire.Number, typ protowire.Type, v []byte) error {
+		if typ != protowire.BytesType {
+			return nil
+		}
+
+		switch num {
+		case 1:
+			name, value, err := decodeLabel(v)
+			if err != nil {
+				return err
+			}
+			ts.Labels[name] = value
+		case 2:
+			s, err := decodeSample(v)
+			if err != nil {
+				return err
+			}
+			ts.Samples = append(ts.Samples, s)
+		}
+
+		return nil
+	})
+
+	return ts, err
+}
+
+// decodeLabel разбирает сообщение message Label { string name = 1; string value = 2; }
+func decodeLabel(b []byte) (string, string, error) {
+	var name, value string
+
+	err := walkFields(b, func(num protowire.Number, typ protowire.Type, v []byte) error {
+		if typ != protowire.BytesType {
+			return nil
+		}
+
+		switch num {
+		case 1:
+			name = string(v)
+		case 2:
+			value = string(v)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return "", "", err
+	}
+
+	if !utf8.ValidString(name) || !utf8.ValidString(value) {
+		return "", "", ErrBadLabelValue
+	}
+
+	return name, value, nil
+}
+
+// decodeSample разбирает сообщение message Sample { double value = 1; int64 timestamp = 2; }
+func decodeSample(b []byte) (Sample, error) {
+	var s Sample
+
+	for len(b) > 0 {
+		num, typ, n := protowire.ConsumeTag(b)
+		if n < 0 {
+			return s, ErrBadRequest
+		}
+		b = b[n:]
+
+		switch {
+		case num == 1 && typ == protowire.Fixed64Type:
+			v, n := protowire.ConsumeFixed64(b)
+			if n < 0 {
+				return s, ErrBadRequest
+			}
+			s.Value = math.Float64frombits(v)
+			b = b[n:]
+		case num == 2 && typ == protowire.VarintType:
+			v, n := protowire.ConsumeVarint(b)
+			if n < 0 {
+				return s, ErrBadRequest
+			}
+			s.Timestamp = int64(v)
+			b = b[n:]
+		default:
+			n := protowire.ConsumeFieldValue(num, typ, b)
+			if n < 0 {
+				return s, ErrBadRequest
+			}
+			b = b[n:]
+		}
+	}
+
+	return s, nil
+}
+
+// walkFields обходит поля protobuf-сообщения. Для полей типа bytes в fn передается их содержимое,
+// значения остальных типов пропускаются.
+func walkFields(b []byte, fn func(num protowire.Number, typ protowire.Type, v []byte) error) error {
+	for len(b) > 0 {
+		num, typ, n := protowire.ConsumeTag(b)
+		if n < 0 {
+			return ErrBadRequest
+		}
+		b = b[n:]
+
+		var v []byte
+		if typ == protowire.BytesType {
+			v, n = protowire.ConsumeBytes(b)
+		} else {
+			n = protowire.ConsumeFieldValue(num, typ, b)
+		}
+		if n < 0 {
+			return ErrBadRequest
+		}
+		b = b[n:]
+
+		if err := fn(num, typ, v); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,114 @@
+package remotewrite
+
+import (
+	"math"
+	"testing"
+
+	"github.com/klauspost/compress/snappy"
+	"github.com/smartfor/metrics/internal/core"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+func encodeSeries(labels [][2]string, samples []Sample) []byte {
+	var ts []byte
+	for _, l := range labels {
+		var label []byte
+		label = protowire.AppendTag(label, 1, protowire.BytesType)
+		label = protowire.AppendString(label, l[0])
+		label = protowire.AppendTag(label, 2, protowire.BytesType)
+		label = protowire.AppendString(label, l[1])
+
+		ts = protowire.AppendTag(ts, 1, protowire.BytesType)
+		ts = protowire.AppendBytes(ts, label)
+	}
+
+	for _, s := range samples {
+		var sample []byte
+		sample = protowire.AppendTag(sample, 1, protowire.Fixed64Type)
+		sample = protowire.AppendFixed64(sample, math.Float64bits(s.Value))
+		sample = protowire.AppendTag(sample, 2, protowire.VarintType)
+		sample = protowire.AppendVarint(sample, uint64(s.Timestamp))
+
+		ts = protowire.AppendTag(ts, 2, protowire.BytesType)
+		ts = protowire.AppendBytes(ts, sample)
+	}
+
+	return ts
+}
+
+func encodeWriteRequest(series ...[]byte) []byte {
+	var req []byte
+	for _, ts := range series {
+		req = protowire.AppendTag(req, 1, protowire.BytesType)
+		req = protowire.AppendBytes(req, ts)
+	}
+
+	return snappy.Encode(nil, req)
+}
+
+func TestReceiver(t *testing.T) {
+	receiver := NewReceiver()
+
+	first := encodeWriteRequest(
+		encodeSeries(
+			[][2]string{{"__name__", "http_requests_total"}, {"job", "api"}},
+			[]Sample{{Value: 100, Timestamp: 1000}},
+		),
+		encodeSeries(
+			[][2]string{{"__name__", "queue_depth"}},
+			[]Sample{{Value: 7, Timestamp: 2000}, {Value: 5, Timestamp: 1000}},
+		),
+	)
+
+	series, err := Decode(first)
+	require.NoError(t, err)
+	require.Len(t, series, 2)
+
+	batch, err := receiver.ToBatch(series)
+	require.NoError(t, err)
+
+	counterKey := core.MetricKey("http_requests_total", core.Labels{"job": "api"})
+	delta, ok := batch.GetCounter(counterKey)
+	require.True(t, ok)
+	assert.Equal(t, int64(0), delta, "first cumulative value is a baseline")
+
+	gauge, ok := batch.GetGauge("queue_depth")
+	require.True(t, ok)
+	assert.Equal(t, 7.0, gauge, "latest sample by timestamp wins")
+
+	second := encodeWriteRequest(encodeSeries(
+		[][2]string{{"__name__", "http_requests_total"}, {"job", "api"}},
+		[]Sample{{Value: 130, Timestamp: 3000}, {Value: 10, Timestamp: 4000}},
+	))
+
+	series, err = Decode(second)
+	require.NoError(t, err)
+
+	batch, err = receiver.ToBatch(series)
+	require.NoError(t, err)
+
+	delta, _ = batch.GetCounter(counterKey)
+	assert.Equal(t, int64(40), delta, "increase plus value after counter reset")
+}
+
+func TestDecode_Negative(t *testing.T) {
+	t.Run("not snappy", func(t *testing.T) {
+		_, err := Decode([]byte("not a snappy block"))
+		require.Error(t, err)
+	})
+
+	t.Run("truncated protobuf", func(t *testing.T) {
+		_, err := Decode(snappy.Encode(nil, []byte{0x0a, 0x10, 0x01}))
+		require.ErrorIs(t, err, ErrBadRequest)
+	})
+
+	t.Run("series without name", func(t *testing.T) {
+		series, err := Decode(encodeWriteRequest(encodeSeries([][2]string{{"job", "api"}}, nil)))
+		require.NoError(t, err)
+
+		_, err = NewReceiver().ToBatch(series)
+		require.ErrorIs(t, err, ErrMissingName)
+	})
+}
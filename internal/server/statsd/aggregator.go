@@ -0,0 +1,114 @@
+package statsd
+
+import (
+	"math"
+	"sync"
+
+	"github.com/smartfor/metrics/internal/core"
+)
+
+const (
+	// maxTimerWeight - ограничение числа измерений клиента, которое представляет одно полученное измерение
+	maxTimerWeight = math.MaxUint32
+	// maxGaugeIdleFlushes - число сбросов без обновлений, после которого последнее значение gauge забывается
+	maxGaugeIdleFlushes = 10
+)
+
+// lastGauge - последнее значение gauge и число сбросов, прошедших без его обновления
+type lastGauge struct {
+	value float64
+	idle  int
+}
+
+// Aggregator накапливает значения StatsD между сбросами в хранилище.
+// Счетчики суммируются с учетом sample rate, для gauge сохраняется последнее значение,
+// тайминги (мс) складываются в гистограмму с границами bounds в секундах.
+type Aggregator struct {
+	mu         *sync.Mutex
+	bounds     []float64
+	counters   map[string]float64
+	gauges     map[string]float64
+	histograms map[string]core.HistogramValue
+	// lastGauges - последние значения gauge, нужны для относительных изменений (+N/-N) между сбросами.
+	// Значения, не обновлявшиеся maxGaugeIdleFlushes сбросов, удаляются при сбросе.
+	lastGauges map[string]lastGauge
+}
+
+func NewAggregator(bounds []float64) *Aggregator {
+	if len(bounds) == 0 {
+		bounds = core.DefaultHistogramBounds
+	}
+
+	return &Aggregator{
+		mu:         &sync.Mutex{},
+		bounds:     bounds,
+		counters:   make(map[string]float64),
+		gauges:     make(map[string]float64),
+		histograms: make(map[string]core.HistogramValue),
+		lastGauges: make(map[string]lastGauge),
+	}
+}
+
+// Add учитывает одну разобранную строку.
+func (a *Aggregator) Add(line Line) {
+	key := core.MetricKey(line.Name, line.Labels)
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	switch line.Kind {
+	case KindCounter:
+		a.counters[key] += line.Value / line.SampleRate
+	case KindGauge:
+		value := line.Value
+		if line.Relative {
+			value += a.lastGauges[key].value
+		}
+		a.gauges[key] = value
+		a.lastGauges[key] = lastGauge{value: value}
+	case KindTimer:
+		h, ok := a.histograms[key]
+		if !ok {
+			h, _ = core.NewHistogramValue(a.bounds)
+		}
+
+		// Каждое полученное измерение представляет 1/rate измерений клиента
+		n := math.Min(math.Max(1, math.Round(1/line.SampleRate)), maxTimerWeight)
+		h.ObserveN(line.Value/1000, uint64(n))
+		a.histograms[key] = h
+	}
+}
+
+// Flush возвращает накопленные значения в виде пачки метрик и очищает аккумулятор.
+// Дробная часть счетчиков, полученная из-за sample rate, округляется.
+func (a *Aggregator) Flush() core.BaseMetricStorage {
+	a.mu.Lock()
+	counters, gauges, histograms := a.counters, a.gauges, a.histograms
+	for key, last := range a.lastGauges {
+		if _, ok := gauges[key]; ok {
+			continue
+		}
+		if last.idle++; last.idle >= maxGaugeIdleFlushes {
+			delete(a.lastGauges, key)
+			continue
+		}
+		a.lastGauges[key] = last
+	}
+	a.counters = make(map[string]float64)
+	a.gauges = make(map[string]float64)
+	a.histograms = make(map[string]core.HistogramValue)
+	a.mu.Unlock()
+
+	batch := core.NewBaseMetricStorage()
+	for key, value := range counters {
+		batch.SetCounter(key, int64(math.Round(value)))
+	}
+	for key, value := range gauges {
+		batch.SetGauge(key, value)
+	}
+	for key, value := range histograms {
+		batch.SetHistogram(key, value)
+	}
+
+	return batch
+}
@@ -0,0 +1,109 @@
+// Package statsd содержит прием метрик по протоколу StatsD через UDP.
+// Пакеты агрегируются в памяти и периодически записываются в core.Storage одной пачкой.
+package statsd
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+
+	"github.com/smartfor/metrics/internal/core"
+)
+
+var (
+	ErrBadLine       = errors.New("malformed statsd line")
+	ErrBadValue      = errors.New("bad statsd value")
+	ErrBadSampleRate = errors.New("bad statsd sample rate")
+	ErrUnknownType   = errors.New("unknown statsd metric type")
+)
+
+// Kind - тип метрики StatsD
+type Kind string
+
+const (
+	KindCounter Kind = "c"
+	KindGauge   Kind = "g"
+	KindTimer   Kind = "ms"
+)
+
+// Line - разобранная строка протокола StatsD
+type Line struct {
+	Name  string
+	Kind  Kind
+	Value float64
+	// Relative - значение gauge задано со знаком (+N или -N) и изменяет текущее значение
+	Relative bool
+	// SampleRate - доля отправленных клиентом событий (0, 1]
+	SampleRate float64
+	// Labels - теги в формате DogStatsD: |#key:value,key2:value2
+	Labels core.Labels
+}
+
+// Parse разбирает строку вида name:value|type[|@rate][|#tag:value,...].
+func Parse(line string) (Line, error) {
+	name, rest, ok := strings.Cut(line, ":")
+	if !ok || name == "" {
+		return Line{}, ErrBadLine
+	}
+
+	parts := strings.Split(rest, "|")
+	if len(parts) < 2 {
+		return Line{}, ErrBadLine
+	}
+
+	out := Line{
+		Name:       name,
+		Kind:       Kind(parts[1]),
+		SampleRate: 1,
+	}
+
+	switch out.Kind {
+	case KindCounter, KindGauge, KindTimer:
+	default:
+		return Line{}, ErrUnknownType
+	}
+
+	raw := parts[0]
+	if out.Kind == KindGauge && (strings.HasPrefix(raw, "+") || strings.HasPrefix(raw, "-")) {
+		out.Relative = true
+	}
+
+	value, err := strconv.ParseFloat(raw, 64)
+	if err != nil {
+		return Line{}, ErrBadValue
+	}
+	out.Value = value
+
+	for _, part := range parts[2:] {
+		switch {
+		case strings.HasPrefix(part, "@"):
+			rate, err := strconv.ParseFloat(part[1:], 64)
+			if err != nil || rate <= 0 || rate > 1 {
+				return Line{}, ErrBadSampleRate
+			}
+			out.SampleRate = rate
+		case strings.HasPrefix(part, "#"):
+			out.Labels = parseTags(part[1:])
+		default:
+			return Line{}, ErrBadLine
+		}
+	}
+
+	return out, nil
+}
+
+// parseTags разбирает теги вида key:value через запятую. Недопустимые символы в именах меток
+// заменяются на '_' (core.SanitizeLabelName), теги без имени пропускаются.
+func parseTags(raw string) core.Labels {
+	labels := core.Labels{}
+	for _, tag := range strings.Split(raw, ",") {
+		key, value, _ := strings.Cut(tag, ":")
+		if key == "" {
+			continue
+		}
+
+		labels[core.SanitizeLabelName(key)] = value
+	}
+
+	return labels
+}
@@ -0,0 +1,118 @@
+package statsd
+
+import (
+	"context"
+	"errors"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/smartfor/metrics/internal/core"
+	"go.uber.org/zap"
+)
+
+// maxPacketSize - максимальный размер UDP-датаграммы
+const maxPacketSize = 65535
+
+// Server - UDP-приемник StatsD
+type Server struct {
+	conn       net.PacketConn
+	storage    core.Storage
+	aggregator *Aggregator
+	interval   time.Duration
+	logger     *zap.Logger
+}
+
+// NewServer открывает UDP-сокет address. Накопленные метрики записываются в storage каждые interval.
+func NewServer(address string, storage core.Storage, interval time.Duration, logger *zap.Logger) (*Server, error) {
+	conn, err := net.ListenPacket("udp", address)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Server{
+		conn:       conn,
+		storage:    storage,
+		aggregator: NewAggregator(nil),
+		interval:   interval,
+		logger:     logger,
+	}, nil
+}
+
+// Addr возвращает фактический адрес сокета.
+func (s *Server) Addr() net.Addr {
+	return s.conn.LocalAddr()
+}
+
+// Run читает пакеты до отмены parent. Перед выходом накопленные метрики сбрасываются в хранилище.
+func (s *Server) Run(parent context.Context) error {
+	ctx, cancel := context.WithCancel(parent)
+	defer cancel()
+
+	go func() {
+		<-ctx.Done()
+		s.conn.Close()
+	}()
+
+	flushDone := make(chan struct{})
+	go func() {
+		defer close(flushDone)
+
+		ticker := time.NewTicker(s.interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				s.flush(context.Background())
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	buf := make([]byte, maxPacketSize)
+	for {
+		n, _, err := s.conn.ReadFrom(buf)
+		if err != nil {
+			cancel()
+			<-flushDone
+			s.flush(context.Background())
+
+			if parent.Err() != nil || errors.Is(err, net.ErrClosed) {
+				return nil
+			}
+			return err
+		}
+
+		s.handlePacket(string(buf[:n]))
+	}
+}
+
+func (s *Server) handlePacket(packet string) {
+	for _, raw := range strings.Split(packet, "\n") {
+		raw = strings.TrimSpace(raw)
+		if raw == "" {
+			continue
+		}
+
+		line, err := Parse(raw)
+		if err != nil {
+			s.logger.Debug("Skip statsd line", zap.String("line", raw), zap.Error(err))
+			continue
+		}
+
+		s.aggregator.Add(line)
+	}
+}
+
+func (s *Server) flush(ctx context.Context) {
+	batch := s.aggregator.Flush()
+	if len(batch.Counters()) == 0 && len(batch.Gauges()) == 0 && len(batch.Histograms()) == 0 {
+		return
+	}
+
+	if err := s.storage.SetBatch(ctx, batch); err != nil {
+		s.logger.Error("Error flushing statsd metrics: ", zap.Error(err))
+	}
+}
@@ -0,0 +1,183 @@
+package statsd
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/smartfor/metrics/internal/core"
+	"github.com/smartfor/metrics/internal/server/storage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name    string
+		line    string
+		want    Line
+		wantErr error
+	}{
+		{
+			name: "counter",
+			line: "requests:1|c",
+			want: Line{Name: "requests", Kind: KindCounter, Value: 1, SampleRate: 1},
+		},
+		{
+			name: "counter with sample rate",
+			line: "requests:2|c|@0.5",
+			want: Line{Name: "requests", Kind: KindCounter, Value: 2, SampleRate: 0.5},
+		},
+		{
+			name: "relative gauge",
+			line: "queue:-3|g",
+			want: Line{Name: "queue", Kind: KindGauge, Value: -3, Relative: true, SampleRate: 1},
+		},
+		{
+			name: "timer with tags",
+			line: "latency:250|ms|#host:a,env:prod",
+			want: Line{Name: "latency", Kind: KindTimer, Value: 250, SampleRate: 1, Labels: core.Labels{"host": "a", "env": "prod"}},
+		},
+		{
+			name: "tags with invalid names are sanitized",
+			line: "latency:250|ms|#service.name:api,:x",
+			want: Line{Name: "latency", Kind: KindTimer, Value: 250, SampleRate: 1, Labels: core.Labels{"service_name": "api"}},
+		},
+		{name: "no value", line: "requests", wantErr: ErrBadLine},
+		{name: "no type", line: "requests:1", wantErr: ErrBadLine},
+		{name: "unknown type", line: "requests:1|s", wantErr: ErrUnknownType},
+		{name: "bad value", line: "requests:abc|c", wantErr: ErrBadValue},
+		{name: "bad sample rate", line: "requests:1|c|@2", wantErr: ErrBadSampleRate},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Parse(tt.line)
+			if tt.wantErr != nil {
+				assert.ErrorIs(t, err, tt.wantErr)
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestAggregator(t *testing.T) {
+	a := NewAggregator(nil)
+	for _, raw := range []string{
+		"requests:1|c",
+		"requests:1|c|@0.1",
+		"queue:10|g",
+		"queue:+5|g",
+		"latency:20|ms",
+		"latency:300|ms",
+	} {
+		line, err := Parse(raw)
+		require.NoError(t, err)
+		a.Add(line)
+	}
+
+	batch := a.Flush()
+
+	counter, _ := batch.GetCounter("requests")
+	assert.Equal(t, int64(11), counter)
+
+	gauge, _ := batch.GetGauge("queue")
+	assert.Equal(t, 15.0, gauge)
+
+	h, ok := batch.GetHistogram("latency")
+	require.True(t, ok)
+	assert.Equal(t, uint64(2), h.Count)
+	assert.InDelta(t, 0.32, h.Sum, 1e-9)
+
+	// После сброса аккумулятор пуст, но относительный gauge продолжает от последнего значения
+	line, err := Parse("queue:-1|g")
+	require.NoError(t, err)
+	a.Add(line)
+
+	batch = a.Flush()
+	assert.Empty(t, batch.Counters())
+	gauge, _ = batch.GetGauge("queue")
+	assert.Equal(t, 14.0, gauge)
+
+	// Малый sample rate учитывается весом наблюдения, а не повторением
+	line, err = Parse("latency:20|ms|@0.0000001")
+	require.NoError(t, err)
+	a.Add(line)
+
+	batch = a.Flush()
+	h, ok = batch.GetHistogram("latency")
+	require.True(t, ok)
+	assert.Equal(t, uint64(10_000_000), h.Count)
+	assert.InDelta(t, 200_000, h.Sum, 1e-6)
+}
+
+func TestAggregator_ExpiresIdleGauges(t *testing.T) {
+	a := NewAggregator(nil)
+
+	line, err := Parse("queue:10|g")
+	require.NoError(t, err)
+	a.Add(line)
+	a.Flush()
+
+	for i := 0; i < maxGaugeIdleFlushes-1; i++ {
+		a.Flush()
+	}
+	assert.Len(t, a.lastGauges, 1)
+
+	a.Flush()
+	assert.Empty(t, a.lastGauges)
+
+	// Забытый gauge отсчитывает относительное изменение от нуля
+	line, err = Parse("queue:+1|g")
+	require.NoError(t, err)
+	a.Add(line)
+
+	batch := a.Flush()
+	gauge, _ := batch.GetGauge("queue")
+	assert.Equal(t, 1.0, gauge)
+	assert.Len(t, a.lastGauges, 1)
+}
+
+func TestServer(t *testing.T) {
+	fs, err := storage.NewFileStorage("/tmp/metrics-statsd.json")
+	require.NoError(t, err)
+	s, err := storage.NewMemStorage(fs, false, false, 0)
+	require.NoError(t, err)
+
+	server, err := NewServer("127.0.0.1:0", s, time.Hour, zap.NewNop())
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- server.Run(ctx) }()
+
+	conn, err := net.Dial("udp", server.Addr().String())
+	require.NoError(t, err)
+	defer conn.Close()
+
+	_, err = conn.Write([]byte("hits:3|c\nhits:2|c\nbroken line\ntemp:21.5|g|#room:kitchen"))
+	require.NoError(t, err)
+
+	require.Eventually(t, func() bool {
+		server.aggregator.mu.Lock()
+		defer server.aggregator.mu.Unlock()
+		return len(server.aggregator.gauges) == 1
+	}, time.Second, 10*time.Millisecond)
+
+	// Остановка сбрасывает накопленные метрики в хранилище
+	cancel()
+	require.NoError(t, <-done)
+
+	hits, err := s.Get(ctx, "hits", core.Counter)
+	require.NoError(t, err)
+	assert.Equal(t, "5", hits)
+
+	temp, err := s.Get(ctx, `temp{room="kitchen"}`, core.Gauge)
+	require.NoError(t, err)
+	assert.Equal(t, "21.5", temp)
+}
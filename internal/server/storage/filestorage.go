@@ -5,18 +5,32 @@ import (
 	"context"
 	"encoding/json"
 	"errors"
-	"io"
-	"os"
 	"sync"
+	"time"
 
 	"github.com/smartfor/metrics/internal/core"
 	"github.com/smartfor/metrics/internal/server/utils"
-	utils2 "github.com/smartfor/metrics/internal/utils"
+)
+
+const (
+	// walSuffix - суффикс файла журнала рядом с файлом снимка
+	walSuffix = ".wal"
+	// defaultCompactSize - размер журнала, после которого он сворачивается в снимок
+	defaultCompactSize = 4 << 20
 )
 
 type metrics struct {
-	Gauges   map[string]float64 `json:"gauges"`
-	Counters map[string]int64   `json:"counters"`
+	Gauges     map[string]float64             `json:"gauges"`
+	Counters   map[string]int64               `json:"counters"`
+	Histograms map[string]core.HistogramValue `json:"histograms"`
+}
+
+func newMetrics() *metrics {
+	return &metrics{
+		Gauges:     make(map[string]float64),
+		Counters:   make(map[string]int64),
+		Histograms: make(map[string]core.HistogramValue),
+	}
 }
 
 func (metrics *metrics) ToBaseStorage() *core.BaseMetricStorage {
@@ -30,80 +44,181 @@ func (metrics *metrics) ToBaseStorage() *core.BaseMetricStorage {
 		s.SetCounter(k, v)
 	}
 
+	for k, v := range metrics.Histograms {
+		s.SetHistogram(k, v)
+	}
+
 	return &s
 }
 
-// FileStorage - тип для хранения состояния метрик в файле
+// Операции записей журнала
+const (
+	// walOpSet - значения заменяют текущие (Set, SetValues)
+	walOpSet = "set"
+	// walOpAdd - значения добавляются к текущим как в SetBatch
+	walOpAdd = "add"
+)
+
+type walRecord struct {
+	Seq        uint64                         `json:"seq"`
+	Op         string                         `json:"op"`
+	Gauges     map[string]float64             `json:"gauges,omitempty"`
+	Counters   map[string]int64               `json:"counters,omitempty"`
+	Histograms map[string]core.HistogramValue `json:"histograms,omitempty"`
+}
+
+// FileStorage - тип для хранения состояния метрик в файле.
+// Метрики хранятся в памяти, а каждое изменение дописывается в журнал <path>.wal
+// и сбрасывается на диск до возврата из метода. Когда журнал вырастает или вызван Snapshot,
+// состояние сохраняется в новое поколение снимка <path> и журнал очищается. При открытии
+// состояние восстанавливается из самого нового целого снимка и журнала, недописанная
+// при сбое последняя запись журнала отбрасывается.
 type FileStorage struct {
-	file    *os.File
-	mu      *sync.Mutex
-	encoder *json.Encoder
+	path        string
+	generations int
+	encoding    snapshotEncoding
+	mu          *sync.Mutex
+	state       *metrics
+	wal         *wal
+	seq         uint64
+	compactSize int64
+	applied     *core.AppliedBatches
+}
+
+// FileStorageConfig - настройки файлового хранилища
+type FileStorageConfig struct {
+	// Path - путь к файлу снимка, журнал хранится рядом в <Path>.wal
+	Path string
+	// Generations - число хранимых снимков вместе с текущим, по умолчанию DefaultSnapshotGenerations
+	Generations int
+	// Format - формат записи снимков, по умолчанию SnapshotFormatJSON
+	Format SnapshotFormat
+	// Compression - сжатие снимков, по умолчанию SnapshotCompressionNone
+	Compression SnapshotCompression
 }
 
 // NewFileStorage - конструктор для создания файлового хранилища
 // где filepath - это путь к файлу в котором будут храниться метрики.
 func NewFileStorage(filepath string) (*FileStorage, error) {
-	file, err := os.OpenFile(filepath, os.O_RDWR|os.O_CREATE, 0666)
+	return NewFileStorageWithConfig(FileStorageConfig{Path: filepath})
+}
+
+// NewFileStorageWithConfig создает файловое хранилище с настройками cfg.
+// Состояние восстанавливается из самого нового целого снимка и журнала. Снимок любого
+// поддерживаемого формата читается автоматически; если он записан не в формате cfg,
+// состояние сразу сохраняется в новый снимок нужного формата.
+func NewFileStorageWithConfig(cfg FileStorageConfig) (*FileStorage, error) {
+	if cfg.Generations <= 0 {
+		cfg.Generations = DefaultSnapshotGenerations
+	}
+	if cfg.Format == "" {
+		cfg.Format = SnapshotFormatJSON
+	}
+	if cfg.Compression == "" {
+		cfg.Compression = SnapshotCompressionNone
+	}
+
+	encoding := snapshotEncoding{Format: cfg.Format, Compression: cfg.Compression}
+	if err := encoding.validate(); err != nil {
+		return nil, err
+	}
+
+	f := &FileStorage{
+		path:        cfg.Path,
+		generations: cfg.Generations,
+		encoding:    encoding,
+		mu:          &sync.Mutex{},
+		compactSize: defaultCompactSize,
+		applied:     core.NewAppliedBatches(core.DefaultAppliedBatchesWindow, core.DefaultAppliedBatchesTTL),
+	}
+
+	snap, snapEncoding, found, err := readSnapshot(cfg.Path, cfg.Generations)
 	if err != nil {
 		return nil, err
 	}
+	f.state = &snap.metrics
+	f.seq = snap.WALSeq
 
-	encoder := json.NewEncoder(file)
-	encoder.SetIndent("", "\t")
+	f.wal, err = openWAL(cfg.Path+walSuffix, func(payload []byte) error {
+		var rec walRecord
+		if err := json.Unmarshal(payload, &rec); err != nil {
+			return err
+		}
+		// Запись уже в снимке: сбой произошел после записи снимка, но до очистки журнала
+		if rec.Seq <= snap.WALSeq {
+			return nil
+		}
+
+		f.apply(rec)
+		f.seq = rec.Seq
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
 
-	return &FileStorage{
-		file:    file,
-		mu:      &sync.Mutex{},
-		encoder: encoder,
-	}, nil
+	if found && snapEncoding != encoding {
+		if err := f.compact(); err != nil {
+			f.wal.close()
+			return nil, err
+		}
+	}
+
+	return f, nil
 }
 
 func (f *FileStorage) SetBatch(_ context.Context, batch core.BaseMetricStorage) error {
 	f.lock()
 	defer f.unlock()
 
-	metrics := &metrics{
-		Counters: make(map[string]int64),
-		Gauges:   make(map[string]float64),
-	}
-
-	if err := f.read(metrics); err != nil {
-		return err
-	}
+	return f.setBatch(batch)
+}
 
-	for k, v := range batch.Gauges() {
-		metrics.Gauges[k] = v
-	}
+// SetBatchOnce - запись пачки метрик, если пачка id еще не применялась.
+// Примененные пачки запоминаются в памяти, в окне последних пачек каждого агента.
+func (f *FileStorage) SetBatchOnce(_ context.Context, id core.BatchID, batch core.BaseMetricStorage) error {
+	f.lock()
+	defer f.unlock()
 
-	for k, v := range batch.Counters() {
-		current, ok := metrics.Counters[k]
-		if !ok {
-			current = 0
-		}
-		metrics.Counters[k] = current + v
+	if f.applied.Seen(id) {
+		return core.ErrDuplicateBatch
 	}
 
-	if err := utils2.RetryVoid(func() error {
-		return f.write(metrics)
-	}, nil); err != nil {
+	if err := f.setBatch(batch); err != nil {
 		return err
 	}
+	f.applied.Add(id)
 
 	return nil
 }
 
-func (f *FileStorage) Set(ctx context.Context, key string, value string, metric core.MetricType) error {
+func (f *FileStorage) setBatch(batch core.BaseMetricStorage) error {
+	return f.write(walRecord{
+		Op:         walOpAdd,
+		Gauges:     batch.Gauges(),
+		Counters:   batch.Counters(),
+		Histograms: batch.Histograms(),
+	})
+}
+
+// SetValues записывает значения метрик одной записью журнала, значения заменяют текущие.
+func (f *FileStorage) SetValues(_ context.Context, values core.BaseMetricStorage) error {
 	f.lock()
 	defer f.unlock()
 
-	metrics := &metrics{
-		Counters: make(map[string]int64),
-		Gauges:   make(map[string]float64),
-	}
+	return f.write(walRecord{
+		Op:         walOpSet,
+		Gauges:     values.Gauges(),
+		Counters:   values.Counters(),
+		Histograms: values.Histograms(),
+	})
+}
 
-	if err := f.read(metrics); err != nil {
-		return err
-	}
+func (f *FileStorage) Set(ctx context.Context, key string, value string, metric core.MetricType) error {
+	f.lock()
+	defer f.unlock()
+
+	rec := walRecord{Op: walOpSet}
 
 	switch metric {
 	case core.Gauge:
@@ -111,48 +226,49 @@ func (f *FileStorage) Set(ctx context.Context, key string, value string, metric
 		if err != nil {
 			return core.ErrBadMetricValue
 		}
-		metrics.Gauges[key] = val
+		rec.Gauges = map[string]float64{key: val}
 	case core.Counter:
 		val, err := utils.CounterFromString(value)
 		if err != nil {
 			return core.ErrBadMetricValue
 		}
-		metrics.Counters[key] = val
+		rec.Counters = map[string]int64{key: val}
+	case core.Histogram:
+		val, err := core.ParseHistogram(value)
+		if err != nil {
+			return core.ErrBadMetricValue
+		}
+		rec.Histograms = map[string]core.HistogramValue{key: val}
 	default:
 		return core.ErrUnknownMetricType
 	}
 
-	if err := utils2.RetryVoid(func() error {
-		return f.write(metrics)
-	}, nil); err != nil {
-		return err
-	}
-
-	return nil
+	return f.write(rec)
 }
 
 func (f *FileStorage) Get(ctx context.Context, key string, metric core.MetricType) (string, error) {
 	f.lock()
 	defer f.unlock()
 
-	var lMetrics metrics
-	if err := f.read(&lMetrics); err != nil {
-		return "", err
-	}
-
 	switch metric {
 	case core.Gauge:
-		if v, ok := lMetrics.Gauges[key]; ok {
+		if v, ok := f.state.Gauges[key]; ok {
 			return utils.GaugeAsString(v), nil
 		} else {
 			return "", core.ErrNotFound
 		}
 	case core.Counter:
-		if v, ok := lMetrics.Counters[key]; ok {
+		if v, ok := f.state.Counters[key]; ok {
 			return utils.CounterAsString(v), nil
 		} else {
 			return "", core.ErrNotFound
 		}
+	case core.Histogram:
+		if v, ok := f.state.Histograms[key]; ok {
+			return v.String(), nil
+		} else {
+			return "", core.ErrNotFound
+		}
 	default:
 		return "", core.ErrUnknownMetricType
 	}
@@ -162,59 +278,103 @@ func (f *FileStorage) GetAll(context.Context) (core.BaseMetricStorage, error) {
 	f.lock()
 	defer f.unlock()
 
-	var lMetrics metrics
-	if err := f.read(&lMetrics); err != nil {
-		return core.NewBaseMetricStorage(), err
-	}
-
-	return *lMetrics.ToBaseStorage(), nil
+	return *f.state.ToBaseStorage(), nil
 }
 
-func (f *FileStorage) write(metrics *metrics) error {
-	if err := f.clear(); err != nil {
+// write дописывает запись в журнал и применяет ее к состоянию в памяти.
+func (f *FileStorage) write(rec walRecord) error {
+	rec.Seq = f.seq + 1
+
+	payload, err := json.Marshal(rec)
+	if err != nil {
 		return err
 	}
 
-	if err := f.encoder.Encode(metrics); err != nil {
+	if err := f.wal.append(payload); err != nil {
 		return err
 	}
+	f.seq = rec.Seq
+	f.apply(rec)
+
+	if f.wal.size >= f.compactSize {
+		// Запись уже надежно в журнале. Если снимок не удалось сохранить,
+		// журнал остается как есть и сворачивается при следующей записи.
+		_ = f.compact()
+	}
 
 	return nil
 }
 
-func (f *FileStorage) read(content *metrics) error {
-	if _, err := f.file.Seek(0, 0); err != nil {
-		return err
+func (f *FileStorage) apply(rec walRecord) {
+	for k, v := range rec.Gauges {
+		f.state.Gauges[k] = v
 	}
 
-	if err := json.NewDecoder(f.file).Decode(content); err != nil {
-		if errors.Is(err, io.EOF) {
-			*content = metrics{
-				Gauges:   make(map[string]float64),
-				Counters: make(map[string]int64),
-			}
-		} else {
-			return err
+	for k, v := range rec.Counters {
+		if rec.Op == walOpAdd {
+			v += f.state.Counters[k]
 		}
+		f.state.Counters[k] = v
 	}
 
-	return nil
+	for k, v := range rec.Histograms {
+		current, ok := f.state.Histograms[k]
+		if rec.Op == walOpSet || !ok || current.Add(v) != nil {
+			current = v.Clone()
+		}
+		f.state.Histograms[k] = current
+	}
 }
 
-func (f *FileStorage) clear() error {
-	if err := f.file.Truncate(0); err != nil {
+// compact сохраняет состояние в новое поколение снимка и очищает журнал.
+func (f *FileStorage) compact() error {
+	data, err := encodeSnapshot(f.state, f.seq, time.Now(), f.encoding)
+	if err != nil {
 		return err
 	}
 
-	if _, err := f.file.Seek(0, 0); err != nil {
+	if err := writeSnapshot(f.path, f.generations, data); err != nil {
 		return err
 	}
 
-	return nil
+	return f.wal.reset()
+}
+
+// SaveSnapshot заменяет состояние хранилища значениями values и сохраняет его в новое поколение снимка,
+// минуя журнал. Так сохраняется состояние при периодической записи: размер записи журнала ограничен,
+// а снимок записывается один раз. Хранилище становится владельцем карт values.
+func (f *FileStorage) SaveSnapshot(_ context.Context, values core.BaseMetricStorage) error {
+	f.lock()
+	defer f.unlock()
+
+	f.state = &metrics{
+		Gauges:     values.Gauges(),
+		Counters:   values.Counters(),
+		Histograms: values.Histograms(),
+	}
+
+	return f.compact()
+}
+
+// Snapshot сохраняет текущее состояние в новое поколение снимка.
+func (f *FileStorage) Snapshot(context.Context) error {
+	f.lock()
+	defer f.unlock()
+
+	return f.compact()
 }
 
+// Close сворачивает журнал в снимок и закрывает хранилище.
 func (f *FileStorage) Close() error {
-	return f.file.Close()
+	f.lock()
+	defer f.unlock()
+
+	var err error
+	if f.wal.size > 0 {
+		err = f.compact()
+	}
+
+	return errors.Join(err, f.wal.close())
 }
 
 func (f *FileStorage) lock() {
@@ -0,0 +1,155 @@
+package storage
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/smartfor/metrics/internal/core"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testBatch(gauge float64, counter int64) core.BaseMetricStorage {
+	batch := core.NewBaseMetricStorage()
+	batch.SetGauge("load", gauge)
+	batch.SetCounter("requests", counter)
+
+	return batch
+}
+
+func assertMetrics(t *testing.T, f *FileStorage, load string, requests string) {
+	ctx := context.Background()
+
+	v, err := f.Get(ctx, "load", core.Gauge)
+	require.NoError(t, err)
+	assert.Equal(t, load, v)
+
+	v, err = f.Get(ctx, "requests", core.Counter)
+	require.NoError(t, err)
+	assert.Equal(t, requests, v)
+}
+
+func TestFileStorage(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("State is replayed from WAL after crash", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "metrics.json")
+
+		f, err := NewFileStorage(path)
+		require.NoError(t, err)
+		require.NoError(t, f.SetBatch(ctx, testBatch(1, 2)))
+		require.NoError(t, f.SetBatch(ctx, testBatch(3, 4)))
+		require.NoError(t, f.Set(ctx, "load", "5", core.Gauge))
+		// Без Close: снимок не записан, состояние только в журнале
+
+		f, err = NewFileStorage(path)
+		require.NoError(t, err)
+		defer f.Close()
+
+		assertMetrics(t, f, "5", "6")
+	})
+
+	t.Run("Torn final record is dropped", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "metrics.json")
+
+		f, err := NewFileStorage(path)
+		require.NoError(t, err)
+		require.NoError(t, f.SetBatch(ctx, testBatch(1, 2)))
+		require.NoError(t, f.SetBatch(ctx, testBatch(3, 4)))
+
+		require.NoError(t, os.Truncate(path+walSuffix, f.wal.size-3))
+
+		f, err = NewFileStorage(path)
+		require.NoError(t, err)
+		defer f.Close()
+		assertMetrics(t, f, "1", "2")
+
+		// Новые записи дописываются после целой части журнала
+		require.NoError(t, f.SetBatch(ctx, testBatch(7, 1)))
+		f, err = NewFileStorage(path)
+		require.NoError(t, err)
+		assertMetrics(t, f, "7", "3")
+	})
+
+	t.Run("Compaction writes snapshot and clears WAL", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "metrics.json")
+
+		f, err := NewFileStorage(path)
+		require.NoError(t, err)
+		f.compactSize = 200
+
+		for i := 0; i < 10; i++ {
+			require.NoError(t, f.SetBatch(ctx, testBatch(float64(i), 1)))
+		}
+		assert.Less(t, f.wal.size, int64(200))
+
+		info, err := os.Stat(path)
+		require.NoError(t, err)
+		assert.NotZero(t, info.Size())
+
+		require.NoError(t, f.Close())
+		info, err = os.Stat(path + walSuffix)
+		require.NoError(t, err)
+		assert.Zero(t, info.Size(), "Close compacts WAL")
+
+		f, err = NewFileStorage(path)
+		require.NoError(t, err)
+		defer f.Close()
+		assertMetrics(t, f, "9", "10")
+	})
+
+	t.Run("WAL records already in snapshot are skipped", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "metrics.json")
+
+		f, err := NewFileStorage(path)
+		require.NoError(t, err)
+		require.NoError(t, f.SetBatch(ctx, testBatch(1, 2)))
+
+		// Сбой между записью снимка и очисткой журнала
+		wal, err := os.ReadFile(path + walSuffix)
+		require.NoError(t, err)
+		require.NoError(t, f.Close())
+		require.NoError(t, os.WriteFile(path+walSuffix, wal, 0o600))
+
+		f, err = NewFileStorage(path)
+		require.NoError(t, err)
+		defer f.Close()
+		assertMetrics(t, f, "1", "2")
+	})
+
+	t.Run("Snapshot without WAL from previous versions is read", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "metrics.json")
+		require.NoError(t, os.WriteFile(path, []byte(`{"gauges": {"load": 1.5}, "counters": {"requests": 3}}`), 0o600))
+
+		f, err := NewFileStorage(path)
+		require.NoError(t, err)
+		defer f.Close()
+		assertMetrics(t, f, "1.5", "3")
+
+		require.NoError(t, f.SetValues(ctx, testBatch(2, 10)))
+		assertMetrics(t, f, "2", "10")
+	})
+
+	t.Run("SaveSnapshot writes state without WAL", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "metrics.json")
+
+		f, err := NewFileStorage(path)
+		require.NoError(t, err)
+		require.NoError(t, f.SetBatch(ctx, testBatch(1, 2)))
+
+		require.NoError(t, f.SaveSnapshot(ctx, testBatch(3, 7)))
+		assert.Zero(t, f.wal.size)
+		assertMetrics(t, f, "3", "7")
+
+		_, err = os.Stat(generationPath(path, 1))
+		assert.ErrorIs(t, err, os.ErrNotExist, "one snapshot per save")
+
+		require.NoError(t, f.Close())
+		f, err = NewFileStorage(path)
+		require.NoError(t, err)
+		defer f.Close()
+		assertMetrics(t, f, "3", "7")
+	})
+}
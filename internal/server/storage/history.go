@@ -0,0 +1,87 @@
+package storage
+
+import (
+	"time"
+
+	"github.com/smartfor/metrics/internal/core"
+)
+
+// DefaultHistorySize - количество значений, которое MemStorage хранит для каждой серии по умолчанию.
+const DefaultHistorySize = 1024
+
+// sampleRing - кольцевой буфер ограниченного размера с последними значениями одной серии.
+// Буфер растет по мере записи и не больше size, поэтому редкие серии не занимают память на полный размер.
+// При переполнении самые старые значения перезаписываются.
+type sampleRing struct {
+	buf  []core.Sample
+	size int
+	next int
+}
+
+func newSampleRing(size int) *sampleRing {
+	return &sampleRing{size: size}
+}
+
+func (r *sampleRing) push(s core.Sample) {
+	if len(r.buf) < r.size {
+		if len(r.buf) == cap(r.buf) {
+			grown := make([]core.Sample, len(r.buf), min(max(2*cap(r.buf), 4), r.size))
+			copy(grown, r.buf)
+			r.buf = grown
+		}
+		r.buf = append(r.buf, s)
+		return
+	}
+
+	r.buf[r.next] = s
+	r.next = (r.next + 1) % r.size
+}
+
+// samples возвращает значения в порядке записи, от старых к новым.
+func (r *sampleRing) samples() []core.Sample {
+	out := make([]core.Sample, 0, len(r.buf))
+	out = append(out, r.buf[r.next:]...)
+	out = append(out, r.buf[:r.next]...)
+	return out
+}
+
+// history - история значений всех серий, ключом служит тип метрики и идентификатор серии.
+type history struct {
+	series map[string]*sampleRing
+	size   int
+}
+
+func newHistory(size int) *history {
+	return &history{
+		series: make(map[string]*sampleRing),
+		size:   size,
+	}
+}
+
+func (h *history) record(metric core.MetricType, key string, value float64, ts time.Time) {
+	if h.size <= 0 {
+		return
+	}
+
+	id := historyKey(metric, key)
+	ring, ok := h.series[id]
+	if !ok {
+		ring = newSampleRing(h.size)
+		h.series[id] = ring
+	}
+
+	ring.push(core.Sample{Timestamp: ts, Value: value})
+}
+
+func (h *history) get(metric core.MetricType, key string) ([]core.Sample, bool) {
+	ring, ok := h.series[historyKey(metric, key)]
+	if !ok {
+		return nil, false
+	}
+
+	return ring.samples(), true
+}
+
+func historyKey(metric core.MetricType, key string) string {
+	return string(metric) + ":" + key
+}
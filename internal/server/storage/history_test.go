@@ -0,0 +1,30 @@
+package storage
+
+import (
+	"testing"
+	"time"
+
+	"github.com/smartfor/metrics/internal/core"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSampleRing(t *testing.T) {
+	values := func(samples []core.Sample) []float64 {
+		var out []float64
+		for _, s := range samples {
+			out = append(out, s.Value)
+		}
+		return out
+	}
+
+	r := newSampleRing(5)
+	r.push(core.Sample{Timestamp: time.Unix(1, 0), Value: 1})
+	assert.Equal(t, []float64{1}, values(r.samples()))
+	assert.Less(t, cap(r.buf), 5, "buffer grows on demand")
+
+	for i := 2; i <= 7; i++ {
+		r.push(core.Sample{Timestamp: time.Unix(int64(i), 0), Value: float64(i)})
+	}
+	assert.Equal(t, []float64{3, 4, 5, 6, 7}, values(r.samples()))
+	assert.Equal(t, 5, cap(r.buf), "buffer never exceeds size")
+}
@@ -2,7 +2,10 @@ package storage
 
 import (
 	"context"
+	"path/filepath"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/smartfor/metrics/internal/core"
 	"github.com/stretchr/testify/assert"
@@ -60,7 +63,7 @@ func TestMemStorage_Get(t *testing.T) {
 			if err != nil {
 				t.Fatal(err)
 			}
-			s, err := NewMemStorage(fs, false, false)
+			s, err := NewMemStorage(fs, false, false, DefaultHistorySize)
 			if err != nil {
 				t.Fatal(err)
 			}
@@ -136,7 +139,7 @@ func TestMemStorage_Set(t *testing.T) {
 			if err != nil {
 				t.Fatal(err)
 			}
-			s, err := NewMemStorage(fs, false, false)
+			s, err := NewMemStorage(fs, false, false, DefaultHistorySize)
 			if err != nil {
 				t.Fatal(err)
 			}
@@ -158,7 +161,7 @@ func TestMemStorage_Set(t *testing.T) {
 		if err != nil {
 			t.Fatal(err)
 		}
-		s, err := NewMemStorage(fs, false, false)
+		s, err := NewMemStorage(fs, false, false, DefaultHistorySize)
 		if err != nil {
 			t.Fatal(err)
 		}
@@ -172,4 +175,170 @@ func TestMemStorage_Set(t *testing.T) {
 		actual, _ := s.Get(context.Background(), k, core.Counter)
 		assert.Equal(t, "15", actual)
 	})
+	t.Run("Histogram - observations accumulated", func(t *testing.T) {
+		fs, err := NewFileStorage("/tmp/metric.json")
+		if err != nil {
+			t.Fatal(err)
+		}
+		s, err := NewMemStorage(fs, false, false, DefaultHistorySize)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		k := "someHistogram"
+		first, _ := core.NewHistogramValue([]float64{1, 10})
+		first.Observe(0.5)
+		second, _ := core.NewHistogramValue([]float64{1, 10})
+		second.Observe(5)
+		second.Observe(50)
+
+		require.NoError(t, s.Set(context.Background(), k, first.String(), core.Histogram))
+		require.NoError(t, s.Set(context.Background(), k, second.String(), core.Histogram))
+
+		actual, err := s.Get(context.Background(), k, core.Histogram)
+		require.NoError(t, err)
+
+		h, err := core.ParseHistogram(actual)
+		require.NoError(t, err)
+		assert.Equal(t, []uint64{1, 1, 1}, h.Counts)
+		assert.Equal(t, uint64(3), h.Count)
+		assert.Equal(t, 55.5, h.Sum)
+	})
+}
+
+func TestMemStorage_QueryRange(t *testing.T) {
+	fs, err := NewFileStorage("/tmp/metric.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err := NewMemStorage(fs, false, false, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	from := time.Now().Add(-time.Minute)
+	for _, v := range []string{"1", "2", "3", "4", "5"} {
+		require.NoError(t, s.Set(context.Background(), "c", v, core.Counter))
+	}
+
+	t.Run("Counter - keeps only last samples", func(t *testing.T) {
+		samples, err := s.QueryRange(context.Background(), "c", core.Counter, from, time.Now(), 0, 0)
+		require.NoError(t, err)
+
+		values := make([]float64, 0, len(samples))
+		for _, sample := range samples {
+			values = append(values, sample.Value)
+		}
+		assert.Equal(t, []float64{6, 10, 15}, values)
+	})
+
+	t.Run("Counter - downsampled to one point per step", func(t *testing.T) {
+		samples, err := s.QueryRange(context.Background(), "c", core.Counter, from, time.Now(), time.Hour, 0)
+		require.NoError(t, err)
+		require.Len(t, samples, 1)
+		assert.Equal(t, 15.0, samples[0].Value)
+	})
+
+	t.Run("Counter - limit applies only without step", func(t *testing.T) {
+		samples, err := s.QueryRange(context.Background(), "c", core.Counter, from, time.Now(), time.Hour, 2)
+		require.NoError(t, err)
+		assert.Len(t, samples, 1)
+	})
+
+	t.Run("Negative - too many samples without step", func(t *testing.T) {
+		_, err := s.QueryRange(context.Background(), "c", core.Counter, from, time.Now(), 0, 2)
+		require.ErrorIs(t, err, core.ErrTooManySamples)
+	})
+
+	t.Run("Negative - not found", func(t *testing.T) {
+		_, err := s.QueryRange(context.Background(), "c", core.Gauge, from, time.Now(), 0, 0)
+		require.ErrorIs(t, err, core.ErrNotFound)
+	})
+}
+
+func TestMemStorage_SetBatchOnce(t *testing.T) {
+	ctx := context.Background()
+
+	fs, err := NewFileStorage("/tmp/metric.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err := NewMemStorage(fs, false, false, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	batch := core.NewBaseMetricStorage()
+	batch.SetCounter("PollCount", 5)
+
+	first := core.BatchID{AgentID: "agent", Key: "a", Seq: 1}
+	require.NoError(t, s.SetBatchOnce(ctx, first, batch))
+
+	t.Run("Duplicate - counter is not incremented twice", func(t *testing.T) {
+		require.ErrorIs(t, s.SetBatchOnce(ctx, first, batch), core.ErrDuplicateBatch)
+
+		v, err := s.Get(ctx, "PollCount", core.Counter)
+		require.NoError(t, err)
+		assert.Equal(t, "5", v)
+	})
+
+	t.Run("Same key of another agent is applied", func(t *testing.T) {
+		require.NoError(t, s.SetBatchOnce(ctx, core.BatchID{AgentID: "other", Key: "a", Seq: 1}, batch))
+
+		v, err := s.Get(ctx, "PollCount", core.Counter)
+		require.NoError(t, err)
+		assert.Equal(t, "10", v)
+	})
+
+	t.Run("Batch without id is always applied", func(t *testing.T) {
+		require.NoError(t, core.SetBatchOnce(ctx, s, core.BatchID{}, batch))
+		require.NoError(t, core.SetBatchOnce(ctx, s, core.BatchID{}, batch))
+
+		v, err := s.Get(ctx, "PollCount", core.Counter)
+		require.NoError(t, err)
+		assert.Equal(t, "20", v)
+	})
+}
+
+func TestMemStorage_Backup(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("Restore does not write values back", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "metrics.json")
+		fs, err := NewFileStorage(path)
+		require.NoError(t, err)
+		require.NoError(t, fs.SaveSnapshot(ctx, testBatch(1.5, 3)))
+
+		s, err := NewMemStorage(fs, true, true, 0)
+		require.NoError(t, err)
+		assert.Zero(t, fs.wal.size)
+
+		v, err := s.Get(ctx, "requests", core.Counter)
+		require.NoError(t, err)
+		assert.Equal(t, "3", v)
+	})
+
+	t.Run("Concurrent batches keep all increments in backup", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "metrics.json")
+		fs, err := NewFileStorage(path)
+		require.NoError(t, err)
+		s, err := NewMemStorage(fs, false, true, 0)
+		require.NoError(t, err)
+
+		var wg sync.WaitGroup
+		for i := 0; i < 50; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				assert.NoError(t, s.SetBatch(ctx, testBatch(1, 1)))
+			}()
+		}
+		wg.Wait()
+		require.NoError(t, s.Close())
+
+		fs, err = NewFileStorage(path)
+		require.NoError(t, err)
+		defer fs.Close()
+		assertMetrics(t, fs, "1", "50")
+	})
 }
@@ -3,6 +3,7 @@ package storage
 import (
 	"context"
 	"sync"
+	"time"
 
 	"github.com/smartfor/metrics/internal/core"
 	"github.com/smartfor/metrics/internal/server/utils"
@@ -13,22 +14,27 @@ type MemStorage struct {
 	core.BaseMetricStorage
 	mu          *sync.Mutex
 	backup      core.Storage
+	history     *history
+	applied     *core.AppliedBatches
 	synchronize bool
 }
 
 // NewMemStorage - конструктор для создания Memstorage,
 // где backup - это сохраненное ранее состояние метрик которое нужно прогрузить в память если restore == true,
-// а synchronize - флаг определяющий нужно ли сбрасывать данные в backup после каждого изменения метрик.
-func NewMemStorage(backup core.Storage, restore bool, synchronize bool) (*MemStorage, error) {
+// synchronize - флаг определяющий нужно ли сбрасывать данные в backup после каждого изменения метрик,
+// а historySize - количество последних значений каждой серии, которые хранятся для запросов истории (0 - не хранить).
+func NewMemStorage(backup core.Storage, restore bool, synchronize bool, historySize int) (*MemStorage, error) {
 	s := &MemStorage{
 		BaseMetricStorage: core.NewBaseMetricStorage(),
 		backup:            backup,
+		history:           newHistory(historySize),
+		applied:           core.NewAppliedBatches(core.DefaultAppliedBatchesWindow, core.DefaultAppliedBatchesTTL),
 		synchronize:       synchronize,
 		mu:                &sync.Mutex{},
 	}
 
 	if restore {
-		if err := core.Sync(context.Background(), backup, s); err != nil {
+		if err := s.restore(context.Background()); err != nil {
 			return nil, err
 		}
 	}
@@ -36,22 +42,99 @@ func NewMemStorage(backup core.Storage, restore bool, synchronize bool) (*MemSto
 	return s, nil
 }
 
+// restore загружает состояние из backup. Значения уже сохранены в backup, поэтому обратно не записываются.
+func (s *MemStorage) restore(ctx context.Context) error {
+	values, err := s.backup.GetAll(ctx)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	for k, v := range values.Gauges() {
+		s.history.record(core.Gauge, k, v, now)
+	}
+	for k, v := range values.Counters() {
+		s.history.record(core.Counter, k, float64(v), now)
+	}
+	s.BaseMetricStorage = values
+
+	return nil
+}
+
+// SetBatch - запись пачки метрик. Блокировка удерживается до записи в backup,
+// чтобы значения конкурентных пачек попадали в backup в том же порядке, что и в память.
 func (s *MemStorage) SetBatch(ctx context.Context, batch core.BaseMetricStorage) error {
 	s.lock()
+	defer s.unlock()
+
+	s.setBatch(batch)
+
+	return s.sync(ctx, s.current(batch))
+}
+
+// SetBatchOnce - запись пачки метрик, если пачка id еще не применялась.
+// Примененные пачки запоминаются в памяти, в окне последних пачек каждого агента.
+func (s *MemStorage) SetBatchOnce(ctx context.Context, id core.BatchID, batch core.BaseMetricStorage) error {
+	s.lock()
+	defer s.unlock()
+
+	if s.applied.Seen(id) {
+		return core.ErrDuplicateBatch
+	}
+	s.setBatch(batch)
+	s.applied.Add(id)
+
+	return s.sync(ctx, s.current(batch))
+}
+
+func (s *MemStorage) setBatch(batch core.BaseMetricStorage) {
+	now := time.Now()
+
 	for k, v := range batch.Gauges() {
 		s.SetGauge(k, v)
+		s.history.record(core.Gauge, k, v, now)
 	}
 
 	for k, v := range batch.Counters() {
 		s.SetCounter(k, v)
+		total, _ := s.GetCounter(k)
+		s.history.record(core.Counter, k, float64(total), now)
+	}
+
+	for k, v := range batch.Histograms() {
+		s.SetHistogram(k, v)
+	}
+}
+
+// current возвращает текущие значения метрик, измененных пачкой batch.
+func (s *MemStorage) current(batch core.BaseMetricStorage) core.BaseMetricStorage {
+	values := core.NewBaseMetricStorage()
+	if !s.synchronize {
+		return values
+	}
+
+	for k := range batch.Gauges() {
+		v, _ := s.GetGauge(k)
+		values.SetGauge(k, v)
+	}
+
+	for k := range batch.Counters() {
+		v, _ := s.GetCounter(k)
+		values.SetCounter(k, v)
 	}
-	s.unlock()
 
+	for k := range batch.Histograms() {
+		v, _ := s.GetHistogram(k)
+		values.SetHistogram(k, v)
+	}
+
+	return values
+}
+
+// sync записывает в backup значения, измененные пачкой, если включена синхронная запись.
+func (s *MemStorage) sync(ctx context.Context, values core.BaseMetricStorage) error {
 	if s.synchronize {
-		err := core.Sync(ctx, s, s.backup)
-		if err != nil {
-			return err
-		}
+		return core.SetValues(ctx, s.backup, values)
 	}
 
 	return nil
@@ -70,6 +153,7 @@ func (s *MemStorage) Set(ctx context.Context, key string, value string, metric c
 			}
 
 			s.SetGauge(key, val)
+			s.history.record(core.Gauge, key, val, time.Now())
 		}
 
 	case core.Counter:
@@ -80,6 +164,18 @@ func (s *MemStorage) Set(ctx context.Context, key string, value string, metric c
 			}
 
 			s.SetCounter(key, val)
+			total, _ := s.GetCounter(key)
+			s.history.record(core.Counter, key, float64(total), time.Now())
+		}
+
+	case core.Histogram:
+		{
+			val, err := core.ParseHistogram(value)
+			if err != nil {
+				return core.ErrBadMetricValue
+			}
+
+			s.SetHistogram(key, val)
 		}
 
 	case core.Unknown:
@@ -94,6 +190,10 @@ func (s *MemStorage) Set(ctx context.Context, key string, value string, metric c
 			v, _ := s.GetCounter(key)
 			value = utils.CounterAsString(v)
 		}
+		if metric == core.Histogram {
+			v, _ := s.GetHistogram(key)
+			value = v.String()
+		}
 		if err := s.backup.Set(ctx, key, value, metric); err != nil {
 			return err
 		}
@@ -124,6 +224,14 @@ func (s *MemStorage) Get(ctx context.Context, key string, metric core.MetricType
 			}
 			return utils.CounterAsString(v), nil
 		}
+	case core.Histogram:
+		{
+			v, ok := s.GetHistogram(key)
+			if !ok {
+				return "", core.ErrNotFound
+			}
+			return v.String(), nil
+		}
 	default:
 		{
 			return "", core.ErrUnknownMetricType
@@ -131,6 +239,36 @@ func (s *MemStorage) Get(ctx context.Context, key string, metric core.MetricType
 	}
 }
 
+// QueryRange возвращает историю значений серии из кольцевого буфера.
+// Хранятся только последние historySize значений каждой серии, история гистограмм не ведется.
+func (s *MemStorage) QueryRange(
+	_ context.Context,
+	key string,
+	metric core.MetricType,
+	from, to time.Time,
+	step time.Duration,
+	limit int,
+) ([]core.Sample, error) {
+	if metric != core.Gauge && metric != core.Counter {
+		return nil, core.ErrUnknownMetricType
+	}
+
+	s.lock()
+	defer s.unlock()
+
+	samples, ok := s.history.get(metric, key)
+	if !ok {
+		return nil, core.ErrNotFound
+	}
+
+	out := core.Downsample(samples, from, to, step)
+	if step <= 0 && limit > 0 && len(out) > limit {
+		return nil, core.ErrTooManySamples
+	}
+
+	return out, nil
+}
+
 func (s *MemStorage) GetAll(context.Context) (core.BaseMetricStorage, error) {
 	s.lock()
 	defer s.unlock()
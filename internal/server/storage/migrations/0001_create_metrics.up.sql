@@ -0,0 +1,9 @@
+CREATE TABLE IF NOT EXISTS gauges (
+	key VARCHAR(255) PRIMARY KEY,
+	value DOUBLE PRECISION
+);
+
+CREATE TABLE IF NOT EXISTS counters (
+	key VARCHAR(255) PRIMARY KEY,
+	value INT8
+);
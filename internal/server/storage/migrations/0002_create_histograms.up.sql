@@ -0,0 +1,7 @@
+CREATE TABLE IF NOT EXISTS histograms (
+	key VARCHAR(255) PRIMARY KEY,
+	bounds DOUBLE PRECISION[],
+	counts INT8[],
+	sum DOUBLE PRECISION,
+	count INT8
+);
@@ -0,0 +1,8 @@
+CREATE TABLE IF NOT EXISTS history (
+	key TEXT NOT NULL,
+	type VARCHAR(16) NOT NULL,
+	ts TIMESTAMPTZ NOT NULL,
+	value DOUBLE PRECISION
+);
+
+CREATE INDEX IF NOT EXISTS history_key_type_ts_idx ON history (key, type, ts);
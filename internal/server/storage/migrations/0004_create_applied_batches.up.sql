@@ -0,0 +1,9 @@
+CREATE TABLE IF NOT EXISTS applied_batches (
+	agent_id TEXT NOT NULL,
+	key TEXT NOT NULL,
+	seq INT8 NOT NULL,
+	applied_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+	PRIMARY KEY (agent_id, key)
+);
+
+CREATE INDEX IF NOT EXISTS applied_batches_agent_applied_at_idx ON applied_batches (agent_id, applied_at);
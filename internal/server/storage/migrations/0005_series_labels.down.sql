@@ -0,0 +1,17 @@
+DROP INDEX IF EXISTS gauges_labels_idx;
+DROP INDEX IF EXISTS gauges_name_idx;
+ALTER TABLE gauges
+	DROP COLUMN IF EXISTS labels,
+	DROP COLUMN IF EXISTS name;
+
+DROP INDEX IF EXISTS counters_labels_idx;
+DROP INDEX IF EXISTS counters_name_idx;
+ALTER TABLE counters
+	DROP COLUMN IF EXISTS labels,
+	DROP COLUMN IF EXISTS name;
+
+DROP INDEX IF EXISTS histograms_labels_idx;
+DROP INDEX IF EXISTS histograms_name_idx;
+ALTER TABLE histograms
+	DROP COLUMN IF EXISTS labels,
+	DROP COLUMN IF EXISTS name;
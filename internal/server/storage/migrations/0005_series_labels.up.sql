@@ -0,0 +1,47 @@
+-- Метки входят в идентичность метрики: key хранит идентификатор серии (core.MetricKey),
+-- а name и labels - его разобранные части для выборок по имени и меткам.
+-- Существующие ключи вида name{a="1",b="2"} разбираются так же, как core.ParseMetricKey:
+-- имя - часть до '{', значения меток снимаются с экранирования \X -> X
+-- (управляющие последовательности вроде \n в значениях меток не ожидаются).
+
+ALTER TABLE gauges
+	ALTER COLUMN key TYPE TEXT,
+	ADD COLUMN IF NOT EXISTS name TEXT NOT NULL DEFAULT '',
+	ADD COLUMN IF NOT EXISTS labels JSONB NOT NULL DEFAULT '{}';
+UPDATE gauges SET
+	name = split_part(key, '{', 1),
+	labels = COALESCE((
+		SELECT jsonb_object_agg(m[1], regexp_replace(m[2], '\\(.)', '\1', 'g'))
+			FROM regexp_matches(substr(key, strpos(key, '{')), '([A-Za-z_][A-Za-z0-9_]*)="((?:[^"\\]|\\.)*)"', 'g') AS m
+	), '{}')
+	WHERE name = '';
+CREATE INDEX IF NOT EXISTS gauges_name_idx ON gauges (name);
+CREATE INDEX IF NOT EXISTS gauges_labels_idx ON gauges USING GIN (labels);
+
+ALTER TABLE counters
+	ALTER COLUMN key TYPE TEXT,
+	ADD COLUMN IF NOT EXISTS name TEXT NOT NULL DEFAULT '',
+	ADD COLUMN IF NOT EXISTS labels JSONB NOT NULL DEFAULT '{}';
+UPDATE counters SET
+	name = split_part(key, '{', 1),
+	labels = COALESCE((
+		SELECT jsonb_object_agg(m[1], regexp_replace(m[2], '\\(.)', '\1', 'g'))
+			FROM regexp_matches(substr(key, strpos(key, '{')), '([A-Za-z_][A-Za-z0-9_]*)="((?:[^"\\]|\\.)*)"', 'g') AS m
+	), '{}')
+	WHERE name = '';
+CREATE INDEX IF NOT EXISTS counters_name_idx ON counters (name);
+CREATE INDEX IF NOT EXISTS counters_labels_idx ON counters USING GIN (labels);
+
+ALTER TABLE histograms
+	ALTER COLUMN key TYPE TEXT,
+	ADD COLUMN IF NOT EXISTS name TEXT NOT NULL DEFAULT '',
+	ADD COLUMN IF NOT EXISTS labels JSONB NOT NULL DEFAULT '{}';
+UPDATE histograms SET
+	name = split_part(key, '{', 1),
+	labels = COALESCE((
+		SELECT jsonb_object_agg(m[1], regexp_replace(m[2], '\\(.)', '\1', 'g'))
+			FROM regexp_matches(substr(key, strpos(key, '{')), '([A-Za-z_][A-Za-z0-9_]*)="((?:[^"\\]|\\.)*)"', 'g') AS m
+	), '{}')
+	WHERE name = '';
+CREATE INDEX IF NOT EXISTS histograms_name_idx ON histograms (name);
+CREATE INDEX IF NOT EXISTS histograms_labels_idx ON histograms USING GIN (labels);
@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS applied_batches_applied_at_idx;
+DROP INDEX IF EXISTS applied_batches_agent_seq_idx;
+CREATE INDEX IF NOT EXISTS applied_batches_agent_applied_at_idx ON applied_batches (agent_id, applied_at);
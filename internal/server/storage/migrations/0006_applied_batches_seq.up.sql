@@ -0,0 +1,4 @@
+-- Отметки пачек удаляются по номеру пачки агента и по времени для всех агентов сразу.
+DROP INDEX IF EXISTS applied_batches_agent_applied_at_idx;
+CREATE INDEX IF NOT EXISTS applied_batches_agent_seq_idx ON applied_batches (agent_id, seq);
+CREATE INDEX IF NOT EXISTS applied_batches_applied_at_idx ON applied_batches (applied_at);
@@ -0,0 +1,2 @@
+-- Исправленные name и labels соответствуют key, откатывать нечего.
+SELECT 1;
@@ -0,0 +1,26 @@
+-- Исправление строк, для которых прежняя версия 0005_series_labels записала в name весь ключ
+-- вместе с метками. Ключ разбирается так же, как в 0005_series_labels.
+
+UPDATE gauges SET
+	name = split_part(key, '{', 1),
+	labels = COALESCE((
+		SELECT jsonb_object_agg(m[1], regexp_replace(m[2], '\\(.)', '\1', 'g'))
+			FROM regexp_matches(substr(key, strpos(key, '{')), '([A-Za-z_][A-Za-z0-9_]*)="((?:[^"\\]|\\.)*)"', 'g') AS m
+	), '{}')
+	WHERE name = key AND key LIKE '%{%';
+
+UPDATE counters SET
+	name = split_part(key, '{', 1),
+	labels = COALESCE((
+		SELECT jsonb_object_agg(m[1], regexp_replace(m[2], '\\(.)', '\1', 'g'))
+			FROM regexp_matches(substr(key, strpos(key, '{')), '([A-Za-z_][A-Za-z0-9_]*)="((?:[^"\\]|\\.)*)"', 'g') AS m
+	), '{}')
+	WHERE name = key AND key LIKE '%{%';
+
+UPDATE histograms SET
+	name = split_part(key, '{', 1),
+	labels = COALESCE((
+		SELECT jsonb_object_agg(m[1], regexp_replace(m[2], '\\(.)', '\1', 'g'))
+			FROM regexp_matches(substr(key, strpos(key, '{')), '([A-Za-z_][A-Za-z0-9_]*)="((?:[^"\\]|\\.)*)"', 'g') AS m
+	), '{}')
+	WHERE name = key AND key LIKE '%{%';
@@ -0,0 +1,128 @@
+package migrations
+
+import (
+	"context"
+	"os"
+	"testing"
+	"testing/fstest"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoadEmbedded(t *testing.T) {
+	migrations, err := Load(files)
+	require.NoError(t, err)
+	require.NotEmpty(t, migrations)
+
+	for i, m := range migrations {
+		assert.Equal(t, int64(i+1), m.Version, "versions must be contiguous")
+		assert.NotEmpty(t, m.Up)
+		assert.NotEmpty(t, m.Down)
+	}
+}
+
+func TestLoad(t *testing.T) {
+	sql := &fstest.MapFile{Data: []byte("SELECT 1;")}
+
+	tests := []struct {
+		name     string
+		fs       fstest.MapFS
+		versions []int64
+		err      error
+	}{
+		{
+			name: "sorted by version",
+			fs: fstest.MapFS{
+				"0010_ten.up.sql":   sql,
+				"0010_ten.down.sql": sql,
+				"0002_two.up.sql":   sql,
+				"0002_two.down.sql": sql,
+			},
+			versions: []int64{2, 10},
+		},
+		{
+			name: "bad name",
+			fs:   fstest.MapFS{"init.sql": sql},
+			err:  ErrBadMigrationName,
+		},
+		{
+			name: "zero version",
+			fs:   fstest.MapFS{"0000_zero.up.sql": sql, "0000_zero.down.sql": sql},
+			err:  ErrBadMigrationName,
+		},
+		{
+			name: "missing down",
+			fs:   fstest.MapFS{"0001_init.up.sql": sql},
+			err:  ErrIncompleteMigration,
+		},
+		{
+			name: "same version different names",
+			fs: fstest.MapFS{
+				"0001_a.up.sql":   sql,
+				"0001_a.down.sql": sql,
+				"0001_b.up.sql":   sql,
+			},
+			err: ErrDuplicateMigration,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			migrations, err := Load(tt.fs)
+			if tt.err != nil {
+				assert.ErrorIs(t, err, tt.err)
+				return
+			}
+			require.NoError(t, err)
+
+			var versions []int64
+			for _, m := range migrations {
+				versions = append(versions, m.Version)
+			}
+			assert.Equal(t, tt.versions, versions)
+		})
+	}
+}
+
+// TestMigratorUpDown требует пустую базу данных в TEST_DATABASE_DSN
+func TestMigratorUpDown(t *testing.T) {
+	dsn := os.Getenv("TEST_DATABASE_DSN")
+	if dsn == "" {
+		t.Skip("TEST_DATABASE_DSN is not set")
+	}
+
+	ctx := context.Background()
+	pool, err := pgxpool.New(ctx, dsn)
+	require.NoError(t, err)
+	defer pool.Close()
+
+	migrator, err := NewMigrator(pool)
+	require.NoError(t, err)
+	total := len(migrator.migrations)
+
+	done, err := migrator.Up(ctx, 0)
+	require.NoError(t, err)
+	assert.Len(t, done, total)
+
+	done, err = migrator.Up(ctx, 0)
+	require.NoError(t, err)
+	assert.Empty(t, done, "second run must be a no-op")
+
+	done, err = migrator.Down(ctx, 1)
+	require.NoError(t, err)
+	require.Len(t, done, 1)
+	assert.Equal(t, int64(total), done[0].Version)
+
+	statuses, err := migrator.Status(ctx)
+	require.NoError(t, err)
+	assert.False(t, statuses[total-1].Applied)
+	assert.True(t, statuses[0].Applied)
+
+	_, err = migrator.Down(ctx, total)
+	require.NoError(t, err)
+	done, err = migrator.Up(ctx, 0)
+	require.NoError(t, err)
+	assert.Len(t, done, total)
+}
@@ -3,17 +3,20 @@ package storage
 import (
 	"context"
 	"errors"
+	"time"
 
 	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/smartfor/metrics/internal/core"
+	"github.com/smartfor/metrics/internal/server/storage/migrations"
 	"github.com/smartfor/metrics/internal/server/utils"
 )
 
 // PostgresStorage - тип для хранения состояния метрик в БД Postgres
 type PostgresStorage struct {
-	pool *pgxpool.Pool
+	pool      *pgxpool.Pool
+	batchMode batchMode
 }
 
 // NewPostgresStorage - конструктор для создания PostgresStorage,
@@ -35,7 +38,7 @@ func NewPostgresStorage(ctx context.Context, dsn string) (*PostgresStorage, erro
 	return &s, nil
 }
 
-// Initialize Создает таблицы gauges и counters в базе данных
+// Initialize Применяет к базе данных еще не примененные миграции схемы
 func (s *PostgresStorage) Initialize() error {
 	return s.initialize()
 }
@@ -44,6 +47,12 @@ func (s *PostgresStorage) SetBatch(ctx context.Context, batch core.BaseMetricSto
 	return s.setBatch(ctx, batch)
 }
 
+// SetBatchOnce - запись пачки метрик, если пачка id еще не применялась.
+// Примененные пачки хранятся в таблице applied_batches и отмечаются в той же транзакции, что и метрики.
+func (s *PostgresStorage) SetBatchOnce(ctx context.Context, id core.BatchID, batch core.BaseMetricStorage) error {
+	return s.setBatchOnce(ctx, id, batch)
+}
+
 func (s *PostgresStorage) Set(ctx context.Context, key string, value string, metric core.MetricType) error {
 	return s.set(ctx, metric, key, value)
 }
@@ -68,6 +77,15 @@ func (s *PostgresStorage) Get(ctx context.Context, key string, metric core.Metri
 
 			return utils.CounterAsString(d), nil
 		}
+	case core.Histogram:
+		{
+			h, err := s.getHistogram(ctx, key)
+			if err != nil {
+				return "", err
+			}
+
+			return h.String(), nil
+		}
 	default:
 		return "", core.ErrUnknownMetricType
 	}
@@ -77,6 +95,60 @@ func (s *PostgresStorage) GetAll(ctx context.Context) (core.BaseMetricStorage, e
 	return s.getAll(ctx)
 }
 
+// QueryRange возвращает историю значений серии из таблицы history.
+func (s *PostgresStorage) QueryRange(
+	ctx context.Context,
+	key string,
+	metric core.MetricType,
+	from, to time.Time,
+	step time.Duration,
+	limit int,
+) ([]core.Sample, error) {
+	if metric != core.Gauge && metric != core.Counter {
+		return nil, core.ErrUnknownMetricType
+	}
+
+	// без прореживания строки отдаются как есть, поэтому их количество ограничивается в запросе:
+	// лишняя строка сверх limit означает, что интервал слишком велик
+	rowsLimit := -1
+	if step <= 0 && limit > 0 {
+		rowsLimit = limit + 1
+	}
+
+	query, err := s.pool.Query(
+		ctx,
+		`SELECT ts, value FROM history
+			WHERE key = $1 AND type = $2 AND ts BETWEEN $3 AND $4
+			ORDER BY ts
+			LIMIT NULLIF($5::int, -1)`,
+		key, string(metric), from, to, rowsLimit,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	defer query.Close()
+
+	samples := make([]core.Sample, 0)
+	for query.Next() {
+		var sample core.Sample
+		if err := query.Scan(&sample.Timestamp, &sample.Value); err != nil {
+			return nil, err
+		}
+		samples = append(samples, sample)
+	}
+
+	if err := query.Err(); err != nil {
+		return nil, err
+	}
+
+	if rowsLimit > 0 && len(samples) > limit {
+		return nil, core.ErrTooManySamples
+	}
+
+	return core.Downsample(samples, from, to, step), nil
+}
+
 func (s *PostgresStorage) Close() error {
 	s.pool.Close()
 	return nil
@@ -87,24 +159,62 @@ func (s *PostgresStorage) Ping(ctx context.Context) error {
 }
 
 func (s *PostgresStorage) upsertGauge(ctx context.Context, tx pgx.Tx, key string, value float64) (pgconn.CommandTag, error) {
+	name, labels := seriesColumns(key)
 	return tx.Exec(
 		ctx,
-		`INSERT INTO gauges (key, value)
-			VALUES ($1, $2)
-			ON CONFLICT (key)
-			DO UPDATE SET value = EXCLUDED.value`,
-		key, value,
+		`WITH upsert AS (
+			INSERT INTO gauges (key, name, labels, value)
+				VALUES ($1, $2, $3, $4)
+				ON CONFLICT (key)
+				DO UPDATE SET value = EXCLUDED.value
+				RETURNING key, value
+		)
+		INSERT INTO history (key, type, ts, value)
+			SELECT key, 'gauge', now(), value FROM upsert`,
+		key, name, labels, value,
 	)
 }
 
 func (s *PostgresStorage) upsertCounter(ctx context.Context, tx pgx.Tx, key string, delta int64) (pgconn.CommandTag, error) {
+	name, labels := seriesColumns(key)
 	return tx.Exec(
 		ctx,
-		`INSERT INTO counters (key, value)
-		    	VALUES ($1, $2)
+		`WITH upsert AS (
+			INSERT INTO counters (key, name, labels, value)
+				VALUES ($1, $2, $3, $4)
+				ON CONFLICT (key)
+				DO UPDATE SET value = counters.value + EXCLUDED.value
+				RETURNING key, value
+		)
+		INSERT INTO history (key, type, ts, value)
+			SELECT key, 'counter', now(), value FROM upsert`,
+		key, name, labels, delta,
+	)
+}
+
+// upsertHistogram прибавляет наблюдения к гистограмме, если границы корзин совпадают, иначе заменяет ее.
+func (s *PostgresStorage) upsertHistogram(ctx context.Context, tx pgx.Tx, key string, h core.HistogramValue) (pgconn.CommandTag, error) {
+	name, labels := seriesColumns(key)
+	return tx.Exec(
+		ctx,
+		`INSERT INTO histograms (key, name, labels, bounds, counts, sum, count)
+			VALUES ($1, $2, $3, $4, $5, $6, $7)
 			ON CONFLICT (key)
-			DO UPDATE SET value = counters.value + EXCLUDED.value`,
-		key, delta,
+			DO UPDATE SET
+				bounds = EXCLUDED.bounds,
+				counts = CASE WHEN histograms.bounds = EXCLUDED.bounds
+					THEN (
+						SELECT array_agg(o + n ORDER BY i)
+						FROM unnest(histograms.counts, EXCLUDED.counts) WITH ORDINALITY AS t(o, n, i)
+					)
+					ELSE EXCLUDED.counts END,
+				sum = CASE WHEN histograms.bounds = EXCLUDED.bounds
+					THEN histograms.sum + EXCLUDED.sum
+					ELSE EXCLUDED.sum END,
+				count = CASE WHEN histograms.bounds = EXCLUDED.bounds
+					THEN histograms.count + EXCLUDED.count
+					ELSE EXCLUDED.count END`,
+		key, name, labels, h.Bounds, countsToInt64(h.Counts), h.Sum, int64(h.Count),
 	)
 }
 
@@ -138,8 +248,30 @@ func (s *PostgresStorage) getCounter(ctx context.Context, key string) (int64, er
 	return delta, err
 }
 
+func (s *PostgresStorage) getHistogram(ctx context.Context, key string) (core.HistogramValue, error) {
+	var (
+		h      core.HistogramValue
+		counts []int64
+		count  int64
+	)
+	err := s.pool.QueryRow(
+		ctx,
+		`SELECT bounds, counts, sum, count FROM histograms WHERE key = $1 LIMIT 1`,
+		key,
+	).Scan(&h.Bounds, &counts, &h.Sum, &count)
+
+	if err != nil && errors.Is(err, pgx.ErrNoRows) {
+		err = core.ErrNotFound
+	}
+
+	h.Counts = countsFromInt64(counts)
+	h.Count = uint64(count)
+
+	return h, err
+}
+
 func (s *PostgresStorage) getAllGauges(ctx context.Context) (map[string]float64, error) {
-	query, err := s.pool.Query(ctx, `SELECT FROM gauges`)
+	query, err := s.pool.Query(ctx, `SELECT key, value FROM gauges`)
 	if err != nil {
 		return nil, err
 	}
@@ -160,7 +292,7 @@ func (s *PostgresStorage) getAllGauges(ctx context.Context) (map[string]float64,
 }
 
 func (s *PostgresStorage) getAllCounters(ctx context.Context) (map[string]int64, error) {
-	query, err := s.pool.Query(ctx, `SELECT (key, value) FROM counters`)
+	query, err := s.pool.Query(ctx, `SELECT key, value FROM counters`)
 	if err != nil {
 		return nil, err
 	}
@@ -180,6 +312,33 @@ func (s *PostgresStorage) getAllCounters(ctx context.Context) (map[string]int64,
 	return rows, nil
 }
 
+func (s *PostgresStorage) getAllHistograms(ctx context.Context) (map[string]core.HistogramValue, error) {
+	query, err := s.pool.Query(ctx, `SELECT key, bounds, counts, sum, count FROM histograms`)
+	if err != nil {
+		return nil, err
+	}
+
+	defer query.Close()
+
+	rows := make(map[string]core.HistogramValue)
+	for query.Next() {
+		var (
+			id     string
+			h      core.HistogramValue
+			counts []int64
+			count  int64
+		)
+		if err := query.Scan(&id, &h.Bounds, &counts, &h.Sum, &count); err != nil {
+			return nil, err
+		}
+		h.Counts = countsFromInt64(counts)
+		h.Count = uint64(count)
+		rows[id] = h
+	}
+
+	return rows, nil
+}
+
 func (s *PostgresStorage) getAll(ctx context.Context) (core.BaseMetricStorage, error) {
 	gauges, err := s.getAllGauges(ctx)
 	if err != nil {
@@ -191,30 +350,22 @@ func (s *PostgresStorage) getAll(ctx context.Context) (core.BaseMetricStorage, e
 		return core.BaseMetricStorage{}, err
 	}
 
-	return core.NewBaseMetricStorageWithValues(gauges, counters), nil
+	histograms, err := s.getAllHistograms(ctx)
+	if err != nil {
+		return core.BaseMetricStorage{}, err
+	}
+
+	return core.NewBaseMetricStorageWithValues(gauges, counters, histograms), nil
 }
 
 func (s *PostgresStorage) initialize() error {
-	_, err := s.pool.Exec(context.Background(), `
-		CREATE TABLE IF NOT EXISTS gauges (
-			key VARCHAR(255) PRIMARY KEY,
-			value DOUBLE PRECISION
-		);
-	`)
+	migrator, err := migrations.NewMigrator(s.pool)
 	if err != nil {
 		return err
 	}
 
-	_, err = s.pool.Exec(context.Background(), `
-		CREATE TABLE IF NOT EXISTS counters (
-			key VARCHAR(255) PRIMARY KEY,
-			value INT8
-		);
-	`)
-	if err != nil {
-		return err
-	}
-	return nil
+	_, err = migrator.Up(context.Background(), 0)
+	return err
 }
 
 func (s *PostgresStorage) set(ctx context.Context, metric core.MetricType, key string, value string) error {
@@ -261,6 +412,24 @@ func (s *PostgresStorage) set(ctx context.Context, metric core.MetricType, key s
 			}
 		}
 
+	case core.Histogram:
+		{
+			h, err := core.ParseHistogram(value)
+			if err != nil {
+				return core.ErrBadMetricValue
+			}
+
+			_, err = s.upsertHistogram(ctx, tx, key, h)
+			if err != nil {
+				return err
+			}
+
+			err = tx.Commit(ctx)
+			if err != nil {
+				return err
+			}
+		}
+
 	default:
 		return core.ErrUnknownMetricType
 	}
@@ -275,17 +444,104 @@ func (s *PostgresStorage) setBatch(ctx context.Context, batch core.BaseMetricSto
 	}
 	defer tx.Rollback(ctx)
 
-	for k, v := range batch.Gauges() {
-		if _, err := s.upsertGauge(ctx, tx, k, v); err != nil {
-			return err
-		}
+	if err := s.applyBatch(ctx, tx, batch); err != nil {
+		return err
 	}
 
-	for k, v := range batch.Counters() {
-		if _, err := s.upsertCounter(ctx, tx, k, v); err != nil {
+	return tx.Commit(ctx)
+}
+
+func (s *PostgresStorage) setBatchOnce(ctx context.Context, id core.BatchID, batch core.BaseMetricStorage) error {
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	var maxSeq int64
+	err = tx.QueryRow(
+		ctx,
+		`SELECT COALESCE(max(seq), 0) FROM applied_batches WHERE agent_id = $1`,
+		id.AgentID,
+	).Scan(&maxSeq)
+	if err != nil {
+		return err
+	}
+	if core.StaleSeq(id.Seq, uint64(maxSeq), core.DefaultAppliedBatchesWindow) {
+		return core.ErrDuplicateBatch
+	}
+
+	tag, err := tx.Exec(
+		ctx,
+		`INSERT INTO applied_batches (agent_id, key, seq)
+			VALUES ($1, $2, $3)
+			ON CONFLICT (agent_id, key) DO NOTHING`,
+		id.AgentID, id.Key, int64(id.Seq),
+	)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return core.ErrDuplicateBatch
+	}
+
+	if err := s.applyBatch(ctx, tx, batch); err != nil {
+		return err
+	}
+
+	// Отметки пачек, отстающих от наибольшего номера агента на окно, больше не нужны:
+	// такие повторы отклоняются по номеру
+	if floor := max(maxSeq, int64(id.Seq)) - core.DefaultAppliedBatchesWindow; floor > 0 {
+		_, err = tx.Exec(
+			ctx,
+			`DELETE FROM applied_batches WHERE agent_id = $1 AND seq > 0 AND seq <= $2`,
+			id.AgentID, floor,
+		)
+		if err != nil {
 			return err
 		}
 	}
 
+	// Отметки агентов, которые давно не присылали пачек
+	_, err = tx.Exec(
+		ctx,
+		`DELETE FROM applied_batches WHERE applied_at < now() - $1 * interval '1 second'`,
+		int64(core.DefaultAppliedBatchesTTL.Seconds()),
+	)
+	if err != nil {
+		return err
+	}
+
 	return tx.Commit(ctx)
 }
+
+// seriesColumns разбирает идентификатор серии на значения колонок name и labels.
+func seriesColumns(key string) (string, core.Labels) {
+	name, labels, err := core.ParseMetricKey(key)
+	if err != nil {
+		return key, core.Labels{}
+	}
+
+	if labels == nil {
+		labels = core.Labels{}
+	}
+
+	return name, labels
+}
+
+// countsToInt64 приводит счетчики корзин к типу, который хранится в колонке INT8[].
+func countsToInt64(counts []uint64) []int64 {
+	out := make([]int64, len(counts))
+	for i, c := range counts {
+		out[i] = int64(c)
+	}
+	return out
+}
+
+func countsFromInt64(counts []int64) []uint64 {
+	out := make([]uint64, len(counts))
+	for i, c := range counts {
+		out[i] = uint64(c)
+	}
+	return out
+}
@@ -0,0 +1,341 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/smartfor/metrics/internal/core"
+)
+
+// Запись пачки метрик в Postgres. Метрики каждого типа записываются одним запросом:
+// небольшие пачки - upsert из unnest массивов параметров, большие - через COPY во временную
+// таблицу и один upsert из нее. В обоих случаях значения счетчиков прибавляются к текущим,
+// а изменения gauge и counter попадают в history, как при записи одной метрики.
+
+// batchMode - способ записи пачки
+type batchMode int
+
+const (
+	// batchModeAuto - unnest или COPY в зависимости от размера пачки
+	batchModeAuto batchMode = iota
+	// batchModeRows - отдельный запрос на каждую метрику
+	batchModeRows
+	// batchModeUnnest - один upsert из unnest массивов на каждый тип метрик
+	batchModeUnnest
+	// batchModeCopy - COPY во временную таблицу и один upsert из нее на каждый тип метрик
+	batchModeCopy
+)
+
+// copyBatchThreshold - число метрик одного типа, начиная с которого в режиме batchModeAuto используется COPY
+const copyBatchThreshold = 2000
+
+// Временные таблицы живут до конца сессии, а строки в них - до конца транзакции
+const createStagingTables = `
+	CREATE TEMP TABLE IF NOT EXISTS staging_gauges (
+		key TEXT, name TEXT, labels JSONB, value DOUBLE PRECISION
+	) ON COMMIT DELETE ROWS;
+	CREATE TEMP TABLE IF NOT EXISTS staging_counters (
+		key TEXT, name TEXT, labels JSONB, value INT8
+	) ON COMMIT DELETE ROWS;
+	CREATE TEMP TABLE IF NOT EXISTS staging_histograms (
+		key TEXT, name TEXT, labels JSONB, bounds DOUBLE PRECISION[], counts INT8[], sum DOUBLE PRECISION, count INT8
+	) ON COMMIT DELETE ROWS;
+`
+
+// Запросы записи, %s - источник строк с колонками таблицы
+const (
+	mergeGauges = `WITH upsert AS (
+			INSERT INTO gauges (key, name, labels, value)
+				%s
+				ON CONFLICT (key)
+				DO UPDATE SET value = EXCLUDED.value
+				RETURNING key, value
+		)
+		INSERT INTO history (key, type, ts, value)
+			SELECT key, 'gauge', now(), value FROM upsert`
+
+	mergeCounters = `WITH upsert AS (
+			INSERT INTO counters (key, name, labels, value)
+				%s
+				ON CONFLICT (key)
+				DO UPDATE SET value = counters.value + EXCLUDED.value
+				RETURNING key, value
+		)
+		INSERT INTO history (key, type, ts, value)
+			SELECT key, 'counter', now(), value FROM upsert`
+
+	mergeHistograms = `INSERT INTO histograms (key, name, labels, bounds, counts, sum, count)
+			%s
+			ON CONFLICT (key)
+			DO UPDATE SET
+				bounds = EXCLUDED.bounds,
+				counts = CASE WHEN histograms.bounds = EXCLUDED.bounds
+					THEN (
+						SELECT array_agg(o + n ORDER BY i)
+						FROM unnest(histograms.counts, EXCLUDED.counts) WITH ORDINALITY AS t(o, n, i)
+					)
+					ELSE EXCLUDED.counts END,
+				sum = CASE WHEN histograms.bounds = EXCLUDED.bounds
+					THEN histograms.sum + EXCLUDED.sum
+					ELSE EXCLUDED.sum END,
+				count = CASE WHEN histograms.bounds = EXCLUDED.bounds
+					THEN histograms.count + EXCLUDED.count
+					ELSE EXCLUDED.count END`
+)
+
+// Источники строк из массивов параметров. Массивы гистограмм разной длины
+// передаются текстовыми литералами и приводятся к типам колонок в запросе.
+const (
+	unnestGauges = `SELECT key, name, labels::jsonb, value
+		FROM unnest($1::text[], $2::text[], $3::text[], $4::float8[]) AS t(key, name, labels, value)`
+
+	unnestCounters = `SELECT key, name, labels::jsonb, value
+		FROM unnest($1::text[], $2::text[], $3::text[], $4::int8[]) AS t(key, name, labels, value)`
+
+	unnestHistograms = `SELECT key, name, labels::jsonb, bounds::float8[], counts::int8[], sum, count
+		FROM unnest($1::text[], $2::text[], $3::text[], $4::text[], $5::text[], $6::float8[], $7::int8[])
+			AS t(key, name, labels, bounds, counts, sum, count)`
+)
+
+func (s *PostgresStorage) applyBatch(ctx context.Context, tx pgx.Tx, batch core.BaseMetricStorage) error {
+	return s.applyBatchMode(ctx, tx, batch, s.batchMode)
+}
+
+func (s *PostgresStorage) applyBatchMode(ctx context.Context, tx pgx.Tx, batch core.BaseMetricStorage, mode batchMode) error {
+	if mode == batchModeRows {
+		return s.applyBatchRows(ctx, tx, batch)
+	}
+
+	gauges, counters, histograms := batch.Gauges(), batch.Counters(), batch.Histograms()
+
+	useCopy := func(n int) bool {
+		return mode == batchModeCopy || (mode == batchModeAuto && n >= copyBatchThreshold)
+	}
+	if useCopy(len(gauges)) || useCopy(len(counters)) || useCopy(len(histograms)) {
+		if _, err := tx.Exec(ctx, createStagingTables); err != nil {
+			return err
+		}
+	}
+
+	if len(gauges) > 0 {
+		var err error
+		if useCopy(len(gauges)) {
+			err = copyGauges(ctx, tx, gauges)
+		} else {
+			err = unnestGaugesUpsert(ctx, tx, gauges)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	if len(counters) > 0 {
+		var err error
+		if useCopy(len(counters)) {
+			err = copyCounters(ctx, tx, counters)
+		} else {
+			err = unnestCountersUpsert(ctx, tx, counters)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	if len(histograms) > 0 {
+		var err error
+		if useCopy(len(histograms)) {
+			err = copyHistograms(ctx, tx, histograms)
+		} else {
+			err = unnestHistogramsUpsert(ctx, tx, histograms)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// applyBatchRows записывает метрики по одной.
+func (s *PostgresStorage) applyBatchRows(ctx context.Context, tx pgx.Tx, batch core.BaseMetricStorage) error {
+	for k, v := range batch.Gauges() {
+		if _, err := s.upsertGauge(ctx, tx, k, v); err != nil {
+			return err
+		}
+	}
+
+	for k, v := range batch.Counters() {
+		if _, err := s.upsertCounter(ctx, tx, k, v); err != nil {
+			return err
+		}
+	}
+
+	for k, v := range batch.Histograms() {
+		if _, err := s.upsertHistogram(ctx, tx, k, v); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// seriesArrays - колонки key, name и labels пачки метрик одного типа
+type seriesArrays struct {
+	keys   []string
+	names  []string
+	labels []string
+}
+
+func (a *seriesArrays) add(key string) error {
+	name, labels := seriesColumns(key)
+	data, err := json.Marshal(labels)
+	if err != nil {
+		return err
+	}
+
+	a.keys = append(a.keys, key)
+	a.names = append(a.names, name)
+	a.labels = append(a.labels, string(data))
+	return nil
+}
+
+func unnestGaugesUpsert(ctx context.Context, tx pgx.Tx, gauges map[string]float64) error {
+	var series seriesArrays
+	values := make([]float64, 0, len(gauges))
+	for k, v := range gauges {
+		if err := series.add(k); err != nil {
+			return err
+		}
+		values = append(values, v)
+	}
+
+	_, err := tx.Exec(ctx, fmt.Sprintf(mergeGauges, unnestGauges), series.keys, series.names, series.labels, values)
+	return err
+}
+
+func unnestCountersUpsert(ctx context.Context, tx pgx.Tx, counters map[string]int64) error {
+	var series seriesArrays
+	values := make([]int64, 0, len(counters))
+	for k, v := range counters {
+		if err := series.add(k); err != nil {
+			return err
+		}
+		values = append(values, v)
+	}
+
+	_, err := tx.Exec(ctx, fmt.Sprintf(mergeCounters, unnestCounters), series.keys, series.names, series.labels, values)
+	return err
+}
+
+func unnestHistogramsUpsert(ctx context.Context, tx pgx.Tx, histograms map[string]core.HistogramValue) error {
+	var series seriesArrays
+	bounds := make([]string, 0, len(histograms))
+	counts := make([]string, 0, len(histograms))
+	sums := make([]float64, 0, len(histograms))
+	totals := make([]int64, 0, len(histograms))
+	for k, h := range histograms {
+		if err := series.add(k); err != nil {
+			return err
+		}
+		bounds = append(bounds, float8ArrayLiteral(h.Bounds))
+		counts = append(counts, int8ArrayLiteral(h.Counts))
+		sums = append(sums, h.Sum)
+		totals = append(totals, int64(h.Count))
+	}
+
+	_, err := tx.Exec(
+		ctx,
+		fmt.Sprintf(mergeHistograms, unnestHistograms),
+		series.keys, series.names, series.labels, bounds, counts, sums, totals,
+	)
+	return err
+}
+
+func copyGauges(ctx context.Context, tx pgx.Tx, gauges map[string]float64) error {
+	rows := make([][]any, 0, len(gauges))
+	for k, v := range gauges {
+		name, labels := seriesColumns(k)
+		rows = append(rows, []any{k, name, labels, v})
+	}
+
+	return copyAndMerge(ctx, tx, "staging_gauges", []string{"key", "name", "labels", "value"}, rows, mergeGauges)
+}
+
+func copyCounters(ctx context.Context, tx pgx.Tx, counters map[string]int64) error {
+	rows := make([][]any, 0, len(counters))
+	for k, v := range counters {
+		name, labels := seriesColumns(k)
+		rows = append(rows, []any{k, name, labels, v})
+	}
+
+	return copyAndMerge(ctx, tx, "staging_counters", []string{"key", "name", "labels", "value"}, rows, mergeCounters)
+}
+
+func copyHistograms(ctx context.Context, tx pgx.Tx, histograms map[string]core.HistogramValue) error {
+	rows := make([][]any, 0, len(histograms))
+	for k, h := range histograms {
+		name, labels := seriesColumns(k)
+		rows = append(rows, []any{k, name, labels, h.Bounds, countsToInt64(h.Counts), h.Sum, int64(h.Count)})
+	}
+
+	columns := []string{"key", "name", "labels", "bounds", "counts", "sum", "count"}
+	return copyAndMerge(ctx, tx, "staging_histograms", columns, rows, mergeHistograms)
+}
+
+// copyAndMerge копирует строки во временную таблицу table и переносит их запросом merge.
+func copyAndMerge(ctx context.Context, tx pgx.Tx, table string, columns []string, rows [][]any, merge string) error {
+	if _, err := tx.CopyFrom(ctx, pgx.Identifier{table}, columns, pgx.CopyFromRows(rows)); err != nil {
+		return err
+	}
+
+	source := fmt.Sprintf("SELECT %s FROM %s", strings.Join(columns, ", "), table)
+	if _, err := tx.Exec(ctx, fmt.Sprintf(merge, source)); err != nil {
+		return err
+	}
+
+	// Одна транзакция может записать несколько пачек, строки не должны примениться дважды
+	_, err := tx.Exec(ctx, "TRUNCATE "+table)
+	return err
+}
+
+// float8ArrayLiteral форматирует значения как литерал массива DOUBLE PRECISION[].
+func float8ArrayLiteral(values []float64) string {
+	var b strings.Builder
+	b.WriteByte('{')
+	for i, v := range values {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		switch {
+		case math.IsInf(v, 1):
+			b.WriteString("Infinity")
+		case math.IsInf(v, -1):
+			b.WriteString("-Infinity")
+		default:
+			b.WriteString(strconv.FormatFloat(v, 'g', -1, 64))
+		}
+	}
+	b.WriteByte('}')
+
+	return b.String()
+}
+
+// int8ArrayLiteral форматирует счетчики корзин как литерал массива INT8[].
+func int8ArrayLiteral(values []uint64) string {
+	var b strings.Builder
+	b.WriteByte('{')
+	for i, v := range values {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		b.WriteString(strconv.FormatInt(int64(v), 10))
+	}
+	b.WriteByte('}')
+
+	return b.String()
+}
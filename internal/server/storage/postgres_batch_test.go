@@ -0,0 +1,128 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"os"
+	"testing"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/smartfor/metrics/internal/core"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestArrayLiterals(t *testing.T) {
+	assert.Equal(t, "{}", float8ArrayLiteral(nil))
+	assert.Equal(t, "{0.5,1,1e+21,Infinity,-Infinity}", float8ArrayLiteral([]float64{0.5, 1, 1e21, math.Inf(1), math.Inf(-1)}))
+	assert.Equal(t, "{}", int8ArrayLiteral(nil))
+	assert.Equal(t, "{0,3,42}", int8ArrayLiteral([]uint64{0, 3, 42}))
+}
+
+// newTestPostgres подключается к базе из TEST_DATABASE_DSN, без нее тест пропускается.
+// Тесты пишут метрики с префиксом test_batch_ и удаляют их после себя.
+func newTestPostgres(tb testing.TB) *PostgresStorage {
+	dsn := os.Getenv("TEST_DATABASE_DSN")
+	if dsn == "" {
+		tb.Skip("TEST_DATABASE_DSN is not set")
+	}
+
+	s, err := NewPostgresStorage(context.Background(), dsn)
+	require.NoError(tb, err)
+
+	cleanup := func() {
+		for _, table := range []string{"gauges", "counters", "histograms", "history"} {
+			_, err := s.pool.Exec(context.Background(), "DELETE FROM "+table+" WHERE key LIKE 'test_batch_%'")
+			require.NoError(tb, err)
+		}
+	}
+	cleanup()
+	tb.Cleanup(func() {
+		cleanup()
+		s.Close()
+	})
+
+	return s
+}
+
+func testBatchOfSize(n int) core.BaseMetricStorage {
+	batch := core.NewBaseMetricStorage()
+	for i := 0; i < n; i++ {
+		labels := core.Labels{"instance": fmt.Sprintf("host-%d", i%10)}
+		batch.SetGauge(core.MetricKey(fmt.Sprintf("test_batch_gauge_%d", i), labels), float64(i))
+		batch.SetCounter(core.MetricKey(fmt.Sprintf("test_batch_counter_%d", i), labels), int64(i))
+		batch.SetHistogram(fmt.Sprintf("test_batch_histogram_%d", i), core.HistogramValue{
+			Bounds: []float64{0.1, 1},
+			Counts: []uint64{1, 2, 0},
+			Sum:    1.5,
+			Count:  3,
+		})
+	}
+
+	return batch
+}
+
+func TestPostgresBatchModes(t *testing.T) {
+	s := newTestPostgres(t)
+	ctx := context.Background()
+	batch := testBatchOfSize(50)
+
+	modes := []batchMode{batchModeRows, batchModeUnnest, batchModeCopy}
+	for _, mode := range modes {
+		err := pgx.BeginFunc(ctx, s.pool, func(tx pgx.Tx) error {
+			return s.applyBatchMode(ctx, tx, batch, mode)
+		})
+		require.NoError(t, err, "mode %d", mode)
+	}
+
+	all, err := s.GetAll(ctx)
+	require.NoError(t, err)
+
+	for k, v := range batch.Gauges() {
+		assert.Equal(t, v, all.Gauges()[k], k)
+	}
+	for k, v := range batch.Counters() {
+		assert.Equal(t, v*int64(len(modes)), all.Counters()[k], "counters must accumulate: %s", k)
+	}
+	for k := range batch.Histograms() {
+		h := all.Histograms()[k]
+		assert.Equal(t, []uint64{3, 6, 0}, h.Counts, k)
+		assert.Equal(t, uint64(9), h.Count, k)
+	}
+
+	key := core.MetricKey("test_batch_gauge_1", core.Labels{"instance": "host-1"})
+	var name, instance string
+	err = s.pool.QueryRow(ctx, "SELECT name, labels->>'instance' FROM gauges WHERE key = $1", key).Scan(&name, &instance)
+	require.NoError(t, err)
+	assert.Equal(t, "test_batch_gauge_1", name)
+	assert.Equal(t, "host-1", instance)
+}
+
+func BenchmarkPostgresSetBatch(b *testing.B) {
+	s := newTestPostgres(b)
+	ctx := context.Background()
+
+	modes := []struct {
+		name string
+		mode batchMode
+	}{
+		{"rows", batchModeRows},
+		{"unnest", batchModeUnnest},
+		{"copy", batchModeCopy},
+	}
+
+	for _, size := range []int{10, 1000, 10000} {
+		batch := testBatchOfSize(size)
+		for _, m := range modes {
+			b.Run(fmt.Sprintf("%s/%d", m.name, size), func(b *testing.B) {
+				for i := 0; i < b.N; i++ {
+					err := pgx.BeginFunc(ctx, s.pool, func(tx pgx.Tx) error {
+						return s.applyBatchMode(ctx, tx, batch, m.mode)
+					})
+					require.NoError(b, err)
+				}
+			})
+		}
+	}
+}
@@ -0,0 +1,355 @@
+package storage
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/smartfor/metrics/internal/core"
+)
+
+// Снимок файлового хранилища - заголовок в первой строке и тело с метриками:
+//
+//	{"version":2,"timestamp":"2024-01-01T00:00:00Z","checksum":"1c291ca3","size":123,"wal_seq":42}
+//	{"gauges": {...}, "counters": {...}, "histograms": {...}}
+//
+// Снимки версии 1, записанные до появления заголовка, содержат только тело.
+// Вместо JSON снимок может быть записан в компактном двоичном формате (см. snapshot_binary.go),
+// а также сжат gzip или zstd. Формат и сжатие определяются при чтении по первым байтам файла.
+// Кроме текущего снимка <path> хранятся предыдущие поколения <path>.1, <path>.2, ...
+// Если текущий снимок поврежден, состояние восстанавливается из самого нового целого поколения.
+
+// snapshotVersion - версия формата снимка с заголовком
+const snapshotVersion = 2
+
+// DefaultSnapshotGenerations - число хранимых снимков вместе с текущим
+const DefaultSnapshotGenerations = 3
+
+// SnapshotFormat - формат записи снимка
+type SnapshotFormat string
+
+const (
+	// SnapshotFormatJSON - JSON с заголовком, формат по умолчанию
+	SnapshotFormatJSON SnapshotFormat = "json"
+	// SnapshotFormatBinary - компактный двоичный формат
+	SnapshotFormatBinary SnapshotFormat = "binary"
+)
+
+// SnapshotCompression - сжатие файла снимка
+type SnapshotCompression string
+
+const (
+	SnapshotCompressionNone SnapshotCompression = "none"
+	SnapshotCompressionGzip SnapshotCompression = "gzip"
+	SnapshotCompressionZstd SnapshotCompression = "zstd"
+)
+
+var (
+	ErrSnapshotCorrupted          = errors.New("snapshot corrupted")
+	ErrNoValidSnapshot            = errors.New("no valid snapshot")
+	ErrUnknownSnapshotFormat      = errors.New("unknown snapshot format")
+	ErrUnknownSnapshotCompression = errors.New("unknown snapshot compression")
+)
+
+var (
+	gzipMagic = []byte{0x1f, 0x8b}
+	zstdMagic = []byte{0x28, 0xb5, 0x2f, 0xfd}
+)
+
+// snapshotEncoding - формат и сжатие файла снимка
+type snapshotEncoding struct {
+	Format      SnapshotFormat
+	Compression SnapshotCompression
+}
+
+func (e snapshotEncoding) validate() error {
+	switch e.Format {
+	case SnapshotFormatJSON, SnapshotFormatBinary:
+	default:
+		return fmt.Errorf("%w: %s", ErrUnknownSnapshotFormat, e.Format)
+	}
+
+	switch e.Compression {
+	case SnapshotCompressionNone, SnapshotCompressionGzip, SnapshotCompressionZstd:
+	default:
+		return fmt.Errorf("%w: %s", ErrUnknownSnapshotCompression, e.Compression)
+	}
+
+	return nil
+}
+
+type snapshotHeader struct {
+	Version   int       `json:"version"`
+	Timestamp time.Time `json:"timestamp"`
+	// Checksum - crc32 тела снимка
+	Checksum string `json:"checksum"`
+	// Size - размер тела снимка
+	Size int `json:"size"`
+	// WALSeq - записи журнала с номером до WALSeq включительно уже учтены в снимке
+	WALSeq uint64 `json:"wal_seq"`
+}
+
+// snapshot - содержимое файла снимка.
+type snapshot struct {
+	metrics
+	WALSeq uint64 `json:"wal_seq,omitempty"`
+}
+
+// generationPath возвращает путь к поколению снимка, 0 - текущий снимок.
+func generationPath(path string, generation int) string {
+	if generation == 0 {
+		return path
+	}
+
+	return path + "." + strconv.Itoa(generation)
+}
+
+// readSnapshot читает самое новое целое поколение снимка и возвращает его формат.
+// Если снимков нет, возвращается пустое состояние и found=false.
+func readSnapshot(path string, generations int) (snap snapshot, enc snapshotEncoding, found bool, err error) {
+	var errs []error
+
+	for g := 0; g < max(generations, 1); g++ {
+		data, err := os.ReadFile(generationPath(path, g))
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return snapshot{}, enc, false, err
+		}
+
+		snap, enc, err := decodeSnapshot(data)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", generationPath(path, g), err))
+			continue
+		}
+
+		return snap, enc, true, nil
+	}
+
+	if len(errs) > 0 {
+		return snapshot{}, enc, false, fmt.Errorf("%w: %w", ErrNoValidSnapshot, errors.Join(errs...))
+	}
+
+	return snapshot{metrics: *newMetrics()}, enc, false, nil
+}
+
+// decodeSnapshot разбирает снимок любого поддерживаемого формата и сжатия.
+func decodeSnapshot(data []byte) (snapshot, snapshotEncoding, error) {
+	enc := snapshotEncoding{Format: SnapshotFormatJSON, Compression: SnapshotCompressionNone}
+
+	var err error
+	switch {
+	case bytes.HasPrefix(data, gzipMagic):
+		enc.Compression = SnapshotCompressionGzip
+		data, err = gunzip(data)
+	case bytes.HasPrefix(data, zstdMagic):
+		enc.Compression = SnapshotCompressionZstd
+		data, err = unzstd(data)
+	}
+	if err != nil {
+		return snapshot{}, enc, fmt.Errorf("%w: %w", ErrSnapshotCorrupted, err)
+	}
+
+	if bytes.HasPrefix(data, binarySnapshotMagic) {
+		enc.Format = SnapshotFormatBinary
+		snap, err := decodeBinarySnapshot(data)
+		if err != nil {
+			return snap, enc, fmt.Errorf("%w: %w", ErrSnapshotCorrupted, err)
+		}
+		return snap, enc, nil
+	}
+
+	snap, err := decodeJSONSnapshot(data)
+	return snap, enc, err
+}
+
+func decodeJSONSnapshot(data []byte) (snapshot, error) {
+	snap := snapshot{metrics: *newMetrics()}
+	if len(data) == 0 {
+		return snap, nil
+	}
+
+	body := data
+	if line, rest, ok := bytes.Cut(data, []byte("\n")); ok {
+		var header snapshotHeader
+		if json.Unmarshal(line, &header) == nil && header.Version > 0 {
+			if header.Version > snapshotVersion {
+				return snap, fmt.Errorf("%w: unsupported version %d", ErrSnapshotCorrupted, header.Version)
+			}
+			if len(rest) != header.Size || fmt.Sprintf("%08x", crc32.ChecksumIEEE(rest)) != header.Checksum {
+				return snap, fmt.Errorf("%w: checksum mismatch", ErrSnapshotCorrupted)
+			}
+			body = rest
+			snap.WALSeq = header.WALSeq
+		}
+	}
+
+	if err := json.Unmarshal(body, &snap); err != nil {
+		return snap, fmt.Errorf("%w: %w", ErrSnapshotCorrupted, err)
+	}
+
+	// файлы, записанные до появления гистограмм, не содержат этого раздела
+	if snap.Gauges == nil {
+		snap.Gauges = make(map[string]float64)
+	}
+	if snap.Counters == nil {
+		snap.Counters = make(map[string]int64)
+	}
+	if snap.Histograms == nil {
+		snap.Histograms = make(map[string]core.HistogramValue)
+	}
+
+	return snap, nil
+}
+
+// encodeSnapshot записывает состояние в формате и со сжатием enc.
+func encodeSnapshot(state *metrics, walSeq uint64, now time.Time, enc snapshotEncoding) ([]byte, error) {
+	var (
+		data []byte
+		err  error
+	)
+
+	if enc.Format == SnapshotFormatBinary {
+		data, err = encodeBinarySnapshot(state, walSeq, now)
+	} else {
+		data, err = encodeJSONSnapshot(state, walSeq, now)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	switch enc.Compression {
+	case SnapshotCompressionGzip:
+		return gzipData(data)
+	case SnapshotCompressionZstd:
+		return zstdData(data)
+	default:
+		return data, nil
+	}
+}
+
+func encodeJSONSnapshot(state *metrics, walSeq uint64, now time.Time) ([]byte, error) {
+	body, err := json.MarshalIndent(state, "", "\t")
+	if err != nil {
+		return nil, err
+	}
+
+	header, err := json.Marshal(snapshotHeader{
+		Version:   snapshotVersion,
+		Timestamp: now.UTC(),
+		Checksum:  fmt.Sprintf("%08x", crc32.ChecksumIEEE(body)),
+		Size:      len(body),
+		WALSeq:    walSeq,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return append(append(header, '\n'), body...), nil
+}
+
+// writeSnapshot атомарно записывает снимок: данные пишутся во временный файл и сбрасываются на диск,
+// прежние снимки сдвигаются на поколение назад, временный файл переименовывается в path.
+// При сбое на любом шаге на диске остается хотя бы одно целое поколение.
+func writeSnapshot(path string, generations int, data []byte) error {
+	tmp := path + ".tmp"
+	if err := writeFileSync(tmp, data); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+
+	for g := max(generations, 1) - 1; g > 0; g-- {
+		err := os.Rename(generationPath(path, g-1), generationPath(path, g))
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+	}
+
+	if err := os.Rename(tmp, path); err != nil {
+		return err
+	}
+
+	return syncDir(filepath.Dir(path))
+}
+
+func gzipData(data []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	if _, err := zw.Write(data); err != nil {
+		return nil, err
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+func gunzip(data []byte) ([]byte, error) {
+	zr, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	defer zr.Close()
+
+	return io.ReadAll(zr)
+}
+
+func zstdData(data []byte) ([]byte, error) {
+	zw, err := zstd.NewWriter(nil)
+	if err != nil {
+		return nil, err
+	}
+	defer zw.Close()
+
+	return zw.EncodeAll(data, nil), nil
+}
+
+func unzstd(data []byte) ([]byte, error) {
+	zr, err := zstd.NewReader(nil)
+	if err != nil {
+		return nil, err
+	}
+	defer zr.Close()
+
+	return zr.DecodeAll(data, nil)
+}
+
+func writeFileSync(path string, data []byte) error {
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0666)
+	if err != nil {
+		return err
+	}
+
+	if _, err := file.Write(data); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Sync(); err != nil {
+		file.Close()
+		return err
+	}
+
+	return file.Close()
+}
+
+// syncDir сбрасывает на диск каталог, чтобы переименование файла пережило сбой.
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+
+	return d.Sync()
+}
@@ -0,0 +1,278 @@
+package storage
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"math"
+	"time"
+
+	"github.com/smartfor/metrics/internal/core"
+)
+
+// Двоичный формат снимка:
+//
+//	["MSNP"][версия uint8][timestamp varint, unix nano][wal_seq uvarint][размер тела uvarint][crc32 тела uint32][тело]
+//
+// Тело - три раздела (gauge, counter, histogram), каждый начинается с числа записей (uvarint).
+// Запись - ключ (uvarint длина + байты) и значение: gauge - float64, counter - varint,
+// histogram - границы (uvarint число + float64), корзины (uvarint число + uvarint), sum float64, count uvarint.
+// Числа float64 записываются как 8 байт little-endian.
+
+var binarySnapshotMagic = []byte("MSNP")
+
+const binarySnapshotVersion = 1
+
+// binaryMaxLen - ограничение на длины внутри снимка, защищает от выделения памяти по поврежденной длине
+const binaryMaxLen = 1 << 30
+
+var errBinaryLength = errors.New("bad length")
+
+type binaryWriter struct {
+	w   *bufio.Writer
+	buf [binary.MaxVarintLen64]byte
+}
+
+func (b *binaryWriter) uvarint(v uint64) {
+	n := binary.PutUvarint(b.buf[:], v)
+	b.w.Write(b.buf[:n])
+}
+
+func (b *binaryWriter) varint(v int64) {
+	n := binary.PutVarint(b.buf[:], v)
+	b.w.Write(b.buf[:n])
+}
+
+func (b *binaryWriter) float(v float64) {
+	binary.LittleEndian.PutUint64(b.buf[:8], math.Float64bits(v))
+	b.w.Write(b.buf[:8])
+}
+
+func (b *binaryWriter) string(s string) {
+	b.uvarint(uint64(len(s)))
+	b.w.WriteString(s)
+}
+
+func encodeBinarySnapshot(state *metrics, walSeq uint64, now time.Time) ([]byte, error) {
+	var body bytes.Buffer
+	w := &binaryWriter{w: bufio.NewWriter(&body)}
+
+	w.uvarint(uint64(len(state.Gauges)))
+	for k, v := range state.Gauges {
+		w.string(k)
+		w.float(v)
+	}
+
+	w.uvarint(uint64(len(state.Counters)))
+	for k, v := range state.Counters {
+		w.string(k)
+		w.varint(v)
+	}
+
+	w.uvarint(uint64(len(state.Histograms)))
+	for k, v := range state.Histograms {
+		w.string(k)
+		w.uvarint(uint64(len(v.Bounds)))
+		for _, b := range v.Bounds {
+			w.float(b)
+		}
+		w.uvarint(uint64(len(v.Counts)))
+		for _, c := range v.Counts {
+			w.uvarint(c)
+		}
+		w.float(v.Sum)
+		w.uvarint(v.Count)
+	}
+
+	if err := w.w.Flush(); err != nil {
+		return nil, err
+	}
+
+	var out bytes.Buffer
+	out.Grow(body.Len() + 32)
+	hw := &binaryWriter{w: bufio.NewWriter(&out)}
+	hw.w.Write(binarySnapshotMagic)
+	hw.w.WriteByte(binarySnapshotVersion)
+	hw.varint(now.UnixNano())
+	hw.uvarint(walSeq)
+	hw.uvarint(uint64(body.Len()))
+	binary.LittleEndian.PutUint32(hw.buf[:4], crc32.ChecksumIEEE(body.Bytes()))
+	hw.w.Write(hw.buf[:4])
+	hw.w.Write(body.Bytes())
+
+	if err := hw.w.Flush(); err != nil {
+		return nil, err
+	}
+
+	return out.Bytes(), nil
+}
+
+type binaryReader struct {
+	r *bytes.Reader
+}
+
+func (b *binaryReader) uvarint() (uint64, error) {
+	return binary.ReadUvarint(b.r)
+}
+
+func (b *binaryReader) length() (int, error) {
+	v, err := b.uvarint()
+	if err != nil {
+		return 0, err
+	}
+	if v > binaryMaxLen || v > uint64(b.r.Len()) {
+		return 0, errBinaryLength
+	}
+
+	return int(v), nil
+}
+
+func (b *binaryReader) float() (float64, error) {
+	var buf [8]byte
+	if _, err := io.ReadFull(b.r, buf[:]); err != nil {
+		return 0, err
+	}
+
+	return math.Float64frombits(binary.LittleEndian.Uint64(buf[:])), nil
+}
+
+func (b *binaryReader) string() (string, error) {
+	n, err := b.length()
+	if err != nil {
+		return "", err
+	}
+
+	buf := make([]byte, n)
+	if _, err := io.ReadFull(b.r, buf); err != nil {
+		return "", err
+	}
+
+	return string(buf), nil
+}
+
+func decodeBinarySnapshot(data []byte) (snapshot, error) {
+	snap := snapshot{metrics: *newMetrics()}
+
+	r := &binaryReader{r: bytes.NewReader(data[len(binarySnapshotMagic):])}
+	version, err := r.r.ReadByte()
+	if err != nil {
+		return snap, err
+	}
+	if version != binarySnapshotVersion {
+		return snap, fmt.Errorf("unsupported binary version %d", version)
+	}
+	if _, err := binary.ReadVarint(r.r); err != nil {
+		return snap, err
+	}
+	if snap.WALSeq, err = r.uvarint(); err != nil {
+		return snap, err
+	}
+
+	size, err := r.length()
+	if err != nil {
+		return snap, err
+	}
+	var crc [4]byte
+	if _, err := io.ReadFull(r.r, crc[:]); err != nil {
+		return snap, err
+	}
+
+	body := data[len(data)-r.r.Len():]
+	if len(body) != size {
+		return snap, fmt.Errorf("body size mismatch")
+	}
+	if crc32.ChecksumIEEE(body) != binary.LittleEndian.Uint32(crc[:]) {
+		return snap, fmt.Errorf("checksum mismatch")
+	}
+
+	if err := decodeBinaryBody(&binaryReader{r: bytes.NewReader(body)}, &snap.metrics); err != nil {
+		return snap, err
+	}
+
+	return snap, nil
+}
+
+func decodeBinaryBody(r *binaryReader, state *metrics) error {
+	n, err := r.length()
+	if err != nil {
+		return err
+	}
+	for i := 0; i < n; i++ {
+		k, err := r.string()
+		if err != nil {
+			return err
+		}
+		if state.Gauges[k], err = r.float(); err != nil {
+			return err
+		}
+	}
+
+	if n, err = r.length(); err != nil {
+		return err
+	}
+	for i := 0; i < n; i++ {
+		k, err := r.string()
+		if err != nil {
+			return err
+		}
+		if state.Counters[k], err = binary.ReadVarint(r.r); err != nil {
+			return err
+		}
+	}
+
+	if n, err = r.length(); err != nil {
+		return err
+	}
+	for i := 0; i < n; i++ {
+		k, err := r.string()
+		if err != nil {
+			return err
+		}
+
+		h, err := decodeBinaryHistogram(r)
+		if err != nil {
+			return fmt.Errorf("%s: %w", k, err)
+		}
+		state.Histograms[k] = h
+	}
+
+	return nil
+}
+
+func decodeBinaryHistogram(r *binaryReader) (core.HistogramValue, error) {
+	var h core.HistogramValue
+
+	n, err := r.length()
+	if err != nil {
+		return h, err
+	}
+	h.Bounds = make([]float64, n)
+	for i := range h.Bounds {
+		if h.Bounds[i], err = r.float(); err != nil {
+			return h, err
+		}
+	}
+
+	if n, err = r.length(); err != nil {
+		return h, err
+	}
+	h.Counts = make([]uint64, n)
+	for i := range h.Counts {
+		if h.Counts[i], err = r.uvarint(); err != nil {
+			return h, err
+		}
+	}
+
+	if h.Sum, err = r.float(); err != nil {
+		return h, err
+	}
+	if h.Count, err = r.uvarint(); err != nil {
+		return h, err
+	}
+
+	return h, h.Validate()
+}
@@ -0,0 +1,135 @@
+package storage
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/smartfor/metrics/internal/core"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSnapshotGenerations(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "metrics.json")
+
+	f, err := NewFileStorageWithConfig(FileStorageConfig{Path: path, Generations: 3})
+	require.NoError(t, err)
+
+	for i := 1; i <= 4; i++ {
+		require.NoError(t, f.SetBatch(ctx, testBatch(float64(i), 1)))
+		require.NoError(t, f.Snapshot(ctx))
+	}
+	require.NoError(t, f.Close())
+
+	for g := 0; g < 3; g++ {
+		assert.FileExists(t, generationPath(path, g))
+	}
+	assert.NoFileExists(t, generationPath(path, 3))
+	assert.NoFileExists(t, path+".tmp")
+
+	t.Run("Corrupted latest snapshot falls back to previous generation", func(t *testing.T) {
+		data, err := os.ReadFile(path)
+		require.NoError(t, err)
+		data[len(data)-3] ^= 0xff
+		require.NoError(t, os.WriteFile(path, data, 0o600))
+
+		f, err := NewFileStorageWithConfig(FileStorageConfig{Path: path, Generations: 3})
+		require.NoError(t, err)
+		assertMetrics(t, f, "3", "3")
+	})
+
+	t.Run("Truncated snapshot is detected", func(t *testing.T) {
+		data, err := os.ReadFile(generationPath(path, 1))
+		require.NoError(t, err)
+
+		_, _, err = decodeSnapshot(data[:len(data)-10])
+		assert.ErrorIs(t, err, ErrSnapshotCorrupted)
+	})
+
+	t.Run("All generations corrupted", func(t *testing.T) {
+		for g := 0; g < 3; g++ {
+			require.NoError(t, os.WriteFile(generationPath(path, g), []byte("{garbage"), 0o600))
+		}
+
+		_, err := NewFileStorageWithConfig(FileStorageConfig{Path: path, Generations: 3})
+		assert.ErrorIs(t, err, ErrNoValidSnapshot)
+	})
+}
+
+func TestSnapshotEncodings(t *testing.T) {
+	ctx := context.Background()
+
+	histogram, err := core.NewHistogramValue([]float64{0.1, 1})
+	require.NoError(t, err)
+	histogram.Observe(0.05)
+	histogram.Observe(5)
+
+	values := core.NewBaseMetricStorage()
+	values.SetGauge(`load{host="a"}`, 0.25)
+	values.SetCounter("requests", -3)
+	values.SetHistogram("latency", histogram)
+
+	encodings := []snapshotEncoding{
+		{Format: SnapshotFormatJSON, Compression: SnapshotCompressionNone},
+		{Format: SnapshotFormatJSON, Compression: SnapshotCompressionZstd},
+		{Format: SnapshotFormatBinary, Compression: SnapshotCompressionNone},
+		{Format: SnapshotFormatBinary, Compression: SnapshotCompressionGzip},
+		{Format: SnapshotFormatBinary, Compression: SnapshotCompressionZstd},
+	}
+
+	for _, enc := range encodings {
+		t.Run(string(enc.Format)+"/"+string(enc.Compression), func(t *testing.T) {
+			state := newMetrics()
+			state.Gauges = values.Gauges()
+			state.Counters = values.Counters()
+			state.Histograms = values.Histograms()
+
+			data, err := encodeSnapshot(state, 7, time.Now(), enc)
+			require.NoError(t, err)
+
+			snap, detected, err := decodeSnapshot(data)
+			require.NoError(t, err)
+			assert.Equal(t, enc, detected)
+			assert.Equal(t, uint64(7), snap.WALSeq)
+			assert.Equal(t, *state, snap.metrics)
+
+			_, _, err = decodeSnapshot(data[:len(data)-4])
+			assert.ErrorIs(t, err, ErrSnapshotCorrupted)
+		})
+	}
+
+	t.Run("JSON snapshot is converted on open", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "metrics.json")
+
+		f, err := NewFileStorage(path)
+		require.NoError(t, err)
+		require.NoError(t, f.SetValues(ctx, values))
+		require.NoError(t, f.Close())
+
+		cfg := FileStorageConfig{Path: path, Format: SnapshotFormatBinary, Compression: SnapshotCompressionZstd}
+		f, err = NewFileStorageWithConfig(cfg)
+		require.NoError(t, err)
+		defer f.Close()
+
+		data, err := os.ReadFile(path)
+		require.NoError(t, err)
+		_, detected, err := decodeSnapshot(data)
+		require.NoError(t, err)
+		assert.Equal(t, snapshotEncoding{Format: SnapshotFormatBinary, Compression: SnapshotCompressionZstd}, detected)
+
+		all, err := f.GetAll(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, values.Gauges(), all.Gauges())
+		assert.Equal(t, values.Counters(), all.Counters())
+		assert.Equal(t, values.Histograms(), all.Histograms())
+	})
+
+	t.Run("Unknown format", func(t *testing.T) {
+		_, err := NewFileStorageWithConfig(FileStorageConfig{Path: filepath.Join(t.TempDir(), "m"), Format: "xml"})
+		assert.ErrorIs(t, err, ErrUnknownSnapshotFormat)
+	})
+}
@@ -0,0 +1,132 @@
+package storage
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"io"
+	"os"
+)
+
+// Журнал предзаписи (WAL) файлового хранилища. Каждая запись:
+//
+//	[длина payload uint32][crc32 payload uint32][payload]
+//
+// Записи только дописываются в конец файла. При открытии журнал читается до первой
+// поврежденной или недописанной записи, хвост после нее отбрасывается.
+
+const (
+	walHeaderSize = 8
+	// walMaxRecord - ограничение размера записи, защищает от чтения мусорной длины
+	walMaxRecord = 64 << 20
+)
+
+var ErrWALRecordTooLarge = errors.New("wal record too large")
+
+type wal struct {
+	file *os.File
+	size int64
+}
+
+// openWAL открывает журнал path и передает в replay каждую целую запись по порядку.
+// Поврежденный хвост журнала обрезается.
+func openWAL(path string, replay func(payload []byte) error) (*wal, error) {
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0666)
+	if err != nil {
+		return nil, err
+	}
+
+	valid, err := readWAL(file, replay)
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	if info.Size() > valid {
+		if err := file.Truncate(valid); err != nil {
+			file.Close()
+			return nil, err
+		}
+	}
+
+	return &wal{file: file, size: valid}, nil
+}
+
+// readWAL читает записи журнала и возвращает размер его целой части.
+func readWAL(file *os.File, replay func(payload []byte) error) (int64, error) {
+	reader := bufio.NewReader(io.NewSectionReader(file, 0, 1<<62))
+	header := make([]byte, walHeaderSize)
+
+	var offset int64
+	for {
+		if _, err := io.ReadFull(reader, header); err != nil {
+			// Конец журнала или недописанный заголовок
+			return offset, nil
+		}
+
+		length := binary.LittleEndian.Uint32(header[0:4])
+		if length > walMaxRecord {
+			return offset, nil
+		}
+
+		payload := make([]byte, length)
+		if _, err := io.ReadFull(reader, payload); err != nil {
+			return offset, nil
+		}
+		if crc32.ChecksumIEEE(payload) != binary.LittleEndian.Uint32(header[4:8]) {
+			return offset, nil
+		}
+
+		if err := replay(payload); err != nil {
+			return 0, err
+		}
+		offset += walHeaderSize + int64(length)
+	}
+}
+
+// append дописывает запись в журнал и сбрасывает ее на диск.
+func (w *wal) append(payload []byte) error {
+	if len(payload) > walMaxRecord {
+		return ErrWALRecordTooLarge
+	}
+
+	record := make([]byte, walHeaderSize+len(payload))
+	binary.LittleEndian.PutUint32(record[0:4], uint32(len(payload)))
+	binary.LittleEndian.PutUint32(record[4:8], crc32.ChecksumIEEE(payload))
+	copy(record[walHeaderSize:], payload)
+
+	if _, err := w.file.Write(record); err != nil {
+		// Недописанная запись будет отброшена при следующем открытии,
+		// но следующие записи не должны оказаться после нее
+		if terr := w.file.Truncate(w.size); terr != nil {
+			return errors.Join(err, terr)
+		}
+		return err
+	}
+	if err := w.file.Sync(); err != nil {
+		return err
+	}
+	w.size += int64(len(record))
+
+	return nil
+}
+
+// reset очищает журнал после того, как его записи попали в снимок.
+func (w *wal) reset() error {
+	if err := w.file.Truncate(0); err != nil {
+		return err
+	}
+	w.size = 0
+
+	return w.file.Sync()
+}
+
+func (w *wal) close() error {
+	return w.file.Close()
+}
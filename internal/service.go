@@ -3,11 +3,9 @@ package internal
 
 import (
 	"context"
-	"encoding/hex"
-	"encoding/json"
 	"errors"
 	"fmt"
-	"hash"
+	"log"
 	"math/rand"
 	"slices"
 	"strconv"
@@ -15,12 +13,12 @@ import (
 	"sync/atomic"
 	"time"
 
-	"github.com/go-resty/resty/v2"
 	"github.com/smartfor/metrics/internal/config"
 	"github.com/smartfor/metrics/internal/core"
-	"github.com/smartfor/metrics/internal/crypto"
 	"github.com/smartfor/metrics/internal/metrics"
 	"github.com/smartfor/metrics/internal/polling"
+	"github.com/smartfor/metrics/internal/push"
+	"github.com/smartfor/metrics/internal/spool"
 	"github.com/smartfor/metrics/internal/utils"
 )
 
@@ -41,43 +39,126 @@ type JobResult struct {
 }
 
 type Service struct {
-	client             *resty.Client
+	sender             Sender
+	collectors         []polling.Collector
+	push               *push.Server
 	mu                 *sync.Mutex
 	config             config.Config
 	pollCounter        atomic.Int64
-	privateKey         []byte
+	batchSeq           *batchSequence
 	inShutdown         atomic.Bool
 	activeWorkersCount atomic.Int64
 }
 
-func NewService(cfg *config.Config, privateKey []byte) Service {
-	client := resty.
-		New().
-		SetBaseURL(cfg.HostEndpoint).
-		SetHeader("Content-Type", "application/json").
-		SetTimeout(cfg.ResponseTimeoutDuration)
+// NewService создает агент, который отправляет метрики на сервер транспортом из cfg.Transport,
+// где privateKey - публичный ключ сервера для шифрования метрик.
+// Если задан cfg.SpoolDir, пачки сначала сохраняются в дисковую очередь и отправляются из нее в фоне.
+// Если задан cfg.PushAddress или cfg.PushSocket, агент принимает метрики локальных приложений
+// и отправляет их вместе со своими.
+func NewService(cfg *config.Config, privateKey []byte) (Service, error) {
+	var (
+		sender     Sender
+		collectors []polling.Collector
+		err        error
+	)
+
+	collectors, err = newCollectors(cfg)
+	if err != nil {
+		return Service{}, err
+	}
+
+	// Номера пачек сохраняются вместе с очередью: пачки из нее отправляются и после перезапуска
+	batchSeq, err := newBatchSequence(cfg.SpoolDir)
+	if err != nil {
+		return Service{}, err
+	}
+
+	switch cfg.Transport {
+	case config.TransportGRPC:
+		sender, err = NewGRPCSender(cfg, privateKey)
+		if err != nil {
+			return Service{}, err
+		}
+	default:
+		sender = NewHTTPSender(cfg, privateKey)
+	}
+
+	if cfg.SpoolDir != "" {
+		sp, err := spool.Open(spool.Config{
+			Dir:     cfg.SpoolDir,
+			MaxSize: int64(cfg.SpoolMaxSize),
+			MaxAge:  cfg.SpoolMaxAgeDuration,
+		})
+		if err != nil {
+			sender.Close()
+			return Service{}, err
+		}
+
+		sender = NewSpoolSender(sender, sp, cfg.ReportIntervalDuration)
+	}
+
+	var pushServer *push.Server
+	if cfg.PushAddress != "" || cfg.PushSocket != "" {
+		pushServer = push.NewServer(cfg.PushAddress, cfg.PushSocket, cfg.PollIntervalDuration)
+		if err := pushServer.Start(); err != nil {
+			sender.Close()
+			return Service{}, err
+		}
+		collectors = append(collectors, pushServer)
+	}
 
 	return Service{
 		config:             *cfg,
-		client:             client,
-		privateKey:         privateKey,
+		sender:             sender,
+		collectors:         collectors,
+		push:               pushServer,
+		batchSeq:           batchSeq,
 		mu:                 &sync.Mutex{},
 		inShutdown:         atomic.Bool{},
 		activeWorkersCount: atomic.Int64{},
+	}, nil
+}
+
+// newCollectors создает включенные в конфигурации коллекторы в порядке их имен.
+func newCollectors(cfg *config.Config) ([]polling.Collector, error) {
+	names := make([]string, 0, len(cfg.Collectors))
+	for name, c := range cfg.Collectors {
+		if c.Enabled {
+			names = append(names, name)
+		}
 	}
+	slices.Sort(names)
+
+	collectors := make([]polling.Collector, 0, len(names))
+	for _, name := range names {
+		c := cfg.Collectors[name]
+		collector, err := polling.NewCollector(name, polling.Settings{
+			Interval: c.IntervalDuration,
+			Options:  c.Options,
+		})
+		if err != nil {
+			return nil, err
+		}
+		collectors = append(collectors, collector)
+	}
+
+	return collectors, nil
 }
 
 func (s *Service) Run(ctx context.Context) error {
 	var (
-		mainPollCh     = polling.CreateMainPollChannel(ctx, s.config.PollIntervalDuration)
-		advancedPollCh = polling.CreateAdvancedPollChannel(ctx, s.config.PollIntervalDuration)
-		fanIn          = polling.FanInPolling(ctx, mainPollCh, advancedPollCh)
-		jobs           = make(chan Job, s.config.RateLimit)
-		results        = make(chan JobResult, s.config.RateLimit)
-		messages       = make([]polling.PollMessage, 0, 1024)
-		ticker         = time.NewTicker(s.config.ReportIntervalDuration)
+		pollChs  = make([]<-chan polling.PollMessage, 0, len(s.collectors))
+		jobs     = make(chan Job, s.config.RateLimit)
+		results  = make(chan JobResult, s.config.RateLimit)
+		messages = make([]polling.PollMessage, 0, 1024)
+		ticker   = time.NewTicker(s.config.ReportIntervalDuration)
 	)
 
+	for _, c := range s.collectors {
+		pollChs = append(pollChs, polling.CreateCollectorChannel(ctx, c))
+	}
+	fanIn := polling.FanInPolling(ctx, pollChs...)
+
 	for w := 0; w <= s.config.RateLimit; w++ {
 		go s.worker(jobs, results)
 	}
@@ -88,6 +169,8 @@ func (s *Service) Run(ctx context.Context) error {
 			return ctx.Err()
 		case msg := <-fanIn:
 			if msg.Err != nil {
+				// Ошибка одного коллектора не мешает отправке метрик остальных
+				log.Printf("Collector %s failed: %v", msg.Collector, msg.Err)
 				continue
 			}
 
@@ -107,31 +190,11 @@ func (s *Service) Run(ctx context.Context) error {
 				continue
 			}
 
-			slices.Reverse(messages)
-			var (
-				store       = make(polling.MetricStore)
-				hasMain     bool
-				hasAdvanced bool
-			)
-
+			// Сообщения объединяются в порядке получения: последнее значение gauge
+			// перекрывает предыдущие, приращения counter и histogram суммируются
+			store := make(polling.MetricStore)
 			for _, m := range messages {
-				if m.Type == polling.PollMainMetricsType {
-					for k, v := range m.Msg {
-						store[k] = v
-					}
-					hasMain = true
-				}
-
-				if m.Type == polling.PollAdvancedMetricsType {
-					for k, v := range m.Msg {
-						store[k] = v
-					}
-					hasAdvanced = true
-				}
-			}
-
-			if !hasMain || !hasAdvanced {
-				continue
+				store.Merge(m.Msg)
 			}
 
 			messages = messages[:0]
@@ -165,14 +228,9 @@ func (s *Service) worker(jobs <-chan Job, results chan<- JobResult) {
 
 func (s *Service) send(store polling.MetricStore, pollCounter int64) error {
 	var (
-		batch      []metrics.Metrics
-		err        error
-		body       []byte
-		key        []byte
-		compressed []byte
-		sign       hash.Hash
-		hexHash    string
-		metric     *metrics.Metrics
+		batch  []metrics.Metrics
+		err    error
+		metric *metrics.Metrics
 	)
 
 	store["PoolCount"] = polling.MetricsModel{
@@ -182,6 +240,7 @@ func (s *Service) send(store polling.MetricStore, pollCounter int64) error {
 	}
 
 	for _, v := range store {
+		v.Labels = core.Labels(s.config.Labels).Merge(v.Labels)
 		metric, err = metrics.FromMetricModel(v)
 		if err != nil {
 			fmt.Println("Extract metric from model error: ", err)
@@ -190,57 +249,26 @@ func (s *Service) send(store polling.MetricStore, pollCounter int64) error {
 		batch = append(batch, *metric)
 	}
 
-	if body, err = json.Marshal(batch); err != nil {
-		fmt.Println("Marshalling batch error: ", err)
-		return err
-	}
-
-	if s.config.Secret != "" {
-		sign = utils.Sign(body, s.config.Secret)
-		hexHash = hex.EncodeToString(sign.Sum(nil))
+	id := core.BatchID{
+		AgentID: s.config.AgentID,
+		Key:     utils.RandomID(),
 	}
-
-	if s.privateKey != nil {
-		body, key, err = crypto.EncryptWithPublicKey(body, s.privateKey)
-		if err != nil {
-			fmt.Println("Encryption error: ", err)
-			return err
-		}
-	}
-
-	if compressed, err = utils.GzipCompress(body); err != nil {
-		fmt.Println("Compressed body error: ", err)
+	if id.Seq, err = s.batchSeq.Next(); err != nil {
 		return err
 	}
 
-	_, err = utils.Retry(func() (*resty.Response, error) {
-		r := s.client.R().
-			SetHeader("Content-Type", "application/json").
-			SetHeader("Accept-Encoding", "gzip").
-			SetHeader("Content-Encoding", "gzip").
-			SetBody(compressed)
-
-		if s.privateKey != nil {
-			r = r.SetHeader(utils.CryptoKey, hex.EncodeToString(key))
-		}
-
-		if s.config.Secret != "" {
-			r = r.SetHeader(utils.AuthHeaderName, hexHash)
-		}
-
-		return r.Post(UpdateBatchURL)
-	}, nil)
-	if err != nil {
-		return err
-	}
-
-	return nil
+	return s.sender.Send(context.Background(), id, batch)
 }
 
 func (s *Service) Shutdown(ctx context.Context) error {
 	s.inShutdown.Store(true)
 	defer s.inShutdown.Store(false)
 
+	var pushErr error
+	if s.push != nil {
+		pushErr = s.push.Shutdown(ctx)
+	}
+
 	shutdownPollIntervalMax := 10 * time.Second
 	pollIntervalBase := time.Millisecond
 	nextPollInterval := func() time.Duration {
@@ -258,7 +286,7 @@ func (s *Service) Shutdown(ctx context.Context) error {
 	defer timer.Stop()
 	for {
 		if s.activeWorkersCount.Load() == 0 {
-			return nil
+			return errors.Join(pushErr, s.sender.Close())
 		}
 		select {
 		case <-ctx.Done():
@@ -0,0 +1,59 @@
+package internal
+
+import (
+	"testing"
+	"time"
+
+	"github.com/smartfor/metrics/internal/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewCollectors(t *testing.T) {
+	cfg := &config.Config{Collectors: map[string]config.CollectorConfig{
+		"uptime": {Enabled: true, IntervalDuration: time.Second},
+		"disk":   {Enabled: true, IntervalDuration: time.Minute},
+		"net":    {Enabled: false, IntervalDuration: time.Second},
+		"load":   {IntervalDuration: time.Second},
+	}}
+
+	collectors, err := newCollectors(cfg)
+	require.NoError(t, err)
+
+	names := make([]string, 0, len(collectors))
+	for _, c := range collectors {
+		names = append(names, c.Name())
+	}
+	assert.Equal(t, []string{"disk", "uptime"}, names, "only enabled collectors, sorted by name")
+	assert.Equal(t, time.Minute, collectors[0].Interval())
+
+	cfg.Collectors["unknown"] = config.CollectorConfig{Enabled: true}
+	_, err = newCollectors(cfg)
+	assert.Error(t, err)
+}
+
+func TestBatchSequence(t *testing.T) {
+	dir := t.TempDir()
+
+	seq, err := newBatchSequence(dir)
+	require.NoError(t, err)
+	for want := uint64(1); want <= batchSeqReserve+1; want++ {
+		got, err := seq.Next()
+		require.NoError(t, err)
+		require.Equal(t, want, got)
+	}
+
+	// После перезапуска номера продолжают расти
+	seq, err = newBatchSequence(dir)
+	require.NoError(t, err)
+	got, err := seq.Next()
+	require.NoError(t, err)
+	assert.Greater(t, got, uint64(batchSeqReserve+1))
+
+	// Без каталога номера начинаются с 1
+	seq, err = newBatchSequence("")
+	require.NoError(t, err)
+	got, err = seq.Next()
+	require.NoError(t, err)
+	assert.Equal(t, uint64(1), got)
+}
@@ -0,0 +1,523 @@
+// Package spool содержит дисковую очередь записей, разбитую на файлы-сегменты.
+// Агент складывает в нее неотправленные пачки метрик и отправляет их в порядке записи,
+// когда сервер снова доступен. Очередь переживает перезапуск процесса.
+//
+// Сегмент - файл NNNNNNNNNNNNNNNNNNNN.seg с записями вида
+//
+//	[длина payload uint32][crc32 uint32][время записи unix nano int64][payload]
+//
+// Позиция чтения (сегмент и смещение) хранится в файле cursor и обновляется при подтверждении записи.
+package spool
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	ErrEmpty    = errors.New("spool is empty")
+	ErrTooLarge = errors.New("record is larger than spool size limit")
+	ErrClosed   = errors.New("spool is closed")
+	errCorrupt  = errors.New("corrupt spool record")
+)
+
+const (
+	headerSize    = 16
+	segmentSuffix = ".seg"
+	cursorFile    = "cursor"
+
+	// DefaultSegmentSize - размер сегмента, после которого запись продолжается в новый сегмент
+	DefaultSegmentSize = 1 << 20
+)
+
+// Config - параметры очереди
+type Config struct {
+	// Dir - каталог сегментов
+	Dir string
+	// SegmentSize - размер сегмента в байтах, 0 - DefaultSegmentSize
+	SegmentSize int64
+	// MaxSize - ограничение суммарного размера сегментов, при превышении удаляются самые старые сегменты.
+	// 0 - без ограничения.
+	MaxSize int64
+	// MaxAge - записи старше MaxAge пропускаются при чтении, 0 - без ограничения
+	MaxAge time.Duration
+}
+
+type cursor struct {
+	Segment uint64 `json:"segment"`
+	Offset  int64  `json:"offset"`
+}
+
+// Spool - дисковая очередь. Методы безопасны для конкурентного использования.
+type Spool struct {
+	mu     *sync.Mutex
+	config Config
+
+	segments []uint64
+	sizes    map[uint64]int64
+	writer   *os.File
+
+	cursor  cursor
+	reader  *os.File
+	readSeg uint64
+	pending int64
+
+	closed bool
+	now    func() time.Time
+}
+
+// Open открывает очередь в каталоге cfg.Dir, создавая его при необходимости.
+// Недописанная запись в конце последнего сегмента (например, после аварийного завершения) отбрасывается.
+func Open(cfg Config) (*Spool, error) {
+	if cfg.SegmentSize <= 0 {
+		cfg.SegmentSize = DefaultSegmentSize
+	}
+
+	if err := os.MkdirAll(cfg.Dir, 0o700); err != nil {
+		return nil, err
+	}
+
+	s := &Spool{
+		mu:     &sync.Mutex{},
+		config: cfg,
+		sizes:  make(map[uint64]int64),
+		now:    time.Now,
+	}
+
+	if err := s.load(); err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+func (s *Spool) load() error {
+	entries, err := os.ReadDir(s.config.Dir)
+	if err != nil {
+		return err
+	}
+
+	for _, e := range entries {
+		name := e.Name()
+		if e.IsDir() || !strings.HasSuffix(name, segmentSuffix) {
+			continue
+		}
+
+		id, err := strconv.ParseUint(strings.TrimSuffix(name, segmentSuffix), 10, 64)
+		if err != nil {
+			continue
+		}
+
+		info, err := e.Info()
+		if err != nil {
+			return err
+		}
+
+		s.segments = append(s.segments, id)
+		s.sizes[id] = info.Size()
+	}
+	slices.Sort(s.segments)
+
+	if len(s.segments) == 0 {
+		return s.rotate()
+	}
+
+	last := s.segments[len(s.segments)-1]
+	size, err := validLength(s.segmentPath(last))
+	if err != nil {
+		return err
+	}
+	if size != s.sizes[last] {
+		if err := os.Truncate(s.segmentPath(last), size); err != nil {
+			return err
+		}
+		s.sizes[last] = size
+	}
+
+	s.writer, err = os.OpenFile(s.segmentPath(last), os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		return err
+	}
+
+	if err := s.readCursor(); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// Append добавляет запись в конец очереди и сбрасывает ее на диск.
+func (s *Spool) Append(payload []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed {
+		return ErrClosed
+	}
+
+	recordSize := int64(headerSize + len(payload))
+	if s.config.MaxSize > 0 && recordSize > s.config.MaxSize {
+		return ErrTooLarge
+	}
+
+	if s.sizes[s.last()] > 0 && s.sizes[s.last()]+recordSize > s.config.SegmentSize {
+		if err := s.rotate(); err != nil {
+			return err
+		}
+	}
+
+	if err := s.enforceLimits(recordSize); err != nil {
+		return err
+	}
+
+	record := make([]byte, recordSize)
+	binary.LittleEndian.PutUint32(record[0:4], uint32(len(payload)))
+	binary.LittleEndian.PutUint64(record[8:16], uint64(s.now().UnixNano()))
+	copy(record[headerSize:], payload)
+	binary.LittleEndian.PutUint32(record[4:8], crc32.ChecksumIEEE(record[8:]))
+
+	if _, err := s.writer.Write(record); err != nil {
+		return err
+	}
+	s.sizes[s.last()] += recordSize
+
+	return s.writer.Sync()
+}
+
+// Peek возвращает первую неподтвержденную запись, не удаляя ее из очереди.
+// Повторный вызов без Ack возвращает ту же запись. Для пустой очереди возвращает ErrEmpty.
+func (s *Spool) Peek() ([]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed {
+		return nil, ErrClosed
+	}
+
+	for {
+		seg := s.cursor.Segment
+		if s.cursor.Offset >= s.sizes[seg] {
+			if seg == s.last() {
+				return nil, ErrEmpty
+			}
+
+			if err := s.removeOldest(); err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		payload, ts, size, err := s.readRecord(seg, s.cursor.Offset)
+		if errors.Is(err, errCorrupt) {
+			// Остаток поврежденного сегмента пропускается
+			s.cursor.Offset = s.sizes[seg]
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		if s.config.MaxAge > 0 && s.now().Sub(ts) > s.config.MaxAge {
+			s.cursor.Offset += size
+			if err := s.writeCursor(); err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		s.pending = size
+		return payload, nil
+	}
+}
+
+// Ack подтверждает запись, полученную последним вызовом Peek.
+func (s *Spool) Ack() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed {
+		return ErrClosed
+	}
+
+	if s.pending == 0 {
+		return nil
+	}
+
+	s.cursor.Offset += s.pending
+	s.pending = 0
+
+	return s.writeCursor()
+}
+
+// Size возвращает суммарный размер сегментов в байтах.
+func (s *Spool) Size() int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var total int64
+	for _, size := range s.sizes {
+		total += size
+	}
+
+	return total
+}
+
+// Close закрывает файлы очереди.
+func (s *Spool) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed {
+		return nil
+	}
+	s.closed = true
+
+	var errs []error
+	if s.reader != nil {
+		errs = append(errs, s.reader.Close())
+	}
+	errs = append(errs, s.writer.Close())
+
+	return errors.Join(errs...)
+}
+
+func (s *Spool) last() uint64 {
+	return s.segments[len(s.segments)-1]
+}
+
+func (s *Spool) segmentPath(id uint64) string {
+	return filepath.Join(s.config.Dir, fmt.Sprintf("%020d%s", id, segmentSuffix))
+}
+
+// rotate начинает новый сегмент для записи.
+func (s *Spool) rotate() error {
+	var id uint64 = 1
+	if len(s.segments) > 0 {
+		id = s.last() + 1
+	}
+
+	f, err := os.OpenFile(s.segmentPath(id), os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o600)
+	if err != nil {
+		return err
+	}
+
+	if s.writer != nil {
+		if err := s.writer.Close(); err != nil {
+			f.Close()
+			return err
+		}
+	}
+
+	s.writer = f
+	s.segments = append(s.segments, id)
+	s.sizes[id] = 0
+
+	if len(s.segments) == 1 {
+		s.cursor = cursor{Segment: id}
+	}
+
+	return nil
+}
+
+// enforceLimits удаляет самые старые сегменты, пока новая запись не помещается в MaxSize,
+// и сегменты, в которые ничего не писали дольше MaxAge.
+func (s *Spool) enforceLimits(recordSize int64) error {
+	if s.config.MaxAge > 0 {
+		for len(s.segments) > 1 {
+			info, err := os.Stat(s.segmentPath(s.segments[0]))
+			if err != nil {
+				return err
+			}
+			if s.now().Sub(info.ModTime()) <= s.config.MaxAge {
+				break
+			}
+			if err := s.removeOldest(); err != nil {
+				return err
+			}
+		}
+	}
+
+	if s.config.MaxSize <= 0 {
+		return nil
+	}
+
+	total := recordSize
+	for _, size := range s.sizes {
+		total += size
+	}
+
+	for total > s.config.MaxSize {
+		if len(s.segments) == 1 {
+			if err := s.rotate(); err != nil {
+				return err
+			}
+		}
+
+		total -= s.sizes[s.segments[0]]
+		if err := s.removeOldest(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// removeOldest удаляет первый сегмент. Если чтение было в нем, курсор переходит на начало следующего.
+func (s *Spool) removeOldest() error {
+	oldest := s.segments[0]
+
+	if s.reader != nil && s.readSeg == oldest {
+		s.reader.Close()
+		s.reader = nil
+	}
+
+	if err := os.Remove(s.segmentPath(oldest)); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+
+	s.segments = s.segments[1:]
+	delete(s.sizes, oldest)
+
+	if s.cursor.Segment <= oldest {
+		s.cursor = cursor{Segment: s.segments[0]}
+		s.pending = 0
+		return s.writeCursor()
+	}
+
+	return nil
+}
+
+func (s *Spool) readRecord(seg uint64, offset int64) (payload []byte, ts time.Time, size int64, err error) {
+	if s.reader == nil || s.readSeg != seg {
+		if s.reader != nil {
+			s.reader.Close()
+		}
+
+		s.reader, err = os.Open(s.segmentPath(seg))
+		if err != nil {
+			s.reader = nil
+			return nil, time.Time{}, 0, err
+		}
+		s.readSeg = seg
+	}
+
+	header := make([]byte, headerSize)
+	if _, err := s.reader.ReadAt(header, offset); err != nil {
+		return nil, time.Time{}, 0, errCorrupt
+	}
+
+	length := int64(binary.LittleEndian.Uint32(header[0:4]))
+	if offset+headerSize+length > s.sizes[seg] {
+		return nil, time.Time{}, 0, errCorrupt
+	}
+
+	record := make([]byte, 8+length)
+	copy(record, header[8:])
+	if _, err := s.reader.ReadAt(record[8:], offset+headerSize); err != nil {
+		return nil, time.Time{}, 0, errCorrupt
+	}
+
+	if crc32.ChecksumIEEE(record) != binary.LittleEndian.Uint32(header[4:8]) {
+		return nil, time.Time{}, 0, errCorrupt
+	}
+
+	ts = time.Unix(0, int64(binary.LittleEndian.Uint64(header[8:16])))
+
+	return record[8:], ts, headerSize + length, nil
+}
+
+// validLength возвращает длину начала сегмента, состоящего из целых записей с верной контрольной суммой.
+func validLength(path string) (int64, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return 0, err
+	}
+
+	var (
+		offset int64
+		header = make([]byte, headerSize)
+	)
+
+	for {
+		if _, err := io.ReadFull(f, header); err != nil {
+			return offset, nil
+		}
+
+		// Длина из поврежденного заголовка не должна приводить к выделению памяти больше файла
+		length := int64(binary.LittleEndian.Uint32(header[0:4]))
+		if offset+headerSize+length > info.Size() {
+			return offset, nil
+		}
+
+		record := make([]byte, 8+length)
+		copy(record, header[8:])
+		if _, err := io.ReadFull(f, record[8:]); err != nil {
+			return offset, nil
+		}
+
+		if crc32.ChecksumIEEE(record) != binary.LittleEndian.Uint32(header[4:8]) {
+			return offset, nil
+		}
+
+		offset += headerSize + length
+	}
+}
+
+func (s *Spool) readCursor() error {
+	data, err := os.ReadFile(filepath.Join(s.config.Dir, cursorFile))
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+
+	s.cursor = cursor{Segment: s.segments[0]}
+	if err == nil {
+		var c cursor
+		if json.Unmarshal(data, &c) == nil {
+			if _, ok := s.sizes[c.Segment]; ok && c.Offset <= s.sizes[c.Segment] {
+				s.cursor = c
+			}
+		}
+	}
+
+	// Сегменты до курсора уже отправлены
+	for s.segments[0] < s.cursor.Segment {
+		if err := s.removeOldest(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// writeCursor сохраняет позицию чтения через временный файл, чтобы файл курсора не остался недописанным.
+func (s *Spool) writeCursor() error {
+	data, err := json.Marshal(s.cursor)
+	if err != nil {
+		return err
+	}
+
+	path := filepath.Join(s.config.Dir, cursorFile)
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp, path)
+}
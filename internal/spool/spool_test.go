@@ -0,0 +1,145 @@
+package spool
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func drain(t *testing.T, s *Spool) []string {
+	var out []string
+	for {
+		payload, err := s.Peek()
+		if err == ErrEmpty {
+			return out
+		}
+		require.NoError(t, err)
+		out = append(out, string(payload))
+		require.NoError(t, s.Ack())
+	}
+}
+
+func TestSpool(t *testing.T) {
+	t.Run("Records are read in order across segments", func(t *testing.T) {
+		s, err := Open(Config{Dir: t.TempDir(), SegmentSize: 40})
+		require.NoError(t, err)
+		defer s.Close()
+
+		for _, v := range []string{"one", "two", "three", "four"} {
+			require.NoError(t, s.Append([]byte(v)))
+		}
+
+		payload, err := s.Peek()
+		require.NoError(t, err)
+		assert.Equal(t, "one", string(payload))
+
+		// Без Ack запись остается в очереди
+		payload, err = s.Peek()
+		require.NoError(t, err)
+		assert.Equal(t, "one", string(payload))
+
+		assert.Equal(t, []string{"one", "two", "three", "four"}, drain(t, s))
+
+		entries, err := filepath.Glob(filepath.Join(s.config.Dir, "*"+segmentSuffix))
+		require.NoError(t, err)
+		assert.Len(t, entries, 1, "read segments are removed")
+	})
+
+	t.Run("Survives restart", func(t *testing.T) {
+		dir := t.TempDir()
+
+		s, err := Open(Config{Dir: dir, SegmentSize: 40})
+		require.NoError(t, err)
+		for _, v := range []string{"one", "two", "three"} {
+			require.NoError(t, s.Append([]byte(v)))
+		}
+		_, err = s.Peek()
+		require.NoError(t, err)
+		require.NoError(t, s.Ack())
+		require.NoError(t, s.Close())
+
+		s, err = Open(Config{Dir: dir, SegmentSize: 40})
+		require.NoError(t, err)
+		defer s.Close()
+
+		require.NoError(t, s.Append([]byte("four")))
+		assert.Equal(t, []string{"two", "three", "four"}, drain(t, s))
+	})
+
+	t.Run("Torn record at the tail is dropped", func(t *testing.T) {
+		dir := t.TempDir()
+
+		s, err := Open(Config{Dir: dir})
+		require.NoError(t, err)
+		require.NoError(t, s.Append([]byte("one")))
+		require.NoError(t, s.Append([]byte("two")))
+		require.NoError(t, s.Close())
+
+		path := s.segmentPath(s.last())
+		info, err := os.Stat(path)
+		require.NoError(t, err)
+		require.NoError(t, os.Truncate(path, info.Size()-2))
+
+		s, err = Open(Config{Dir: dir})
+		require.NoError(t, err)
+		defer s.Close()
+
+		require.NoError(t, s.Append([]byte("three")))
+		assert.Equal(t, []string{"one", "three"}, drain(t, s))
+	})
+
+	t.Run("Corrupt length at the tail is dropped", func(t *testing.T) {
+		dir := t.TempDir()
+
+		s, err := Open(Config{Dir: dir})
+		require.NoError(t, err)
+		require.NoError(t, s.Append([]byte("one")))
+		require.NoError(t, s.Close())
+
+		// Заголовок с длиной 4 GiB после целой записи
+		f, err := os.OpenFile(s.segmentPath(s.last()), os.O_WRONLY|os.O_APPEND, 0o600)
+		require.NoError(t, err)
+		_, err = f.Write([]byte{0xff, 0xff, 0xff, 0xff, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0})
+		require.NoError(t, err)
+		require.NoError(t, f.Close())
+
+		s, err = Open(Config{Dir: dir})
+		require.NoError(t, err)
+		defer s.Close()
+
+		assert.Equal(t, []string{"one"}, drain(t, s))
+	})
+
+	t.Run("Size limit drops oldest segments", func(t *testing.T) {
+		s, err := Open(Config{Dir: t.TempDir(), SegmentSize: 20, MaxSize: 60})
+		require.NoError(t, err)
+		defer s.Close()
+
+		for _, v := range []string{"1", "2", "3", "4", "5"} {
+			require.NoError(t, s.Append([]byte(v)))
+		}
+
+		assert.LessOrEqual(t, s.Size(), int64(60))
+		assert.Equal(t, []string{"3", "4", "5"}, drain(t, s))
+
+		assert.ErrorIs(t, s.Append(make([]byte, 100)), ErrTooLarge)
+	})
+
+	t.Run("Expired records are skipped", func(t *testing.T) {
+		s, err := Open(Config{Dir: t.TempDir(), MaxAge: time.Minute})
+		require.NoError(t, err)
+		defer s.Close()
+
+		now := time.Now()
+		s.now = func() time.Time { return now.Add(-time.Hour) }
+		require.NoError(t, s.Append([]byte("old")))
+		s.now = func() time.Time { return now }
+		require.NoError(t, s.Append([]byte("new")))
+
+		assert.Equal(t, []string{"new"}, drain(t, s))
+	})
+}
@@ -0,0 +1,23 @@
+package utils
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+)
+
+var (
+	AgentIDHeader        = "X-Agent-ID"
+	IdempotencyKeyHeader = "Idempotency-Key"
+	BatchSeqHeader       = "X-Batch-Seq"
+)
+
+// RandomID возвращает случайный идентификатор из 16 байт в hex - используется для ключей идемпотентности
+// и идентификатора агента.
+func RandomID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+
+	return hex.EncodeToString(b)
+}